@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/viixv/crawler/core/distributed"
+	"github.com/viixv/crawler/core/scheduler"
+	"github.com/viixv/crawler/core/spec"
+)
+
+func coordinatorCmd(args []string) error {
+	fs := flag.NewFlagSet("coordinator", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	addr := fs.String("addr", ":7070", "address the workers connect to")
+	token := fs.String("token", os.Getenv("CRAWLER_TOKEN"), "token the workers must send, default $CRAWLER_TOKEN")
+	ttl := fs.Duration("lease-ttl", 30*time.Second, "time after which the requests of a silent worker are re-queued")
+	newLogger := logFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() != 1 {
+		return usageError("expected one spec file")
+	}
+	logger, err := newLogger()
+	if err != nil {
+		return err
+	}
+
+	s, err := spec.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := s.ValidateDistributed(); err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	pipes, err := s.BuildPipelines()
+	if err != nil {
+		return err
+	}
+	h, err := s.ErrorHandler()
+	if err != nil {
+		spec.CloseAll(pipes, nil)
+		return err
+	}
+	defer spec.CloseAll(pipes, h)
+
+	c := distributed.NewCoordinator(s.Name, scheduler.NewQueueScheduler(false))
+	c.SetDedupe(s.Dedupe).SetLeaseTTL(*ttl).SetToken(*token).SetErrorHandler(h)
+	c.SetLogger(logger)
+	for _, pipe := range pipes {
+		c.AddPipeline(pipe)
+	}
+	respType := s.RespType
+	if respType == "" {
+		respType = "html"
+	}
+	c.AddUrls(s.Seeds, respType)
+
+	if _, err := c.Start(*addr); err != nil {
+		return err
+	}
+	c.Wait()
+	// Give the polling workers time to learn the crawl is done.
+	time.Sleep(2 * time.Second)
+	c.Close()
+	st := c.Status()
+	fmt.Printf("crawl done: %d completed, %d failed, %d items, %d re-queued\n", st.Completed, st.Failed, st.Items, st.Expired)
+	return nil
+}
+
+func workerCmd(args []string) error {
+	fs := flag.NewFlagSet("worker", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	coordinator := fs.String("coordinator", "", "base url of the coordinator, e.g. http://10.0.0.1:7070 (required)")
+	hostname, _ := os.Hostname()
+	name := fs.String("name", fmt.Sprintf("%s-%d", hostname, os.Getpid()), "unique name of the worker")
+	token := fs.String("token", os.Getenv("CRAWLER_TOKEN"), "token of the coordinator, default $CRAWLER_TOKEN")
+	threads := fs.Uint("threads", 0, "override the thread count of the spec")
+	batch := fs.Int("batch", 10, "requests leased at once")
+	newLogger := logFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() != 1 || *coordinator == "" {
+		return usageError("expected -coordinator and one spec file")
+	}
+	logger, err := newLogger()
+	if err != nil {
+		return err
+	}
+
+	s, err := spec.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := s.ValidateDistributed(); err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	rp, err := s.Processor()
+	if err != nil {
+		return err
+	}
+	if *threads > 0 {
+		s.Threads = *threads
+	}
+
+	w := distributed.NewWorker(*coordinator, *name, rp)
+	w.SetToken(*token).SetThreadnum(s.Threads).SetBatchSize(*batch).SetRequestLimits(s.RequestLimits())
+	w.SetLogger(logger)
+	return w.Run()
+}
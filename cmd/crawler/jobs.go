@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/viixv/crawler/core/jobs"
+)
+
+// jobsCmd lists, runs and serves the recurring crawls of a jobs file.
+func jobsCmd(args []string) error {
+	if len(args) == 0 {
+		return usageError("expected list, run, history or serve")
+	}
+	sub, args := args[0], args[1:]
+	fs := flag.NewFlagSet("jobs "+sub, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	n := fs.Int("n", 20, "number of runs shown by history")
+	newLogger := logFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	logger, err := newLogger()
+	if err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return usageError("expected a jobs file")
+	}
+	conf, err := jobs.LoadConfig(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	r, err := conf.Runner()
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	r.SetLogger(logger)
+
+	switch sub {
+	case "list":
+		return listJobs(r)
+	case "run":
+		if fs.NArg() != 2 {
+			return usageError("expected a jobs file and a job name")
+		}
+		run, err := r.Run(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		printRuns([]*jobs.Run{run})
+		if run.Status != jobs.StatusOk {
+			return fmt.Errorf("job %s %s: %s", run.Job, run.Status, run.Error)
+		}
+		return nil
+	case "history":
+		if conf.History == "" {
+			return fmt.Errorf("%s: no history file is configured, add history: to it", fs.Arg(0))
+		}
+		name := ""
+		if fs.NArg() > 1 {
+			name = fs.Arg(1)
+		}
+		runs, err := r.History().Runs(name, *n)
+		if err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			fmt.Println("no runs recorded")
+			return nil
+		}
+		printRuns(runs)
+		return nil
+	case "serve":
+		r.Start()
+		logger.Info("job runner started", "jobs", len(conf.Jobs))
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		logger.Info("job runner stopping")
+		r.Stop()
+		return nil
+	}
+	return usageError("unknown jobs command " + sub)
+}
+
+func listJobs(r *jobs.Runner) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSCHEDULE\tNEXT\tLAST RUN\tSTATUS")
+	for _, s := range r.Jobs() {
+		last, status := "-", "-"
+		if s.Last != nil {
+			last = s.Last.Started.Format(time.DateTime)
+			status = s.Last.Status
+		}
+		next := "-"
+		if s.Next != nil {
+			next = s.Next.Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Name, s.Schedule, next, last, status)
+	}
+	return w.Flush()
+}
+
+func printRuns(runs []*jobs.Run) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tSTARTED\tDURATION\tTRIGGER\tSTATUS\tDOWNLOADED\tFAILED\tITEMS\tERROR")
+	for _, run := range runs {
+		var downloaded, failed, items uint64
+		if run.Stats != nil {
+			downloaded, failed = run.Stats.Downloaded, run.Stats.Failed
+			for _, n := range run.Stats.Items {
+				items += n
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n", run.Job, run.Started.Format(time.DateTime),
+			run.Duration().Round(time.Millisecond), run.Trigger, run.Status, downloaded, failed, items, run.Error)
+	}
+	w.Flush()
+}
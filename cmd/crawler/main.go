@@ -0,0 +1,107 @@
+// Command crawler runs crawls described by YAML or JSON spec files.
+//
+// Usage:
+//
+//	crawler run <spec>        run the crawl described by spec
+//	crawler validate <spec>   check a spec and print its problems
+//	crawler shell <url>       try selectors interactively on a downloaded page
+//	crawler retry-failed -spec <spec> <failed.jsonl>
+//	                          crawl the requests of a dead letter file again
+//	crawler coordinator <spec>
+//	                          serve the frontier of a distributed crawl
+//	crawler worker -coordinator <url> <spec>
+//	                          crawl requests leased from a coordinator
+//	crawler jobs list|run|history|serve <jobs.yaml> [job]
+//	                          run crawls on cron schedules and show their runs
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]*command{
+	"run":          {"run [-threads n] [-metrics addr] [-admin addr [-dashboard] [-stay]] [-log-level level] [-log-format text|json] <spec.yaml|spec.json>", runCmd},
+	"validate":     {"validate <spec.yaml|spec.json>", validateCmd},
+	"retry-failed": {"retry-failed -spec <spec.yaml|spec.json> [-out failed.jsonl] <failed.jsonl>", retryFailedCmd},
+	"coordinator":  {"coordinator [-addr host:port] [-token token] [-lease-ttl 30s] <spec.yaml|spec.json>", coordinatorCmd},
+	"worker":       {"worker -coordinator url [-name name] [-token token] [-threads n] [-batch n] <spec.yaml|spec.json>", workerCmd},
+	"jobs":         {"jobs list|run|history|serve [-n runs] <jobs.yaml> [job]", jobsCmd},
+	"shell":        {"shell [-type html|json|jsonp|text|feed|xml] [-spec spec.yaml] [-file saved.html] [url]", shellCmd},
+}
+
+// usageError is printed together with the usage of the command.
+type usageError string
+
+func (this usageError) Error() string {
+	return string(this)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "crawler: unknown command %q\n", name)
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "crawler "+name+": "+err.Error())
+		if _, ok := err.(usageError); ok {
+			fmt.Fprintln(os.Stderr, "usage: crawler "+cmd.usage)
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		lines = append(lines, "  crawler "+commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "usage:\n"+strings.Join(lines, "\n"))
+}
+
+// logFlags registers the -log-level and -log-format flags and returns a
+// function building the logger they describe.
+func logFlags(fs *flag.FlagSet) func() (*slog.Logger, error) {
+	level := fs.String("log-level", "info", "log level: debug, info, warn or error")
+	format := fs.String("log-format", "text", "log format: text or json")
+	return func() (*slog.Logger, error) {
+		var lvl slog.Level
+		if err := lvl.UnmarshalText([]byte(*level)); err != nil {
+			return nil, usageError("invalid -log-level " + *level)
+		}
+		opts := &slog.HandlerOptions{Level: lvl}
+		switch *format {
+		case "text":
+			return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+		case "json":
+			return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+		}
+		return nil, usageError("invalid -log-format " + *format)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/viixv/crawler/core/deadletter"
+	"github.com/viixv/crawler/core/spec"
+)
+
+// retryFailedCmd crawls the requests of a dead letter file again with the
+// rules and pipelines of a spec.
+func retryFailedCmd(args []string) error {
+	fs := flag.NewFlagSet("retry-failed", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	specFile := fs.String("spec", "", "spec providing the rules and pipelines (required)")
+	out := fs.String("out", "", "dead letter file for requests failing again, default dead_letter of the spec")
+	newLogger := logFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() != 1 || *specFile == "" {
+		return usageError("expected -spec and one dead letter file")
+	}
+	logger, err := newLogger()
+	if err != nil {
+		return err
+	}
+
+	s, err := spec.Load(*specFile)
+	if err != nil {
+		return err
+	}
+	in := fs.Arg(0)
+	failed, err := deadletter.ReadJsonLines(in)
+	if err != nil {
+		return err
+	}
+	if len(failed) == 0 {
+		fmt.Printf("%s: no failed requests\n", in)
+		return nil
+	}
+
+	if *out != "" {
+		s.DeadLetter = *out
+	}
+	if s.DeadLetter != "" && samePath(s.DeadLetter, in) {
+		return fmt.Errorf("dead letter output %s is the input file, choose another one with -out", s.DeadLetter)
+	}
+
+	slog.SetDefault(logger)
+	c, err := s.BuildWithoutSeeds()
+	if err != nil {
+		return err
+	}
+	for _, f := range failed {
+		c.AddRequest(f.Request)
+	}
+	c.Run()
+	snap := c.Stats()
+	fmt.Printf("retried %d requests: %d downloaded, %d failed\n", len(failed), snap.Downloaded, snap.Failed)
+	return nil
+}
+
+func samePath(a, b string) bool {
+	aa, err1 := filepath.Abs(a)
+	bb, err2 := filepath.Abs(b)
+	return err1 == nil && err2 == nil && aa == bb
+}
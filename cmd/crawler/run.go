@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+
+	"github.com/viixv/crawler/core/admin"
+	"github.com/viixv/crawler/core/spec"
+)
+
+func runCmd(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	threads := fs.Uint("threads", 0, "override the thread count of the spec")
+	metrics := fs.String("metrics", "", "serve Prometheus metrics at http://addr/metrics while crawling")
+	adminAddr := fs.String("admin", "", "serve the admin API at addr while crawling")
+	adminToken := fs.String("admin-token", os.Getenv("CRAWLER_ADMIN_TOKEN"), "token of the admin API, default $CRAWLER_ADMIN_TOKEN")
+	dashboard := fs.Bool("dashboard", false, "serve the web dashboard at /dashboard/ of the admin listener")
+	stay := fs.Bool("stay", false, "keep running when the queue is empty, until shut down through the admin API")
+	newLogger := logFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	logger, err := newLogger()
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError("expected one spec file")
+	}
+	if *adminAddr != "" && *adminToken == "" {
+		return usageError("-admin needs -admin-token or $CRAWLER_ADMIN_TOKEN")
+	}
+	if *dashboard && *adminAddr == "" {
+		return usageError("-dashboard needs -admin")
+	}
+	if *stay && *adminAddr == "" {
+		return usageError("-stay needs -admin to add requests and shut down")
+	}
+
+	s, err := spec.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	if *threads > 0 {
+		s.Threads = *threads
+	}
+	c, err := s.Build()
+	if err != nil {
+		return err
+	}
+	c.SetMetricsAddr(*metrics)
+	c.SetExitWhenComplete(!*stay)
+	if *adminAddr != "" {
+		srv := admin.NewServer(c, *adminToken)
+		srv.SetLogger(logger)
+		if *dashboard {
+			srv.EnableDashboard()
+		}
+		if _, err := srv.Start(*adminAddr); err != nil {
+			c.Discard()
+			return err
+		}
+		defer srv.Close()
+	}
+	c.Run()
+	return nil
+}
+
+func validateCmd(args []string) error {
+	if len(args) != 1 {
+		return usageError("expected one spec file")
+	}
+	s, err := spec.Load(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: ok (%d seeds, %d rules)\n", args[0], len(s.Seeds), len(s.Rules))
+	return nil
+}
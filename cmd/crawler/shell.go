@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/viixv/crawler/core/commons/page"
+	"github.com/viixv/crawler/core/commons/request"
+	"github.com/viixv/crawler/core/downloader"
+	"github.com/viixv/crawler/core/processor"
+	"github.com/viixv/crawler/core/spec"
+)
+
+const shellHelp = `commands:
+  css <selector> [@attr]          run a CSS selector; @attr is @text (default), @html or an attribute
+  xpath <expr>                    run an XPath expression
+  re <regexp>                     run a regular expression over the body
+  json <path>                     run a JSONPath expression
+  status                          print status code, final url, error and feed entries
+  headers                         print the response headers
+  body [n]                        print the first n characters of the body (default 500)
+  links [regexp]                  list the links of the page, optionally filtered
+  follow <n|url> [type]           fetch link n of the last "links" or an url
+  fetch <url> [type]              fetch an url
+  field <name> <css|xpath|re|json> <expr> [@attr]
+                                  add the first match as a field of the items
+  items                           print the items collected on this page
+  process                         run the processor of -spec on the page
+  save <file>                     save the body to a file
+  help                            print this help
+  quit                            leave the shell`
+
+type shell struct {
+	out      io.Writer
+	dl       *downloader.HttpDownloader
+	proc     *processor.RuleProcessor
+	p        *page.Page
+	links    []*request.Request
+	respType string
+}
+
+func shellCmd(args []string) error {
+	fs := flag.NewFlagSet("shell", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	respType := fs.String("type", "html", "response type: html, json, jsonp, text, feed or xml")
+	file := fs.String("file", "", "load the page from a saved file instead of downloading it")
+	specFile := fs.String("spec", "", "spec whose rules are run by the process command")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() > 1 || fs.NArg() == 0 && *file == "" {
+		return usageError("expected an url or -file")
+	}
+
+	sh := &shell{out: os.Stdout, dl: downloader.NewHttpDownloader(), respType: *respType}
+	if *specFile != "" {
+		s, err := spec.Load(*specFile)
+		if err != nil {
+			return err
+		}
+		if sh.proc, err = s.Processor(); err != nil {
+			return err
+		}
+	}
+
+	url := fs.Arg(0)
+	if *file != "" {
+		data, err := ioutil.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		if url == "" {
+			url = "file://" + *file
+		}
+		req := request.New(url).RespType(*respType).Build()
+		sh.p = downloader.ParseBody(page.NewPage(req), string(data))
+		sh.status()
+	} else {
+		sh.fetch(url, *respType)
+	}
+	return sh.loop(os.Stdin)
+}
+
+func (this *shell) loop(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for {
+		fmt.Fprint(this.out, ">>> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(this.out)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		name, arg := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			name, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		if name == "quit" || name == "exit" {
+			return nil
+		}
+		this.exec(name, arg)
+	}
+}
+
+func (this *shell) exec(name, arg string) {
+	defer func() {
+		// goquery and the selector libraries panic on some bad input.
+		if r := recover(); r != nil {
+			fmt.Fprintln(this.out, "error:", r)
+		}
+	}()
+	switch name {
+	case "help", "?":
+		fmt.Fprintln(this.out, shellHelp)
+	case "css", "xpath", "re", "json":
+		expr, attr := splitAttr(arg)
+		values, err := this.query(name, expr, attr)
+		if err != nil {
+			fmt.Fprintln(this.out, "error:", err.Error())
+			return
+		}
+		this.printValues(values)
+	case "status":
+		this.status()
+	case "headers":
+		keys := make([]string, 0)
+		for k := range this.p.GetHeader() {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(this.out, "%s: %s\n", k, strings.Join(this.p.GetHeader()[k], ", "))
+		}
+	case "body":
+		n := 500
+		if arg != "" {
+			var err error
+			if n, err = strconv.Atoi(arg); err != nil {
+				fmt.Fprintln(this.out, "error: body takes a number")
+				return
+			}
+		}
+		fmt.Fprintln(this.out, snippet(this.p.GetBodyStr(), n))
+	case "links":
+		opts := &page.LinkOptions{DenyExtensions: []string{}}
+		if arg != "" {
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				fmt.Fprintln(this.out, "error:", err.Error())
+				return
+			}
+			opts.Allow = []*regexp.Regexp{re}
+		}
+		this.links = this.p.ExtractLinks(opts)
+		for i, req := range this.links {
+			fmt.Fprintf(this.out, "[%d] %s  %q\n", i, req.GetUrl(), snippet(req.GetMetaValue(page.MetaAnchorText), 60))
+		}
+	case "follow", "fetch":
+		target, respType := arg, this.respType
+		if i := strings.LastIndexAny(arg, " \t"); i >= 0 {
+			target, respType = arg[:i], strings.TrimSpace(arg[i+1:])
+		}
+		if n, err := strconv.Atoi(target); err == nil && name == "follow" {
+			if n < 0 || n >= len(this.links) {
+				fmt.Fprintln(this.out, "error: no such link, run links first")
+				return
+			}
+			target = this.links[n].GetUrl()
+		}
+		if target == "" {
+			fmt.Fprintln(this.out, "error: "+name+" needs an url")
+			return
+		}
+		this.fetch(target, respType)
+	case "field":
+		parts := strings.SplitN(arg, " ", 3)
+		if len(parts) < 3 {
+			fmt.Fprintln(this.out, "error: usage: field <name> <css|xpath|re|json> <expr> [@attr]")
+			return
+		}
+		expr, attr := splitAttr(parts[2])
+		values, err := this.query(parts[1], expr, attr)
+		if err != nil {
+			fmt.Fprintln(this.out, "error:", err.Error())
+			return
+		}
+		if len(values) == 0 {
+			fmt.Fprintln(this.out, "no match, field not added")
+			return
+		}
+		this.p.AddField(parts[0], values[0])
+		fmt.Fprintf(this.out, "%s = %q\n", parts[0], snippet(values[0], 200))
+	case "items":
+		this.printItems(this.p)
+	case "process":
+		if this.proc == nil {
+			fmt.Fprintln(this.out, "error: start the shell with -spec to use process")
+			return
+		}
+		req := this.p.GetRequest()
+		p := downloader.ParseBody(page.NewPage(req), this.p.GetBodyStr())
+		p.SetHeader(this.p.GetHeader())
+		p.SetStatusCode(this.p.GetStatusCode())
+		p.SetFinalUrl(this.p.GetFinalUrl())
+		this.proc.Process(p)
+		this.printItems(p)
+		fmt.Fprintf(this.out, "target requests: %d\n", len(p.GetTargetRequests()))
+		for i, req := range p.GetTargetRequests() {
+			if i == 20 {
+				fmt.Fprintf(this.out, "  ... %d more\n", len(p.GetTargetRequests())-i)
+				break
+			}
+			fmt.Fprintf(this.out, "  %s [%s]\n", req.GetUrl(), req.GetUrlTag())
+		}
+	case "save":
+		if arg == "" {
+			fmt.Fprintln(this.out, "error: save needs a file name")
+			return
+		}
+		if err := ioutil.WriteFile(arg, []byte(this.p.GetBodyStr()), 0666); err != nil {
+			fmt.Fprintln(this.out, "error:", err.Error())
+		}
+	default:
+		fmt.Fprintf(this.out, "unknown command %q, type help\n", name)
+	}
+}
+
+func (this *shell) query(kind, expr, attr string) ([]string, error) {
+	f := &spec.FieldSpec{Name: "q", Attr: attr}
+	switch kind {
+	case "css":
+		f.CSS = expr
+	case "xpath":
+		f.XPath = expr
+	case "re":
+		f.Regex = expr
+	case "json":
+		f.Json = expr
+	default:
+		return nil, fmt.Errorf("unknown selector kind %q", kind)
+	}
+	ex, err := spec.NewExtractor(f)
+	if err != nil {
+		return nil, err
+	}
+	return ex.Extract(this.p), nil
+}
+
+func (this *shell) fetch(url, respType string) {
+	req := request.New(url).RespType(respType).Build()
+	this.p = this.dl.Download(req)
+	this.links = nil
+	this.respType = respType
+	this.status()
+}
+
+func (this *shell) status() {
+	fmt.Fprintf(this.out, "url:    %s\n", this.p.GetRequest().GetUrl())
+	if this.p.GetFinalUrl() != this.p.GetRequest().GetUrl() {
+		fmt.Fprintf(this.out, "final:  %s\n", this.p.GetFinalUrl())
+	}
+	fmt.Fprintf(this.out, "type:   %s\n", this.p.GetRequest().GetResponceType())
+	fmt.Fprintf(this.out, "status: %d\n", this.p.GetStatusCode())
+	fmt.Fprintf(this.out, "length: %d\n", len(this.p.GetBodyStr()))
+	if f := this.p.GetFeed(); f != nil {
+		fmt.Fprintf(this.out, "feed:   %s %s, %d entries\n", f.Format, f.Version, len(f.Entries))
+	}
+	if !this.p.IsSucc() {
+		fmt.Fprintf(this.out, "error:  %s\n", this.p.Errormsg())
+	}
+}
+
+func (this *shell) printValues(values []string) {
+	for i, v := range values {
+		if i == 50 {
+			fmt.Fprintf(this.out, "... %d more\n", len(values)-i)
+			break
+		}
+		fmt.Fprintf(this.out, "[%d] %q\n", i, snippet(v, 200))
+	}
+	fmt.Fprintf(this.out, "%d match(es)\n", len(values))
+}
+
+func (this *shell) printItems(p *page.Page) {
+	items := p.GetPageItems().GetAll()
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(this.out, "%s\t:\t%s\n", k, snippet(items[k], 200))
+	}
+	if p.GetSkip() {
+		fmt.Fprintln(this.out, "(skipped, pipelines will not receive these items)")
+	}
+}
+
+// splitAttr splits a trailing " @attr" from a selector.
+func splitAttr(arg string) (string, string) {
+	if i := strings.LastIndex(arg, " @"); i >= 0 && !strings.ContainsAny(arg[i+2:], " ]=/") {
+		return strings.TrimSpace(arg[:i]), arg[i+2:]
+	}
+	return arg, ""
+}
+
+func snippet(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "..."
+}
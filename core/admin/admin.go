@@ -0,0 +1,268 @@
+// Package admin serves an HTTP API controlling a running crawler:
+//
+//	POST /requests   add requests, a JSON object or array of request.Request
+//	GET  /queue      queue size, requests in flight, threads and pause state
+//	GET  /stats      stats.Snapshot of the run
+//	POST /pause      stop taking requests from the queue
+//	POST /resume     take requests from the queue again
+//	PUT  /threads    change the thread count, body {"threads": 8}
+//	GET  /errors     recent failed requests, ?n=20
+//	POST /shutdown   finish the requests in flight and make Run return, the queue is kept
+//
+// Server.EnableDashboard adds a web UI at /dashboard/.
+//
+// Every call needs the token, as "Authorization: Bearer <token>" or the
+// X-Admin-Token header.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/viixv/crawler/core/commons/logging"
+	"github.com/viixv/crawler/core/commons/request"
+	"github.com/viixv/crawler/core/crawler"
+	"github.com/viixv/crawler/core/deadletter"
+)
+
+// MaxBodyBytes limits the size of request bodies.
+const MaxBodyBytes = 4 << 20
+
+type Server struct {
+	crawler *crawler.Crawler
+	token   string
+	errors  *deadletter.MemoryHandler
+	mux     *http.ServeMux
+	server  *http.Server
+	logger  *slog.Logger
+
+	dashboard *Dashboard
+}
+
+// NewServer creates the admin API of a crawler. An empty token disables
+// authentication, only use it on trusted networks.
+// Failed requests are kept for /errors in addition to the crawler's own error handler.
+func NewServer(c *crawler.Crawler, token string) *Server {
+	this := &Server{crawler: c, token: token, errors: deadletter.NewMemoryHandler(100)}
+	if h := c.GetErrorHandler(); h != nil {
+		c.SetErrorHandler(deadletter.MultiHandler{h, this.errors})
+	} else {
+		c.SetErrorHandler(this.errors)
+	}
+
+	this.mux = http.NewServeMux()
+	this.handle("/requests", "POST", this.addRequests)
+	this.handle("/queue", "GET", this.queue)
+	this.handle("/stats", "GET", this.stats)
+	this.handle("/pause", "POST", this.pause)
+	this.handle("/resume", "POST", this.resume)
+	this.handle("/threads", "PUT", this.threads)
+	this.handle("/errors", "GET", this.recentErrors)
+	this.handle("/shutdown", "POST", this.shutdown)
+	return this
+}
+
+// Handle registers another handler behind the token check, e.g. a dashboard.
+func (this *Server) Handle(pattern string, h http.Handler) {
+	this.mux.Handle(pattern, this.auth(h))
+}
+
+func (this *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	this.mux.ServeHTTP(w, r)
+}
+
+// SetLogger sets the logger of the server, default is slog.Default().
+func (this *Server) SetLogger(l *slog.Logger) {
+	this.logger = l
+}
+
+// Errors returns the failed requests kept for /errors.
+func (this *Server) Errors() *deadletter.MemoryHandler {
+	return this.errors
+}
+
+// Start listens on addr and serves in the background. It returns the
+// address listened on, useful with port 0.
+func (this *Server) Start(addr string) (string, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	this.server = &http.Server{Handler: this}
+	go func() {
+		if err := this.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logging.Or(this.logger).Error("admin server failed", "addr", addr, "error", err)
+		}
+	}()
+	logging.Or(this.logger).Info("admin server listening", "addr", ln.Addr().String())
+	return ln.Addr().String(), nil
+}
+
+// Close stops a server started with Start and the dashboard sampling.
+func (this *Server) Close() error {
+	if this.dashboard != nil {
+		this.dashboard.Close()
+	}
+	if this.server == nil {
+		return nil
+	}
+	return this.server.Close()
+}
+
+func (this *Server) handle(pattern string, method string, f http.HandlerFunc) {
+	this.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, "method %s not allowed, use %s", r.Method, method)
+			return
+		}
+		f(w, r)
+	}))
+}
+
+func (this *Server) auth(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if this.token != "" {
+			given := r.Header.Get("X-Admin-Token")
+			if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+				given = strings.TrimPrefix(auth, "Bearer ")
+			}
+			if subtle.ConstantTimeCompare([]byte(given), []byte(this.token)) != 1 {
+				writeError(w, http.StatusUnauthorized, "missing or wrong token")
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (this *Server) addRequests(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxBodyBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "read body: %s", err.Error())
+		return
+	}
+	var reqs []*request.Request
+	if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(body, &reqs)
+	} else {
+		req := &request.Request{}
+		err = json.Unmarshal(body, req)
+		reqs = append(reqs, req)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "decode requests: %s", err.Error())
+		return
+	}
+
+	for i, req := range reqs {
+		if req == nil || !(strings.HasPrefix(req.Url, "http://") || strings.HasPrefix(req.Url, "https://")) {
+			writeError(w, http.StatusBadRequest, "requests[%d]: url must be an http(s) url", i)
+			return
+		}
+		if req.Method == "" {
+			req.Method = "GET"
+		}
+		if req.RespType == "" {
+			req.RespType = "html"
+		}
+	}
+	this.crawler.AddRequests(reqs)
+	logging.Or(this.logger).Info("requests added", "count", len(reqs), "remote", r.RemoteAddr)
+	writeJson(w, http.StatusAccepted, map[string]int{"added": len(reqs)})
+}
+
+// QueueStatus is the body of GET /queue.
+type QueueStatus struct {
+	Size    int  `json:"size"`
+	Delayed int  `json:"delayed"`
+	Active  uint `json:"active"`
+	Threads uint `json:"threads"`
+	Paused  bool `json:"paused"`
+	Running bool `json:"running"`
+}
+
+func (this *Server) queueStatus() *QueueStatus {
+	return &QueueStatus{
+		Size:    this.crawler.GetScheduler().Count(),
+		Delayed: this.crawler.Delayed(),
+		Active:  this.crawler.Active(),
+		Threads: this.crawler.GetThreadnum(),
+		Paused:  this.crawler.IsPaused(),
+		Running: this.crawler.IsRunning(),
+	}
+}
+
+func (this *Server) queue(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, this.queueStatus())
+}
+
+func (this *Server) stats(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, this.crawler.Stats())
+}
+
+func (this *Server) pause(w http.ResponseWriter, r *http.Request) {
+	this.crawler.Pause()
+	writeJson(w, http.StatusOK, this.queueStatus())
+}
+
+func (this *Server) resume(w http.ResponseWriter, r *http.Request) {
+	this.crawler.Resume()
+	writeJson(w, http.StatusOK, this.queueStatus())
+}
+
+func (this *Server) threads(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Threads uint `json:"threads"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, MaxBodyBytes)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "decode body: %s", err.Error())
+		return
+	}
+	if body.Threads == 0 {
+		writeError(w, http.StatusBadRequest, "threads must be at least 1")
+		return
+	}
+	this.crawler.SetThreadnum(body.Threads)
+	logging.Or(this.logger).Info("threads changed", "threads", body.Threads, "remote", r.RemoteAddr)
+	writeJson(w, http.StatusOK, this.queueStatus())
+}
+
+func (this *Server) recentErrors(w http.ResponseWriter, r *http.Request) {
+	n := 20
+	if s := r.URL.Query().Get("n"); s != "" {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "n must be a positive integer")
+			return
+		}
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"total":  this.errors.Total(),
+		"errors": this.errors.Recent(n),
+	})
+}
+
+func (this *Server) shutdown(w http.ResponseWriter, r *http.Request) {
+	logging.Or(this.logger).Info("shutdown requested", "remote", r.RemoteAddr)
+	this.crawler.Stop()
+	writeJson(w, http.StatusAccepted, this.queueStatus())
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJson(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
@@ -0,0 +1,193 @@
+package admin
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/request"
+	"github.com/viixv/crawler/core/commons/result"
+	"github.com/viixv/crawler/core/crawler"
+)
+
+//go:embed static
+var static embed.FS
+
+const (
+	// dashboardSamples is the number of one second throughput samples kept, five minutes.
+	dashboardSamples = 300
+	dashboardItems   = 50
+	dashboardErrors  = 50
+)
+
+// Sample is the state of the crawl at one point in time.
+type Sample struct {
+	Time       time.Time `json:"time"`
+	Downloaded uint64    `json:"downloaded"`
+	Failed     uint64    `json:"failed"`
+	Items      uint64    `json:"items"`
+	QueueDepth int       `json:"queue_depth"`
+	Active     uint      `json:"active"`
+}
+
+// RecentItem is a page's items as they reached the pipelines.
+type RecentItem struct {
+	Time   time.Time         `json:"time"`
+	Url    string            `json:"url"`
+	Fields map[string]string `json:"fields"`
+}
+
+// Dashboard samples a crawler for the web UI served at /dashboard/.
+type Dashboard struct {
+	crawler *crawler.Crawler
+	server  *Server
+
+	mutex   sync.Mutex
+	samples []*Sample
+	items   []*RecentItem
+	nItems  uint64
+	stop    chan struct{}
+}
+
+// EnableDashboard serves the web dashboard at /dashboard/ and its data at
+// /dashboard/data. The page itself is public, it asks for the token to load the data.
+func (this *Server) EnableDashboard() *Dashboard {
+	d := &Dashboard{crawler: this.crawler, server: this, stop: make(chan struct{})}
+	this.crawler.OnItem(d.addItem)
+
+	assets, _ := fs.Sub(static, "static")
+	this.mux.Handle("/dashboard/", http.StripPrefix("/dashboard/", http.FileServer(http.FS(assets))))
+	this.handle("/dashboard/data", "GET", d.data)
+	this.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, "/dashboard/", http.StatusFound)
+	})
+	this.dashboard = d
+	go d.sample(time.Second)
+	return d
+}
+
+func (this *Dashboard) sample(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-this.stop:
+			return
+		case now := <-ticker.C:
+			snap := this.crawler.Stats()
+			this.mutex.Lock()
+			this.samples = append(this.samples, &Sample{
+				Time:       now,
+				Downloaded: snap.Downloaded,
+				Failed:     snap.Failed,
+				Items:      this.nItems,
+				QueueDepth: snap.QueueDepth,
+				Active:     this.crawler.Active(),
+			})
+			if len(this.samples) > dashboardSamples {
+				this.samples = append([]*Sample(nil), this.samples[len(this.samples)-dashboardSamples:]...)
+			}
+			this.mutex.Unlock()
+		}
+	}
+}
+
+func (this *Dashboard) addItem(items *result.ResultItems) {
+	fields := make(map[string]string, len(items.GetAll()))
+	for k, v := range items.GetAll() {
+		fields[k] = v
+	}
+	item := &RecentItem{Time: time.Now(), Url: requestUrl(items.GetRequest()), Fields: fields}
+
+	this.mutex.Lock()
+	this.nItems++
+	this.items = append(this.items, item)
+	if len(this.items) > dashboardItems {
+		this.items = append([]*RecentItem(nil), this.items[len(this.items)-dashboardItems:]...)
+	}
+	this.mutex.Unlock()
+}
+
+// Close stops sampling.
+func (this *Dashboard) Close() {
+	select {
+	case <-this.stop:
+	default:
+		close(this.stop)
+	}
+}
+
+type dashboardHost struct {
+	Host   string  `json:"host"`
+	Count  uint64  `json:"count"`
+	Failed uint64  `json:"failed"`
+	MeanMs float64 `json:"mean_ms"`
+}
+
+type dashboardFlight struct {
+	Url     string  `json:"url"`
+	UrlTag  string  `json:"url_tag"`
+	Seconds float64 `json:"seconds"`
+}
+
+type dashboardError struct {
+	Time   time.Time `json:"time"`
+	Url    string    `json:"url"`
+	Error  string    `json:"error"`
+	Status int       `json:"status"`
+	Panic  bool      `json:"panic"`
+}
+
+func (this *Dashboard) data(w http.ResponseWriter, r *http.Request) {
+	snap := this.crawler.Stats()
+	now := time.Now()
+
+	hosts := make([]*dashboardHost, 0, len(snap.Hosts))
+	for host, h := range snap.Hosts {
+		hosts = append(hosts, &dashboardHost{Host: host, Count: h.Count, Failed: h.Failed, MeanMs: float64(h.Mean()) / float64(time.Millisecond)})
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Count > hosts[j].Count })
+
+	flights := make([]*dashboardFlight, 0)
+	for _, f := range this.crawler.InFlight() {
+		flights = append(flights, &dashboardFlight{Url: f.Request.GetUrl(), UrlTag: f.Request.GetUrlTag(), Seconds: now.Sub(f.Started).Seconds()})
+	}
+
+	errors := make([]*dashboardError, 0)
+	for _, f := range this.server.errors.Recent(dashboardErrors) {
+		errors = append(errors, &dashboardError{Time: f.Time, Url: requestUrl(f.Request), Error: f.Error, Status: f.Status, Panic: f.Panic})
+	}
+
+	this.mutex.Lock()
+	samples := append([]*Sample(nil), this.samples...)
+	items := make([]*RecentItem, 0, len(this.items))
+	for i := len(this.items) - 1; i >= 0; i-- {
+		items = append(items, this.items[i])
+	}
+	this.mutex.Unlock()
+
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"queue":     this.server.queueStatus(),
+		"stats":     snap,
+		"samples":   samples,
+		"hosts":     hosts,
+		"in_flight": flights,
+		"errors":    errors,
+		"items":     items,
+	})
+}
+
+// requestUrl returns the url of a possibly nil request.
+func requestUrl(req *request.Request) string {
+	if req == nil {
+		return ""
+	}
+	return req.GetUrl()
+}
@@ -0,0 +1,122 @@
+(function () {
+  "use strict";
+
+  var token = localStorage.getItem("crawler-admin-token") || "";
+  var $ = function (id) { return document.getElementById(id); };
+
+  $("login").addEventListener("submit", function (e) {
+    e.preventDefault();
+    token = $("token").value;
+    localStorage.setItem("crawler-admin-token", token);
+    $("login").hidden = true;
+    refresh();
+  });
+
+  function text(v) {
+    return (v === undefined || v === null ? "" : String(v)).replace(/[&<>"']/g, function (c) {
+      return "&#" + c.charCodeAt(0) + ";";
+    });
+  }
+
+  function rows(id, list, render) {
+    var body = $(id).querySelector("tbody");
+    body.innerHTML = list.map(function (x) {
+      return "<tr>" + render(x).map(function (c) {
+        return c.wrap ? '<td class="wrap">' + text(c.wrap) + "</td>" : "<td title=\"" + text(c) + "\">" + text(c) + "</td>";
+      }).join("") + "</tr>";
+    }).join("");
+  }
+
+  function clock(t) {
+    return new Date(t).toLocaleTimeString();
+  }
+
+  // rates turns cumulative samples into per second rates.
+  function rates(samples, key) {
+    var out = [];
+    for (var i = 1; i < samples.length; i++) {
+      var dt = (new Date(samples[i].time) - new Date(samples[i - 1].time)) / 1000;
+      out.push(dt > 0 ? Math.max(0, samples[i][key] - samples[i - 1][key]) / dt : 0);
+    }
+    return out;
+  }
+
+  function plot(ctx, values, max, color, w, h) {
+    if (values.length < 2 || max <= 0) return;
+    ctx.strokeStyle = color;
+    ctx.lineWidth = 2;
+    ctx.beginPath();
+    values.forEach(function (v, i) {
+      var x = w - (values.length - 1 - i) * (w / 299);
+      var y = h - 4 - (v / max) * (h - 8);
+      if (i === 0) ctx.moveTo(x, y); else ctx.lineTo(x, y);
+    });
+    ctx.stroke();
+  }
+
+  function draw(samples) {
+    var canvas = $("throughput"), ctx = canvas.getContext("2d");
+    var w = canvas.width, h = canvas.height;
+    ctx.clearRect(0, 0, w, h);
+    var ok = rates(samples, "downloaded"), bad = rates(samples, "failed"), items = rates(samples, "items");
+    var queue = samples.slice(1).map(function (s) { return s.queue_depth; });
+    var max = Math.max.apply(null, [1].concat(ok, bad, items));
+    plot(ctx, queue, Math.max.apply(null, [1].concat(queue)), "#aaa", w, h);
+    plot(ctx, ok, max, "#2a9d4b", w, h);
+    plot(ctx, bad, max, "#d33", w, h);
+    plot(ctx, items, max, "#2f6fd1", w, h);
+    ctx.fillStyle = "#666";
+    ctx.fillText(max.toFixed(1) + "/s", 4, 12);
+    var last = ok.length ? ok[ok.length - 1] : 0;
+    $("rate").textContent = last.toFixed(1);
+  }
+
+  function render(d) {
+    var q = d.queue, s = d.stats;
+    $("task").textContent = s.task;
+    var state = $("state");
+    state.textContent = !q.running ? "stopped" : q.paused ? "paused" : "running";
+    state.className = !q.running ? "" : q.paused ? "paused" : "running";
+    $("queue").textContent = q.size;
+    $("active").textContent = q.active;
+    $("threads").textContent = q.threads;
+    $("downloaded").textContent = s.downloaded;
+    $("failed").textContent = s.failed;
+    draw(d.samples);
+
+    rows("hosts", d.hosts, function (h) {
+      return [h.host, h.count, h.failed, h.mean_ms.toFixed(0) + " ms"];
+    });
+    rows("flight", d.in_flight, function (f) {
+      return [f.url, f.url_tag, f.seconds.toFixed(1) + " s"];
+    });
+    rows("errors", d.errors, function (e) {
+      return [clock(e.time), e.url, e.status || "", { wrap: (e.panic ? "panic: " : "") + e.error }];
+    });
+    rows("items", d.items, function (it) {
+      return [clock(it.time), it.url, { wrap: JSON.stringify(it.fields) }];
+    });
+  }
+
+  function refresh() {
+    fetch("data", { headers: { "Authorization": "Bearer " + token } }).then(function (resp) {
+      if (resp.status === 401) {
+        $("login").hidden = false;
+        $("state").textContent = "token required";
+        $("state").className = "error";
+        return null;
+      }
+      return resp.json();
+    }).then(function (d) {
+      if (d) render(d);
+    }).catch(function () {
+      $("state").textContent = "unreachable";
+      $("state").className = "error";
+    });
+  }
+
+  refresh();
+  setInterval(function () {
+    if ($("login").hidden) refresh();
+  }, 2000);
+})();
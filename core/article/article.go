@@ -0,0 +1,114 @@
+// Package article extracts the main text and the metadata of article pages,
+// so that news sites can be crawled without selectors written per site.
+package article
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/viixv/crawler/core/commons/page"
+	"github.com/viixv/crawler/core/commons/result"
+)
+
+// Article is what Extract finds on a page, fields not found are empty.
+type Article struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	Authors     []string   `json:"authors,omitempty"`
+	Published   *time.Time `json:"published,omitempty"`
+	Modified    *time.Time `json:"modified,omitempty"`
+	Image       string     `json:"image,omitempty"`
+	SiteName    string     `json:"site_name,omitempty"`
+	Canonical   string     `json:"canonical,omitempty"`
+	Language    string     `json:"language,omitempty"`
+	Keywords    []string   `json:"keywords,omitempty"`
+	// Type is the type of the structured data or the og:type, e.g. NewsArticle or article.
+	Type string `json:"type,omitempty"`
+	// Text is the main content without boilerplate, one paragraph per line.
+	Text string `json:"text"`
+
+	// OpenGraph holds the og: properties and Twitter the twitter: ones, without their prefix.
+	OpenGraph map[string]string `json:"open_graph,omitempty"`
+	Twitter   map[string]string `json:"twitter,omitempty"`
+}
+
+// Extract returns the article of an html page, nil when the page was not parsed as html.
+func Extract(p *page.Page) *Article {
+	doc := p.GetHtmlParser()
+	if doc == nil {
+		return nil
+	}
+	return ExtractDocument(doc, p.GetFinalUrl())
+}
+
+// ExtractDocument returns the article of doc, urls are resolved against base.
+// The document is left untouched.
+func ExtractDocument(doc *goquery.Document, base string) *Article {
+	a := &Article{OpenGraph: make(map[string]string), Twitter: make(map[string]string)}
+	m := readMeta(doc, base)
+	a.fill(m)
+	a.Text = mainText(doc)
+
+	if u, err := url.Parse(base); err == nil {
+		a.Canonical = resolve(u, a.Canonical)
+		a.Image = resolve(u, a.Image)
+	}
+	return a
+}
+
+func resolve(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+// Items returns the article as the fields of ResultItems: title, description,
+// author, published, modified, image, site_name, canonical, language,
+// keywords, type and text. Lists are joined with ", ", dates are RFC 3339.
+// Empty fields are left out.
+func (this *Article) Items() map[string]string {
+	items := make(map[string]string)
+	set := func(key, value string) {
+		if value != "" {
+			items[key] = value
+		}
+	}
+	set("title", this.Title)
+	set("description", this.Description)
+	set("author", strings.Join(this.Authors, ", "))
+	if this.Published != nil {
+		set("published", this.Published.Format(time.RFC3339))
+	}
+	if this.Modified != nil {
+		set("modified", this.Modified.Format(time.RFC3339))
+	}
+	set("image", this.Image)
+	set("site_name", this.SiteName)
+	set("canonical", this.Canonical)
+	set("language", this.Language)
+	set("keywords", strings.Join(this.Keywords, ", "))
+	set("type", this.Type)
+	set("text", this.Text)
+	return items
+}
+
+// AddTo adds the fields of Items to items.
+func (this *Article) AddTo(items *result.ResultItems) {
+	for k, v := range this.Items() {
+		items.AddItem(k, v)
+	}
+}
+
+// Fill extracts the article of p and adds its fields to the items of p.
+func Fill(p *page.Page) {
+	if a := Extract(p); a != nil {
+		a.AddTo(p.GetPageItems())
+	}
+}
@@ -0,0 +1,268 @@
+package article
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// The scoring follows the readability heuristics: paragraphs give points to
+// their parent and grand parent, long texts with commas and few links score
+// high, class and id names hint at content or boilerplate.
+var (
+	positive = regexp.MustCompile(`(?i)article|body|content|entry|hentry|main|page|post|text|blog|story`)
+	negative = regexp.MustCompile(`(?i)comment|com-|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|shoutbox|sidebar|sponsor|shopping|tags|tool|widget|banner|breadcrumbs|combx|disqus|extra|header|menu|modal|nav|pager|popup|remark|rss|share|social|subscribe|ad-break|agegate|pagination`)
+)
+
+// skipped are the elements never part of the content.
+var skipped = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "nav": true, "aside": true,
+	"footer": true, "header": true, "form": true, "button": true, "iframe": true, "svg": true, "select": true,
+}
+
+// blocks are the elements whose text makes a line of Article.Text.
+var blocks = map[string]bool{
+	"p": true, "pre": true, "blockquote": true, "li": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "td": true, "dd": true, "figcaption": true,
+}
+
+const minParagraph = 25
+
+type scorer struct {
+	scores map[*html.Node]float64
+	// order is the candidates in document order, so that ties go to the first.
+	order []*html.Node
+}
+
+// mainText returns the text of the best scored element of doc and of its
+// siblings which look like content too.
+func mainText(doc *goquery.Document) string {
+	this := &scorer{scores: make(map[*html.Node]float64)}
+	doc.Find("body").Find("p, pre, td, blockquote").Each(func(i int, s *goquery.Selection) {
+		n := s.Get(0)
+		if unlikely(n) {
+			return
+		}
+		text := nodeText(n)
+		length := utf8.RuneCountInString(text)
+		if length < minParagraph {
+			return
+		}
+		bonus := length / 100
+		if bonus > 3 {
+			bonus = 3
+		}
+		score := 1 + float64(strings.Count(text, ",")+strings.Count(text, "，")+bonus)
+		if parent := n.Parent; parent != nil && parent.Type == html.ElementNode {
+			this.add(parent, score)
+			if grand := parent.Parent; grand != nil && grand.Type == html.ElementNode {
+				this.add(grand, score/2)
+			}
+		}
+	})
+
+	var top *html.Node
+	best := 0.0
+	for _, n := range this.order {
+		score := this.scores[n] * (1 - linkDensity(n))
+		this.scores[n] = score
+		if top == nil || score > best {
+			top, best = n, score
+		}
+	}
+	if top == nil {
+		if body := doc.Find("body"); body.Length() > 0 {
+			return blockText(body.Get(0))
+		}
+		return ""
+	}
+
+	threshold := best * 0.2
+	if threshold < 10 {
+		threshold = 10
+	}
+	var parts []string
+	if top.Parent == nil {
+		return blockText(top)
+	}
+	for n := top.Parent.FirstChild; n != nil; n = n.NextSibling {
+		if n.Type != html.ElementNode || unlikely(n) {
+			continue
+		}
+		keep := n == top || this.scores[n] >= threshold
+		if !keep && n.Data == "p" {
+			text := nodeText(n)
+			keep = utf8.RuneCountInString(text) > 80 && linkDensity(n) < 0.25
+		}
+		if keep {
+			if t := blockText(n); t != "" {
+				parts = append(parts, t)
+			}
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// add scores n the first time with its tag and class weight.
+func (this *scorer) add(n *html.Node, score float64) {
+	if _, ok := this.scores[n]; !ok {
+		this.scores[n] = tagWeight(n) + classWeight(n)
+		this.order = append(this.order, n)
+	}
+	this.scores[n] += score
+}
+
+func tagWeight(n *html.Node) float64 {
+	switch n.Data {
+	case "article":
+		return 10
+	case "div", "main", "section":
+		return 5
+	case "pre", "td", "blockquote":
+		return 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		return -3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		return -5
+	}
+	return 0
+}
+
+func classWeight(n *html.Node) float64 {
+	weight := 0.0
+	for _, key := range []string{"class", "id"} {
+		v := attr(n, key)
+		if v == "" {
+			continue
+		}
+		if negative.MatchString(v) {
+			weight -= 25
+		}
+		if positive.MatchString(v) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// unlikely tells whether n or one of its ancestors is boilerplate.
+func unlikely(n *html.Node) bool {
+	for ; n != nil; n = n.Parent {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		if skipped[n.Data] {
+			return true
+		}
+		if n.Data == "body" || n.Data == "article" || n.Data == "main" {
+			return false
+		}
+		names := attr(n, "class") + " " + attr(n, "id")
+		if negative.MatchString(names) && !positive.MatchString(names) {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// linkDensity is the share of the text of n inside links.
+func linkDensity(n *html.Node) float64 {
+	total := utf8.RuneCountInString(nodeText(n))
+	if total == 0 {
+		return 0
+	}
+	links := 0
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.ElementNode && c.Data == "a" {
+			links += utf8.RuneCountInString(nodeText(c))
+			return
+		}
+		for c := c.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return float64(links) / float64(total)
+}
+
+// nodeText returns the text of n with its spaces collapsed, skipped elements left out.
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		switch c.Type {
+		case html.TextNode:
+			b.WriteString(c.Data)
+			return
+		case html.ElementNode:
+			if skipped[c.Data] {
+				return
+			}
+		}
+		for c := c.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return clean(b.String())
+}
+
+// blockText returns the text of n one block per line, boilerplate left out.
+func blockText(n *html.Node) string {
+	if n.Type == html.ElementNode && blocks[n.Data] {
+		return nodeText(n)
+	}
+	var lines []string
+	var inline strings.Builder
+	flush := func() {
+		if t := clean(inline.String()); t != "" {
+			lines = append(lines, t)
+		}
+		inline.Reset()
+	}
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		switch c.Type {
+		case html.TextNode:
+			inline.WriteString(c.Data)
+			return
+		case html.ElementNode:
+			// The h1 is the title.
+			if skipped[c.Data] || c.Data == "h1" || (c != n && unlikely(c) && !blocks[c.Data]) {
+				return
+			}
+			if blocks[c.Data] {
+				flush()
+				if t := nodeText(c); t != "" {
+					lines = append(lines, t)
+				}
+				return
+			}
+			if c.Data == "br" || c.Data == "div" {
+				flush()
+			}
+		}
+		for c := c.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if c.Type == html.ElementNode && c.Data == "div" {
+			flush()
+		}
+	}
+	walk(n)
+	flush()
+	return strings.Join(lines, "\n")
+}
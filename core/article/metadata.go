@@ -0,0 +1,235 @@
+package article
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/viixv/crawler/core/commons/structured"
+)
+
+// meta is what the head and the markup of a page say about the article.
+type meta struct {
+	// tags holds the content of the first meta tag of each lower cased name, property or itemprop.
+	tags      map[string]string
+	title     string
+	h1        []string
+	lang      string
+	canonical string
+	// data is the first structured data item of an article type.
+	data    *structured.Item
+	byline  []string
+	timeTag string
+}
+
+func readMeta(doc *goquery.Document, base string) *meta {
+	m := &meta{tags: make(map[string]string)}
+	doc.Find("meta").Each(func(i int, s *goquery.Selection) {
+		content, ok := s.Attr("content")
+		if !ok {
+			return
+		}
+		content = strings.TrimSpace(content)
+		for _, attr := range []string{"property", "name", "itemprop", "http-equiv"} {
+			if key, ok := s.Attr(attr); ok {
+				key = strings.ToLower(strings.TrimSpace(key))
+				if _, seen := m.tags[key]; !seen && content != "" {
+					m.tags[key] = content
+				}
+			}
+		}
+	})
+	m.title = clean(doc.Find("head title").First().Text())
+	doc.Find("h1").Each(func(i int, s *goquery.Selection) {
+		if t := clean(s.Text()); t != "" {
+			m.h1 = append(m.h1, t)
+		}
+	})
+	m.lang, _ = doc.Find("html").First().Attr("lang")
+	m.canonical, _ = doc.Find(`link[rel="canonical"]`).First().Attr("href")
+
+	articles := structured.Find(structured.Parse(doc, base), func(item *structured.Item) bool {
+		for _, t := range item.Types {
+			if isArticleType(t) {
+				return true
+			}
+		}
+		return false
+	})
+	if len(articles) > 0 {
+		m.data = articles[0]
+	}
+
+	doc.Find(`a[rel="author"], [itemprop="author"], .byline, .author`).Each(func(i int, s *goquery.Selection) {
+		if t := clean(s.Text()); t != "" && len(t) < 100 {
+			m.byline = append(m.byline, t)
+		}
+	})
+	if t := doc.Find("time[datetime]").First(); t.Length() > 0 {
+		m.timeTag = t.AttrOr("datetime", "")
+	}
+	return m
+}
+
+func isArticleType(t string) bool {
+	t = t[strings.LastIndex(t, "/")+1:]
+	return strings.HasSuffix(t, "Article") || t == "BlogPosting" || t == "Report" || t == "LiveBlogPosting"
+}
+
+// get returns the first value of prop in the structured data.
+func (this *meta) get(prop string) string {
+	if this.data == nil {
+		return ""
+	}
+	return this.data.Get(prop)
+}
+
+func (this *meta) strings(prop string) []string {
+	if this.data == nil {
+		return nil
+	}
+	return this.data.Strings(prop)
+}
+
+func (this *meta) dataType() string {
+	if this.data == nil {
+		return ""
+	}
+	return this.data.Type()
+}
+
+// first returns the first value which is not empty.
+func first(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (this *Article) fill(m *meta) {
+	for key, v := range m.tags {
+		if strings.HasPrefix(key, "og:") {
+			this.OpenGraph[key[3:]] = v
+		} else if strings.HasPrefix(key, "twitter:") {
+			this.Twitter[key[8:]] = v
+		}
+	}
+	t := m.tags
+
+	this.Title = first(t["og:title"], m.get("headline"), t["twitter:title"], m.pageTitle())
+	this.Description = first(t["og:description"], m.get("description"), t["description"], t["twitter:description"])
+	this.Image = first(t["og:image"], m.get("image"), t["twitter:image"])
+	this.SiteName = first(t["og:site_name"], m.get("publisher"), t["application-name"])
+	this.Canonical = first(m.canonical, t["og:url"], m.get("url"))
+	this.Language = first(m.lang, t["content-language"], m.get("inLanguage"), strings.Replace(t["og:locale"], "_", "-", 1))
+	this.Type = first(m.dataType(), t["og:type"])
+
+	authors := m.strings("author")
+	if len(authors) == 0 {
+		for _, v := range []string{t["author"], t["article:author"], t["parsely-author"], t["sailthru.author"]} {
+			// article:author is often the url of a profile.
+			if v != "" && !strings.HasPrefix(v, "http") {
+				authors = []string{v}
+				break
+			}
+		}
+	}
+	if len(authors) == 0 && len(m.byline) > 0 {
+		authors = []string{strings.TrimPrefix(strings.TrimPrefix(m.byline[0], "By "), "by ")}
+	}
+	this.Authors = unique(authors)
+
+	this.Published = parseDate(first(m.get("datePublished"), t["article:published_time"],
+		t["datepublished"], t["pubdate"], t["publishdate"], t["date"], t["dc.date.issued"], t["dc.date"],
+		t["sailthru.date"], t["parsely-pub-date"], m.timeTag))
+	this.Modified = parseDate(first(m.get("dateModified"), t["article:modified_time"],
+		t["og:updated_time"], t["datemodified"]))
+
+	keywords := first(t["keywords"], t["news_keywords"])
+	if keywords == "" {
+		keywords = strings.Join(m.strings("keywords"), ",")
+	}
+	for _, k := range strings.Split(keywords, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			this.Keywords = append(this.Keywords, k)
+		}
+	}
+	this.Keywords = unique(this.Keywords)
+}
+
+// pageTitle returns the only h1 when the <title> contains it, else the
+// <title> without the site name around it.
+func (this *meta) pageTitle() string {
+	if len(this.h1) == 1 && strings.Contains(this.title, this.h1[0]) {
+		return this.h1[0]
+	}
+	for _, sep := range []string{" | ", " - ", " – ", " — ", " :: "} {
+		if !strings.Contains(this.title, sep) {
+			continue
+		}
+		// The site name is usually the shorter part, before or after.
+		longest := ""
+		for _, part := range strings.Split(this.title, sep) {
+			if utf8.RuneCountInString(part) > utf8.RuneCountInString(longest) {
+				longest = part
+			}
+		}
+		return strings.TrimSpace(longest)
+	}
+	if this.title == "" && len(this.h1) > 0 {
+		return this.h1[0]
+	}
+	return this.title
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+	"20060102",
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+}
+
+// parseDate parses the common date formats of article pages, the zero time when none matches.
+// parseDate returns nil when s is not a date.
+func parseDate(s string) *time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+func clean(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func unique(values []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, v := range values {
+		if v = clean(v); v != "" && !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -1,8 +1,32 @@
 package controller
 
+import (
+	"time"
+)
+
 type GoroutineController interface {
 	GetOne()
 	FreeOne()
 	Has() uint
 	Left() uint
 }
+
+// Resizable is implemented by controllers whose capacity can change at run time.
+type Resizable interface {
+	Cap() uint
+	SetCap(num uint)
+}
+
+// Feedback is implemented by controllers adapting to the downloads, the
+// crawler reports each download attempt. status is 0 when there was no response.
+type Feedback interface {
+	Observe(host string, status int, elapsed time.Duration, succ bool)
+}
+
+// HostLimiter is implemented by controllers that also limit each host. The
+// crawler holds a host slot while it crawls a request of the host. It never
+// waits for a host slot while holding a global one, a busy host would hold up the others.
+type HostLimiter interface {
+	TryGetHost(host string) bool
+	FreeHost(host string)
+}
@@ -0,0 +1,281 @@
+package controller
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/logging"
+)
+
+// GoroutineControllerAdaptive is a GoroutineController whose limit follows
+// the servers (AIMD): it grows by one per window of successful downloads whose
+// latency is stable, and is multiplied by the backoff factor on timeouts,
+// connection errors, 429 and 5xx responses, or latencies above the target.
+// The same is done per host when host limits are set.
+type GoroutineControllerAdaptive struct {
+	mutex sync.Mutex
+	cond  *sync.Cond
+
+	global  *limit
+	hosts   map[string]*limit
+	hostMin uint
+	hostMax uint
+	target  time.Duration
+	backoff float64
+	logger  *slog.Logger
+}
+
+// limit is the state of the global or of a host limit.
+type limit struct {
+	value        float64
+	min          float64
+	max          float64
+	has          uint
+	latency      time.Duration
+	lastDecrease time.Time
+}
+
+func newLimit(min uint, max uint) *limit {
+	return &limit{value: float64(min), min: float64(min), max: float64(max)}
+}
+
+func (this *limit) cap() uint {
+	return uint(this.value)
+}
+
+// observe updates the latency average of successful downloads and tells
+// whether elapsed is stable, at most twice the average.
+func (this *limit) observe(elapsed time.Duration) bool {
+	if this.latency == 0 {
+		this.latency = elapsed
+		return true
+	}
+	stable := elapsed <= 2*this.latency
+	this.latency = (this.latency*7 + elapsed) / 8
+	return stable
+}
+
+func (this *limit) grow() {
+	// Only when saturated, an idle limit would otherwise climb to the ceiling.
+	if float64(this.has) < this.value-1 {
+		return
+	}
+	this.value += 1 / this.value
+	if this.value > this.max {
+		this.value = this.max
+	}
+}
+
+func (this *limit) shrink(backoff float64, started time.Time, now time.Time) {
+	// Requests sent before the last decrease saw the old limit, their overload does not count again.
+	if started.Before(this.lastDecrease) {
+		return
+	}
+	this.lastDecrease = now
+	this.value *= backoff
+	if this.value < this.min {
+		this.value = this.min
+	}
+}
+
+// NewGoroutineControllerAdaptive creates a controller allowing between min
+// and max goroutines at once. It starts at min.
+func NewGoroutineControllerAdaptive(min uint, max uint) *GoroutineControllerAdaptive {
+	if min == 0 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	this := &GoroutineControllerAdaptive{
+		global:  newLimit(min, max),
+		hosts:   make(map[string]*limit),
+		backoff: 0.5,
+	}
+	this.cond = sync.NewCond(&this.mutex)
+	return this
+}
+
+// SetHostLimits limits each host to between min and max goroutines, adapted
+// to the responses of the host. Default 0, hosts are not limited.
+func (this *GoroutineControllerAdaptive) SetHostLimits(min uint, max uint) *GoroutineControllerAdaptive {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if min == 0 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	this.hostMin, this.hostMax = min, max
+	this.hosts = make(map[string]*limit)
+	return this
+}
+
+// SetLatencyTarget makes downloads slower than d count as overload. Default 0, no target.
+func (this *GoroutineControllerAdaptive) SetLatencyTarget(d time.Duration) *GoroutineControllerAdaptive {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.target = d
+	return this
+}
+
+// SetBackoff sets the factor applied to the limit on overload, between 0 and 1. Default 0.5.
+func (this *GoroutineControllerAdaptive) SetBackoff(factor float64) *GoroutineControllerAdaptive {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if factor > 0 && factor < 1 {
+		this.backoff = factor
+	}
+	return this
+}
+
+// SetLogger sets the logger of the controller, default is slog.Default().
+func (this *GoroutineControllerAdaptive) SetLogger(l *slog.Logger) {
+	this.logger = l
+}
+
+func (this *GoroutineControllerAdaptive) GetOne() {
+	this.mutex.Lock()
+	for this.global.has >= this.global.cap() {
+		this.cond.Wait()
+	}
+	this.global.has++
+	this.mutex.Unlock()
+}
+
+func (this *GoroutineControllerAdaptive) FreeOne() {
+	this.mutex.Lock()
+	this.global.has--
+	this.mutex.Unlock()
+	this.cond.Broadcast()
+}
+
+func (this *GoroutineControllerAdaptive) Has() uint {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.global.has
+}
+
+func (this *GoroutineControllerAdaptive) Left() uint {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.global.has >= this.global.cap() {
+		return 0
+	}
+	return this.global.cap() - this.global.has
+}
+
+// Cap returns the ceiling of the limit.
+func (this *GoroutineControllerAdaptive) Cap() uint {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return uint(this.global.max)
+}
+
+// SetCap changes the ceiling of the limit, e.g. from Crawler.SetThreadnum.
+func (this *GoroutineControllerAdaptive) SetCap(num uint) {
+	this.mutex.Lock()
+	if float64(num) < this.global.min {
+		num = uint(this.global.min)
+	}
+	this.global.max = float64(num)
+	if this.global.value > this.global.max {
+		this.global.value = this.global.max
+	}
+	this.mutex.Unlock()
+	this.cond.Broadcast()
+}
+
+// Limit returns the number of goroutines currently allowed at once.
+func (this *GoroutineControllerAdaptive) Limit() uint {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.global.cap()
+}
+
+// HostLimits returns the current limit of each host seen, nil when hosts are not limited.
+func (this *GoroutineControllerAdaptive) HostLimits() map[string]uint {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.hostMax == 0 {
+		return nil
+	}
+	limits := make(map[string]uint, len(this.hosts))
+	for host, l := range this.hosts {
+		limits[host] = l.cap()
+	}
+	return limits
+}
+
+func (this *GoroutineControllerAdaptive) host(host string) *limit {
+	l, ok := this.hosts[host]
+	if !ok {
+		l = newLimit(this.hostMin, this.hostMax)
+		this.hosts[host] = l
+	}
+	return l
+}
+
+// TryGetHost takes a slot of host if one is free, it does not block.
+func (this *GoroutineControllerAdaptive) TryGetHost(host string) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.hostMax == 0 {
+		return true
+	}
+	l := this.host(host)
+	if l.has >= l.cap() {
+		return false
+	}
+	l.has++
+	return true
+}
+
+func (this *GoroutineControllerAdaptive) FreeHost(host string) {
+	this.mutex.Lock()
+	if this.hostMax == 0 {
+		this.mutex.Unlock()
+		return
+	}
+	if l := this.host(host); l.has > 0 {
+		l.has--
+	}
+	this.mutex.Unlock()
+	this.cond.Broadcast()
+}
+
+// Observe adapts the limits to a download of host: status is 0 when there was
+// no response. Failures other than overload, e.g. 404, change nothing.
+func (this *GoroutineControllerAdaptive) Observe(host string, status int, elapsed time.Duration, succ bool) {
+	overload := status == 429 || status >= 500 || (status == 0 && !succ)
+	if !succ && !overload {
+		return
+	}
+
+	this.mutex.Lock()
+	if this.target > 0 && elapsed > this.target {
+		overload = true
+	}
+	limits := []*limit{this.global}
+	if this.hostMax > 0 {
+		limits = append(limits, this.host(host))
+	}
+	now := time.Now()
+	before := this.global.cap()
+	for _, l := range limits {
+		if overload {
+			l.shrink(this.backoff, now.Add(-elapsed), now)
+		} else if l.observe(elapsed) {
+			l.grow()
+		}
+	}
+	after := this.global.cap()
+	this.mutex.Unlock()
+
+	this.cond.Broadcast()
+	if after != before {
+		logging.Or(this.logger).Debug("concurrency limit changed", "host", host, "status", status, "duration", elapsed, "limit", after)
+	}
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"sync"
+)
+
+// GoroutineControllerCond is a GoroutineController whose capacity can be
+// changed while goroutines hold it.
+type GoroutineControllerCond struct {
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	capNum uint
+	has    uint
+}
+
+func NewGoroutineControllerCond(num uint) *GoroutineControllerCond {
+	this := &GoroutineControllerCond{capNum: num}
+	this.cond = sync.NewCond(&this.mutex)
+	return this
+}
+
+func (this *GoroutineControllerCond) GetOne() {
+	this.mutex.Lock()
+	for this.has >= this.capNum {
+		this.cond.Wait()
+	}
+	this.has++
+	this.mutex.Unlock()
+}
+
+func (this *GoroutineControllerCond) FreeOne() {
+	this.mutex.Lock()
+	this.has--
+	this.mutex.Unlock()
+	this.cond.Broadcast()
+}
+
+func (this *GoroutineControllerCond) Has() uint {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.has
+}
+
+func (this *GoroutineControllerCond) Left() uint {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.has >= this.capNum {
+		return 0
+	}
+	return this.capNum - this.has
+}
+
+// Cap returns the number of goroutines allowed at once.
+func (this *GoroutineControllerCond) Cap() uint {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.capNum
+}
+
+// SetCap changes the number of goroutines allowed at once. Lowering it does
+// not stop running goroutines, GetOne blocks until enough of them are freed.
+func (this *GoroutineControllerCond) SetCap(num uint) {
+	this.mutex.Lock()
+	this.capNum = num
+	this.mutex.Unlock()
+	this.cond.Broadcast()
+}
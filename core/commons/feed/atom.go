@@ -0,0 +1,169 @@
+package feed
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// Namespaces of Atom 1.0 and of the older Atom 0.3.
+const (
+	nsAtom   = "http://www.w3.org/2005/Atom"
+	nsAtom03 = "http://purl.org/atom/ns#"
+)
+
+var atomSpaces = []string{nsAtom, nsAtom03, ""}
+
+// atomText is a text construct: text, html or xhtml.
+type atomText struct {
+	XMLName xml.Name
+	Type    string `xml:"type,attr"`
+	Value   string `xml:",chardata"`
+	Inner   string `xml:",innerxml"`
+}
+
+func (this *atomText) String() string {
+	if this.Type == "xhtml" {
+		// The content is wrapped in a div.
+		inner := trim(this.Inner)
+		if strings.HasPrefix(inner, "<div") {
+			if i := strings.Index(inner, ">"); i > 0 && strings.HasSuffix(inner, "</div>") {
+				inner = inner[i+1 : len(inner)-len("</div>")]
+			}
+		}
+		return trim(inner)
+	}
+	return trim(this.Value)
+}
+
+func pickText(texts []atomText) string {
+	for _, space := range atomSpaces {
+		for i := range texts {
+			if texts[i].XMLName.Space == space {
+				if v := texts[i].String(); v != "" {
+					return v
+				}
+			}
+		}
+	}
+	return ""
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length int64  `xml:"length,attr"`
+}
+
+type atomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email"`
+	Uri   string `xml:"uri"`
+}
+
+type atomFeed struct {
+	Titles    []atomText   `xml:"title"`
+	Subtitles []atomText   `xml:"subtitle"`
+	Links     []atomLink   `xml:"link"`
+	Lang      string       `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Updated   string       `xml:"updated"`
+	Modified  string       `xml:"modified"`
+	Authors   []atomPerson `xml:"author"`
+	Entries   []atomEntry  `xml:"entry"`
+}
+
+type atomEntry struct {
+	Titles     []atomText   `xml:"title"`
+	Links      []atomLink   `xml:"link"`
+	Id         string       `xml:"id"`
+	Summaries  []atomText   `xml:"summary"`
+	Contents   []atomText   `xml:"content"`
+	Published  string       `xml:"published"`
+	Issued     string       `xml:"issued"`
+	Updated    string       `xml:"updated"`
+	Modified   string       `xml:"modified"`
+	Authors    []atomPerson `xml:"author"`
+	Categories []struct {
+		Term  string `xml:"term,attr"`
+		Label string `xml:"label,attr"`
+	} `xml:"category"`
+}
+
+func parseAtom(data []byte) (*Feed, error) {
+	doc := &atomFeed{}
+	if err := newDecoder(data).Decode(doc); err != nil {
+		return nil, err
+	}
+	f := &Feed{
+		Format:      Atom,
+		Version:     "1.0",
+		Title:       pickText(doc.Titles),
+		Description: pickText(doc.Subtitles),
+		Link:        alternate(doc.Links),
+		Language:    doc.Lang,
+		Updated:     parseDate(doc.Updated),
+		Authors:     atomPersons(doc.Authors),
+	}
+	if f.Updated == nil {
+		f.Updated = parseDate(doc.Modified)
+	}
+	for i := range doc.Entries {
+		f.Entries = append(f.Entries, doc.Entries[i].entry())
+	}
+	return f, nil
+}
+
+func (this *atomEntry) entry() *Entry {
+	e := &Entry{
+		Title:     pickText(this.Titles),
+		Link:      alternate(this.Links),
+		Guid:      trim(this.Id),
+		Summary:   pickText(this.Summaries),
+		Content:   pickText(this.Contents),
+		Published: parseDate(this.Published),
+		Updated:   parseDate(this.Updated),
+		Authors:   atomPersons(this.Authors),
+	}
+	if e.Published == nil {
+		e.Published = parseDate(this.Issued)
+	}
+	if e.Updated == nil {
+		e.Updated = parseDate(this.Modified)
+	}
+	for _, c := range this.Categories {
+		if term := trim(c.Term); term != "" {
+			e.Categories = append(e.Categories, term)
+		}
+	}
+	for _, l := range this.Links {
+		if l.Rel == "enclosure" && l.Href != "" {
+			e.Enclosures = append(e.Enclosures, Enclosure{Url: trim(l.Href), Type: l.Type, Length: l.Length})
+		}
+	}
+	return e
+}
+
+// alternate returns the link to the html page: rel alternate, or no rel.
+func alternate(links []atomLink) string {
+	for _, l := range links {
+		if (l.Rel == "" || l.Rel == "alternate") && (l.Type == "" || strings.Contains(l.Type, "html")) {
+			return trim(l.Href)
+		}
+	}
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return trim(l.Href)
+		}
+	}
+	return ""
+}
+
+func atomPersons(persons []atomPerson) []Person {
+	var out []Person
+	for _, p := range persons {
+		if p := (Person{Name: trim(p.Name), Email: trim(p.Email), Uri: trim(p.Uri)}); p != (Person{}) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
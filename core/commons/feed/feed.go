@@ -0,0 +1,151 @@
+// Package feed parses RSS 0.9x, 1.0 and 2.0 and Atom feeds into one typed Feed.
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Formats of a Feed.
+const (
+	RSS  = "rss"
+	Atom = "atom"
+)
+
+// Feed is a parsed feed.
+type Feed struct {
+	Format string `json:"format"`
+	// Version is 0.91, 0.92, 1.0 or 2.0 for RSS, 1.0 for Atom.
+	Version     string     `json:"version"`
+	Title       string     `json:"title"`
+	Link        string     `json:"link"`
+	Description string     `json:"description,omitempty"`
+	Language    string     `json:"language,omitempty"`
+	Updated     *time.Time `json:"updated,omitempty"`
+	Authors     []Person   `json:"authors,omitempty"`
+	Entries     []*Entry   `json:"entries"`
+}
+
+// Entry is an item of an RSS feed or an entry of an Atom feed.
+type Entry struct {
+	Title string `json:"title"`
+	Link  string `json:"link"`
+	// Guid is the guid of RSS items, the id of Atom entries.
+	Guid      string     `json:"guid,omitempty"`
+	Summary   string     `json:"summary,omitempty"`
+	Content   string     `json:"content,omitempty"`
+	Published *time.Time `json:"published,omitempty"`
+	Updated   *time.Time `json:"updated,omitempty"`
+	Authors   []Person   `json:"authors,omitempty"`
+	// Categories are the category texts of RSS, the terms of Atom.
+	Categories []string    `json:"categories,omitempty"`
+	Enclosures []Enclosure `json:"enclosures,omitempty"`
+}
+
+type Person struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+	Uri   string `json:"uri,omitempty"`
+}
+
+// Enclosure is a file attached to an entry, e.g. the audio of a podcast.
+type Enclosure struct {
+	Url    string `json:"url"`
+	Type   string `json:"type,omitempty"`
+	Length int64  `json:"length,omitempty"`
+}
+
+// ErrNotFeed is returned by Parse for xml documents which are not feeds.
+var ErrNotFeed = errors.New("feed: document is neither RSS nor Atom")
+
+// Parse parses an RSS or Atom document. A document which is not valid utf-8
+// is decoded with the encoding of its xml declaration.
+func Parse(data []byte) (*Feed, error) {
+	root, err := rootName(data)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case root.Local == "feed":
+		return parseAtom(data)
+	case root.Local == "rss" || root.Local == "RDF":
+		return parseRss(data, root.Local == "RDF")
+	}
+	return nil, ErrNotFeed
+}
+
+func newDecoder(data []byte) *xml.Decoder {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	// Feeds in the wild are often not strictly valid.
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	valid := utf8.Valid(data)
+	dec.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		if valid {
+			// Decoded already, e.g. by the downloader.
+			return input, nil
+		}
+		return charset.NewReaderLabel(label, input)
+	}
+	return dec
+}
+
+func rootName(data []byte) (xml.Name, error) {
+	dec := newDecoder(data)
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				return xml.Name{}, ErrNotFeed
+			}
+			return xml.Name{}, err
+		}
+		if start, ok := t.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"Mon, 2 Jan 2006 15:04 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parseDate parses the dates of RSS, RFC 822 with its variants, and of Atom,
+// RFC 3339. It returns nil when s is not a date.
+func parseDate(s string) *time.Time {
+	s = strings.Join(strings.Fields(s), " ")
+	if s == "" {
+		return nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+func trim(s string) string {
+	return strings.TrimSpace(s)
+}
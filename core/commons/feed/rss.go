@@ -0,0 +1,194 @@
+package feed
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+)
+
+// Namespaces of the RSS elements read besides the plain ones.
+const (
+	nsRss10  = "http://purl.org/rss/1.0/"
+	nsRss090 = "http://my.netscape.com/rdf/simple/0.9/"
+	nsDc     = "http://purl.org/dc/elements/1.1/"
+)
+
+// text is an element whose namespace is checked, extensions such as
+// media:title share the local names of RSS.
+type text struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// pick returns the first value which is not empty of an element in one of the namespaces.
+func pick(texts []text, spaces ...string) string {
+	for _, t := range texts {
+		for _, space := range spaces {
+			if t.XMLName.Space == space {
+				if v := trim(t.Value); v != "" {
+					return v
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func picks(texts []text, spaces ...string) []string {
+	var values []string
+	for _, t := range texts {
+		for _, space := range spaces {
+			if t.XMLName.Space == space {
+				if v := trim(t.Value); v != "" {
+					values = append(values, v)
+				}
+			}
+		}
+	}
+	return values
+}
+
+var rssSpaces = []string{"", nsRss10, nsRss090}
+
+type rssDoc struct {
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+	// Items of RSS 0.90 and 1.0 are siblings of the channel.
+	Items []rssItem `xml:"item"`
+}
+
+type rssChannel struct {
+	Titles        []text    `xml:"title"`
+	Links         []text    `xml:"link"`
+	Descriptions  []text    `xml:"description"`
+	Language      []text    `xml:"language"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	PubDate       string    `xml:"pubDate"`
+	Date          string    `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Editor        string    `xml:"managingEditor"`
+	Creators      []string  `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	About        string   `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Titles       []text   `xml:"title"`
+	Links        []text   `xml:"link"`
+	Guid         rssGuid  `xml:"guid"`
+	Descriptions []text   `xml:"description"`
+	Encoded      string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate      string   `xml:"pubDate"`
+	Date         string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Authors      []text   `xml:"author"`
+	Creators     []string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories   []text   `xml:"category"`
+	Subjects     []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+	Enclosures   []struct {
+		Url    string `xml:"url,attr"`
+		Type   string `xml:"type,attr"`
+		Length string `xml:"length,attr"`
+	} `xml:"enclosure"`
+}
+
+type rssGuid struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink string `xml:"isPermaLink,attr"`
+}
+
+func parseRss(data []byte, rdf bool) (*Feed, error) {
+	doc := &rssDoc{}
+	if err := newDecoder(data).Decode(doc); err != nil {
+		return nil, err
+	}
+	c := doc.Channel
+	f := &Feed{
+		Format:      RSS,
+		Version:     doc.Version,
+		Title:       pick(c.Titles, rssSpaces...),
+		Link:        pick(c.Links, rssSpaces...),
+		Description: pick(c.Descriptions, rssSpaces...),
+		Language:    pick(c.Language, append(rssSpaces, nsDc)...),
+	}
+	if rdf {
+		f.Version = "1.0"
+		if len(doc.Items) > 0 && len(c.Items) == 0 {
+			c.Items = doc.Items
+		}
+		if pick(c.Titles, nsRss090) != "" {
+			f.Version = "0.90"
+		}
+	}
+	for _, d := range []string{c.LastBuildDate, c.PubDate, c.Date} {
+		if t := parseDate(d); t != nil {
+			f.Updated = t
+			break
+		}
+	}
+	if p := rssPerson(c.Editor); p.Name != "" || p.Email != "" {
+		f.Authors = append(f.Authors, p)
+	}
+	for _, name := range c.Creators {
+		if name = trim(name); name != "" {
+			f.Authors = append(f.Authors, Person{Name: name})
+		}
+	}
+
+	for i := range c.Items {
+		f.Entries = append(f.Entries, c.Items[i].entry())
+	}
+	return f, nil
+}
+
+func (this *rssItem) entry() *Entry {
+	e := &Entry{
+		Title:   pick(this.Titles, rssSpaces...),
+		Link:    pick(this.Links, rssSpaces...),
+		Guid:    trim(this.Guid.Value),
+		Summary: pick(this.Descriptions, rssSpaces...),
+		Content: trim(this.Encoded),
+	}
+	if e.Guid == "" {
+		e.Guid = this.About
+	}
+	if e.Link == "" && this.Guid.IsPermaLink != "false" && strings.HasPrefix(e.Guid, "http") {
+		e.Link = e.Guid
+	}
+	e.Published = parseDate(this.PubDate)
+	if e.Published == nil {
+		e.Published = parseDate(this.Date)
+	}
+	for _, a := range picks(this.Authors, rssSpaces...) {
+		e.Authors = append(e.Authors, rssPerson(a))
+	}
+	for _, name := range this.Creators {
+		if name = trim(name); name != "" {
+			e.Authors = append(e.Authors, Person{Name: name})
+		}
+	}
+	e.Categories = picks(this.Categories, rssSpaces...)
+	for _, s := range this.Subjects {
+		if s = trim(s); s != "" {
+			e.Categories = append(e.Categories, s)
+		}
+	}
+	for _, enc := range this.Enclosures {
+		if enc.Url == "" {
+			continue
+		}
+		length, _ := strconv.ParseInt(trim(enc.Length), 10, 64)
+		e.Enclosures = append(e.Enclosures, Enclosure{Url: trim(enc.Url), Type: enc.Type, Length: length})
+	}
+	return e
+}
+
+// rssPerson parses the "email (name)" of RSS authors.
+func rssPerson(s string) Person {
+	s = trim(s)
+	if i := strings.Index(s, "("); i > 0 && strings.HasSuffix(s, ")") {
+		return Person{Email: trim(s[:i]), Name: trim(s[i+1 : len(s)-1])}
+	}
+	if strings.Contains(s, "@") && !strings.Contains(s, " ") {
+		return Person{Email: s}
+	}
+	return Person{Name: s}
+}
@@ -0,0 +1,337 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// missing is the value of a filter operand path that selects nothing.
+type missingValue struct{}
+
+var missing = missingValue{}
+
+type expr interface {
+	eval(root, cur interface{}) interface{}
+}
+
+type pathExpr struct {
+	fromRoot bool
+	path     *Path
+}
+
+func (this *pathExpr) eval(root, cur interface{}) interface{} {
+	start := cur
+	if this.fromRoot {
+		start = root
+	}
+	res := this.path.eval(root, start)
+	if len(res) == 0 {
+		return missing
+	}
+	return res[0]
+}
+
+type literalExpr struct {
+	value interface{}
+}
+
+func (this *literalExpr) eval(root, cur interface{}) interface{} {
+	return this.value
+}
+
+type notExpr struct {
+	x expr
+}
+
+func (this *notExpr) eval(root, cur interface{}) interface{} {
+	return !truthy(this.x.eval(root, cur))
+}
+
+type logicExpr struct {
+	and  bool
+	l, r expr
+}
+
+func (this *logicExpr) eval(root, cur interface{}) interface{} {
+	l := truthy(this.l.eval(root, cur))
+	if this.and {
+		return l && truthy(this.r.eval(root, cur))
+	}
+	return l || truthy(this.r.eval(root, cur))
+}
+
+type compareExpr struct {
+	op   string
+	l, r expr
+}
+
+func (this *compareExpr) eval(root, cur interface{}) interface{} {
+	l, r := this.l.eval(root, cur), this.r.eval(root, cur)
+	if l == missing || r == missing {
+		return this.op == "!=" && l != r
+	}
+	switch this.op {
+	case "==":
+		return equal(l, r)
+	case "!=":
+		return !equal(l, r)
+	}
+	if lf, ok := toFloat(l); ok {
+		if rf, ok := toFloat(r); ok {
+			return compareOrdered(this.op, lf < rf, lf == rf)
+		}
+		return false
+	}
+	if ls, ok := l.(string); ok {
+		if rs, ok := r.(string); ok {
+			return compareOrdered(this.op, ls < rs, ls == rs)
+		}
+	}
+	return false
+}
+
+func compareOrdered(op string, less, eq bool) bool {
+	switch op {
+	case "<":
+		return less
+	case "<=":
+		return less || eq
+	case ">":
+		return !less && !eq
+	case ">=":
+		return !less
+	}
+	return false
+}
+
+type matchExpr struct {
+	x  expr
+	re *regexp.Regexp
+}
+
+func (this *matchExpr) eval(root, cur interface{}) interface{} {
+	s, ok := this.x.eval(root, cur).(string)
+	return ok && this.re.MatchString(s)
+}
+
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case missingValue:
+		return false
+	case nil:
+		return false
+	case bool:
+		return t
+	}
+	// An existing member, e.g. [?(@.isbn)], selects the node.
+	return true
+}
+
+func equal(l, r interface{}) bool {
+	if lf, ok := toFloat(l); ok {
+		rf, ok := toFloat(r)
+		return ok && lf == rf
+	}
+	return reflect.DeepEqual(l, r)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	}
+	return 0, false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// exprParser parses filter expressions, sharing the position of the
+// enclosing path parser.
+type exprParser struct {
+	*parser
+}
+
+func (this *exprParser) parseOr() (expr, error) {
+	l, err := this.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		this.skipSpace()
+		if !strings.HasPrefix(this.src[this.pos:], "||") {
+			return l, nil
+		}
+		this.pos += 2
+		r, err := this.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = &logicExpr{l: l, r: r}
+	}
+}
+
+func (this *exprParser) parseAnd() (expr, error) {
+	l, err := this.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		this.skipSpace()
+		if !strings.HasPrefix(this.src[this.pos:], "&&") {
+			return l, nil
+		}
+		this.pos += 2
+		r, err := this.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		l = &logicExpr{and: true, l: l, r: r}
+	}
+}
+
+var compareOps = []string{"==", "!=", "<=", ">=", "=~", "<", ">"}
+
+func (this *exprParser) parseComparison() (expr, error) {
+	l, err := this.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	this.skipSpace()
+	rest := this.src[this.pos:]
+	for _, op := range compareOps {
+		if !strings.HasPrefix(rest, op) {
+			continue
+		}
+		this.pos += len(op)
+		this.skipSpace()
+		if op == "=~" {
+			re, err := this.parseRegexp()
+			if err != nil {
+				return nil, err
+			}
+			return &matchExpr{x: l, re: re}, nil
+		}
+		r, err := this.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &compareExpr{op: op, l: l, r: r}, nil
+	}
+	return l, nil
+}
+
+func (this *exprParser) parseUnary() (expr, error) {
+	this.skipSpace()
+	switch c := this.peek(); {
+	case c == '!':
+		this.pos++
+		x, err := this.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{x: x}, nil
+	case c == '(':
+		this.pos++
+		x, err := this.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		this.skipSpace()
+		if this.peek() != ')' {
+			return nil, this.errorf("expected ')'")
+		}
+		this.pos++
+		return x, nil
+	case c == '@' || c == '$':
+		this.pos++
+		steps, err := this.parsePath(false)
+		if err != nil {
+			return nil, err
+		}
+		return &pathExpr{fromRoot: c == '$', path: &Path{steps: steps}}, nil
+	case c == '\'' || c == '"':
+		s, err := this.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return &literalExpr{value: s}, nil
+	case c == '-' || c >= '0' && c <= '9':
+		start := this.pos
+		this.pos++
+		for this.pos < len(this.src) && strings.IndexByte("0123456789.eE+-", this.src[this.pos]) >= 0 {
+			this.pos++
+		}
+		f, err := strconv.ParseFloat(this.src[start:this.pos], 64)
+		if err != nil {
+			return nil, this.errorf("invalid number %q", this.src[start:this.pos])
+		}
+		return &literalExpr{value: f}, nil
+	}
+	for _, kw := range []string{"true", "false", "null"} {
+		if strings.HasPrefix(this.src[this.pos:], kw) {
+			this.pos += len(kw)
+			switch kw {
+			case "true":
+				return &literalExpr{value: true}, nil
+			case "false":
+				return &literalExpr{value: false}, nil
+			}
+			return &literalExpr{value: nil}, nil
+		}
+	}
+	return nil, this.errorf("unexpected %q in filter", this.src[this.pos:])
+}
+
+func (this *exprParser) parseRegexp() (*regexp.Regexp, error) {
+	if this.peek() != '/' {
+		return nil, this.errorf("expected /regexp/ after =~")
+	}
+	this.pos++
+	var buf strings.Builder
+	for {
+		if this.pos >= len(this.src) {
+			return nil, this.errorf("unterminated regexp")
+		}
+		c := this.src[this.pos]
+		this.pos++
+		if c == '\\' && this.peek() == '/' {
+			buf.WriteByte('/')
+			this.pos++
+			continue
+		}
+		if c == '/' {
+			break
+		}
+		buf.WriteByte(c)
+	}
+	pattern := buf.String()
+	if this.peek() == 'i' {
+		this.pos++
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, this.errorf("%s", err.Error())
+	}
+	return re, nil
+}
@@ -0,0 +1,462 @@
+// Package jsonpath implements JSONPath expressions over decoded JSON values.
+//
+// Supported syntax:
+//
+//	$                root object
+//	@                current object (inside filters)
+//	.name ['name']   child member
+//	..               recursive descent
+//	*  [*]           wildcard
+//	[0] [-1] [0,2]   array index and union
+//	[start:end:step] array slice
+//	[?(expr)]        filter, e.g. [?(@.price < 10 && @.tag =~ /^a/i)]
+package jsonpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path is a compiled JSONPath expression.
+type Path struct {
+	expr  string
+	steps []*step
+}
+
+type step struct {
+	recursive bool
+	sel       selector
+}
+
+type selector interface {
+	apply(root, node interface{}, out []interface{}) []interface{}
+}
+
+// Compile parses a JSONPath expression.
+func Compile(expr string) (*Path, error) {
+	p := &parser{src: strings.TrimSpace(expr)}
+	steps, err := p.parsePath(true)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	return &Path{expr: expr, steps: steps}, nil
+}
+
+// MustCompile is like Compile but panics if the expression cannot be parsed.
+func MustCompile(expr string) *Path {
+	path, err := Compile(expr)
+	if err != nil {
+		panic(err.Error())
+	}
+	return path
+}
+
+// String returns the source text of the expression.
+func (this *Path) String() string {
+	return this.expr
+}
+
+// Find returns all values in data selected by the path.
+func (this *Path) Find(data interface{}) []interface{} {
+	return this.eval(data, data)
+}
+
+func (this *Path) eval(root, cur interface{}) []interface{} {
+	nodes := []interface{}{cur}
+	for _, s := range this.steps {
+		if s.recursive {
+			nodes = descendants(nodes)
+		}
+		next := make([]interface{}, 0, len(nodes))
+		for _, n := range nodes {
+			next = s.sel.apply(root, n, next)
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// Query compiles expr and evaluates it against data.
+func Query(data interface{}, expr string) *Result {
+	path, err := Compile(expr)
+	if err != nil {
+		return NewResult(nil, err)
+	}
+	return NewResult(path.Find(data), nil)
+}
+
+func descendants(nodes []interface{}) []interface{} {
+	out := make([]interface{}, 0, len(nodes))
+	var walk func(n interface{})
+	walk = func(n interface{}) {
+		out = append(out, n)
+		switch v := n.(type) {
+		case map[string]interface{}:
+			for _, k := range sortedKeys(v) {
+				walk(v[k])
+			}
+		case []interface{}:
+			for _, c := range v {
+				walk(c)
+			}
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return out
+}
+
+type nameSelector struct {
+	names []string
+}
+
+func (this *nameSelector) apply(root, node interface{}, out []interface{}) []interface{} {
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return out
+	}
+	for _, name := range this.names {
+		if v, ok := m[name]; ok {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+type wildcardSelector struct{}
+
+func (this *wildcardSelector) apply(root, node interface{}, out []interface{}) []interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(v) {
+			out = append(out, v[k])
+		}
+	case []interface{}:
+		out = append(out, v...)
+	}
+	return out
+}
+
+type indexSelector struct {
+	indexes []int
+}
+
+func (this *indexSelector) apply(root, node interface{}, out []interface{}) []interface{} {
+	arr, ok := node.([]interface{})
+	if !ok {
+		return out
+	}
+	for _, i := range this.indexes {
+		if i < 0 {
+			i += len(arr)
+		}
+		if i >= 0 && i < len(arr) {
+			out = append(out, arr[i])
+		}
+	}
+	return out
+}
+
+type sliceSelector struct {
+	start, end, step int
+	hasStart, hasEnd bool
+}
+
+func (this *sliceSelector) apply(root, node interface{}, out []interface{}) []interface{} {
+	arr, ok := node.([]interface{})
+	if !ok || this.step == 0 {
+		return out
+	}
+	n := len(arr)
+	norm := func(i int) int {
+		if i < 0 {
+			i += n
+		}
+		if i < 0 {
+			return 0
+		}
+		if i > n {
+			return n
+		}
+		return i
+	}
+	if this.step > 0 {
+		start, end := 0, n
+		if this.hasStart {
+			start = norm(this.start)
+		}
+		if this.hasEnd {
+			end = norm(this.end)
+		}
+		for i := start; i < end; i += this.step {
+			out = append(out, arr[i])
+		}
+		return out
+	}
+	// Going backwards the bounds are between -1, before the first element, and n-1.
+	normBack := func(i int) int {
+		if i < 0 {
+			i += n
+		}
+		if i < -1 {
+			return -1
+		}
+		if i >= n {
+			return n - 1
+		}
+		return i
+	}
+	start, end := n-1, -1
+	if this.hasStart {
+		start = normBack(this.start)
+	}
+	if this.hasEnd {
+		end = normBack(this.end)
+	}
+	for i := start; i > end; i += this.step {
+		out = append(out, arr[i])
+	}
+	return out
+}
+
+type filterSelector struct {
+	cond expr
+}
+
+func (this *filterSelector) apply(root, node interface{}, out []interface{}) []interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(v) {
+			if truthy(this.cond.eval(root, v[k])) {
+				out = append(out, v[k])
+			}
+		}
+	case []interface{}:
+		for _, c := range v {
+			if truthy(this.cond.eval(root, c)) {
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+type parser struct {
+	src string
+	pos int
+}
+
+func (this *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("jsonpath: "+format+" at offset %d in %q", append(args, this.pos, this.src)...)
+}
+
+func (this *parser) peek() byte {
+	if this.pos < len(this.src) {
+		return this.src[this.pos]
+	}
+	return 0
+}
+
+func (this *parser) skipSpace() {
+	for this.pos < len(this.src) && (this.src[this.pos] == ' ' || this.src[this.pos] == '\t') {
+		this.pos++
+	}
+}
+
+// parsePath parses steps until the source ends or a character that cannot
+// continue a path is found. A leading '$' or '@' is consumed when top is set
+// or when the path is an operand inside a filter.
+func (this *parser) parsePath(top bool) ([]*step, error) {
+	if top {
+		if c := this.peek(); c == '$' || c == '@' {
+			this.pos++
+		} else if c != '.' && c != '[' && c != 0 {
+			// Allow the "a.b[0]" shorthand without a leading '$'.
+			this.src = "." + this.src
+		}
+	}
+	var steps []*step
+	for this.pos < len(this.src) {
+		c := this.peek()
+		switch {
+		case c == '.' && strings.HasPrefix(this.src[this.pos:], ".."):
+			this.pos += 2
+			s, err := this.parseAfterDot(true)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, s)
+		case c == '.':
+			this.pos++
+			s, err := this.parseAfterDot(false)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, s)
+		case c == '[':
+			sel, err := this.parseBracket()
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, &step{sel: sel})
+		default:
+			return steps, nil
+		}
+	}
+	return steps, nil
+}
+
+func (this *parser) parseAfterDot(recursive bool) (*step, error) {
+	if this.peek() == '[' {
+		sel, err := this.parseBracket()
+		if err != nil {
+			return nil, err
+		}
+		return &step{recursive: recursive, sel: sel}, nil
+	}
+	if this.peek() == '*' {
+		this.pos++
+		return &step{recursive: recursive, sel: &wildcardSelector{}}, nil
+	}
+	start := this.pos
+	for this.pos < len(this.src) && isNameChar(this.src[this.pos]) {
+		this.pos++
+	}
+	if start == this.pos {
+		return nil, this.errorf("expected member name")
+	}
+	return &step{recursive: recursive, sel: &nameSelector{names: []string{this.src[start:this.pos]}}}, nil
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '-' || c == '$' || c >= '0' && c <= '9' ||
+		c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func (this *parser) parseBracket() (selector, error) {
+	this.pos++ // '['
+	this.skipSpace()
+	var sel selector
+	var err error
+	switch c := this.peek(); {
+	case c == '*':
+		this.pos++
+		sel = &wildcardSelector{}
+	case c == '?':
+		this.pos++
+		this.skipSpace()
+		if this.peek() != '(' {
+			return nil, this.errorf("expected '(' after '?'")
+		}
+		this.pos++
+		ep := &exprParser{parser: this}
+		var cond expr
+		if cond, err = ep.parseOr(); err != nil {
+			return nil, err
+		}
+		this.skipSpace()
+		if this.peek() != ')' {
+			return nil, this.errorf("expected ')' closing filter")
+		}
+		this.pos++
+		sel = &filterSelector{cond: cond}
+	case c == '\'' || c == '"':
+		var names []string
+		for {
+			this.skipSpace()
+			var s string
+			if s, err = this.parseString(); err != nil {
+				return nil, err
+			}
+			names = append(names, s)
+			this.skipSpace()
+			if this.peek() != ',' {
+				break
+			}
+			this.pos++
+		}
+		sel = &nameSelector{names: names}
+	default:
+		if sel, err = this.parseIndexOrSlice(); err != nil {
+			return nil, err
+		}
+	}
+	this.skipSpace()
+	if this.peek() != ']' {
+		return nil, this.errorf("expected ']'")
+	}
+	this.pos++
+	return sel, nil
+}
+
+func (this *parser) parseIndexOrSlice() (selector, error) {
+	var parts []string
+	start := this.pos
+	for this.pos < len(this.src) && this.src[this.pos] != ']' {
+		this.pos++
+	}
+	body := this.src[start:this.pos]
+	if strings.Contains(body, ":") {
+		parts = strings.Split(body, ":")
+		if len(parts) > 3 {
+			return nil, this.errorf("invalid slice %q", body)
+		}
+		s := &sliceSelector{step: 1}
+		for i, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, this.errorf("invalid slice %q", body)
+			}
+			switch i {
+			case 0:
+				s.start, s.hasStart = n, true
+			case 1:
+				s.end, s.hasEnd = n, true
+			case 2:
+				s.step = n
+			}
+		}
+		return s, nil
+	}
+	var indexes []int
+	for _, part := range strings.Split(body, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, this.errorf("invalid index %q", body)
+		}
+		indexes = append(indexes, n)
+	}
+	return &indexSelector{indexes: indexes}, nil
+}
+
+func (this *parser) parseString() (string, error) {
+	quote := this.peek()
+	if quote != '\'' && quote != '"' {
+		return "", this.errorf("expected string")
+	}
+	this.pos++
+	var buf strings.Builder
+	for this.pos < len(this.src) {
+		c := this.src[this.pos]
+		this.pos++
+		switch {
+		case c == '\\' && this.pos < len(this.src):
+			buf.WriteByte(this.src[this.pos])
+			this.pos++
+		case c == quote:
+			return buf.String(), nil
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return "", this.errorf("unterminated string")
+}
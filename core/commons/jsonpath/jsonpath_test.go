@@ -0,0 +1,136 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const store = `{
+	"store": {
+		"book": [
+			{"title": "Sayings", "author": "Rees", "price": 8.95, "tag": "ref"},
+			{"title": "Sword", "author": "Waugh", "price": 12.99, "tag": "fiction"},
+			{"title": "Moby Dick", "author": "Melville", "price": 8.99, "isbn": "0-553"},
+			{"title": "Rings", "author": "Tolkien", "price": 22.99, "isbn": "0-395", "tag": "Fantasy"}
+		],
+		"bicycle": {"color": "red", "price": 19.95}
+	},
+	"numbers": [0, 1, 2, 3, 4, 5],
+	"limit": 10
+}`
+
+func decode(t *testing.T, s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestFind(t *testing.T) {
+	data := decode(t, store)
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"$.limit", `[10]`},
+		{"limit", `[10]`},
+		{"$.store.bicycle.color", `["red"]`},
+		{"$['store']['bicycle']['color', 'price']", `["red",19.95]`},
+		{"$.missing", `[]`},
+		{"$.store.*.color", `["red"]`},
+		{"$.numbers[*]", `[0,1,2,3,4,5]`},
+
+		// Indexes and unions.
+		{"$.numbers[0]", `[0]`},
+		{"$.numbers[-1]", `[5]`},
+		{"$.numbers[0,2,-2]", `[0,2,4]`},
+		{"$.numbers[6]", `[]`},
+		{"$.numbers[-7]", `[]`},
+
+		// Slices.
+		{"$.numbers[1:3]", `[1,2]`},
+		{"$.numbers[:2]", `[0,1]`},
+		{"$.numbers[4:]", `[4,5]`},
+		{"$.numbers[-2:]", `[4,5]`},
+		{"$.numbers[::2]", `[0,2,4]`},
+		{"$.numbers[-10:10]", `[0,1,2,3,4,5]`},
+		{"$.numbers[3:1]", `[]`},
+		{"$.numbers[::0]", `[]`},
+		{"$.numbers[::-1]", `[5,4,3,2,1,0]`},
+		{"$.numbers[5:-10:-1]", `[5,4,3,2,1,0]`},
+		{"$.numbers[10:2:-1]", `[5,4,3]`},
+		{"$.numbers[-1:-3:-1]", `[5,4]`},
+		{"$.numbers[::-2]", `[5,3,1]`},
+		{"$.numbers[-10::-1]", `[]`},
+		{"$.numbers[1:3:-1]", `[]`},
+
+		// Recursive descent, members are visited in key order.
+		{"$..author", `["Rees","Waugh","Melville","Tolkien"]`},
+		{"$.store..price", `[19.95,8.95,12.99,8.99,22.99]`},
+		{"$..book[2].title", `["Moby Dick"]`},
+		{"$..book[-1:].title", `["Rings"]`},
+		{"$..color", `["red"]`},
+
+		// Filters.
+		{"$.store.book[?(@.isbn)].title", `["Moby Dick","Rings"]`},
+		{"$.store.book[?(!@.isbn)].title", `["Sayings","Sword"]`},
+		{"$.store.book[?(@.price < 10)].title", `["Sayings","Moby Dick"]`},
+		{"$.store.book[?(@.price < $.limit && @.tag)].title", `["Sayings"]`},
+		{"$.store.book[?(@.price > 20 || @.tag == 'ref')].title", `["Sayings","Rings"]`},
+		{"$.store.book[?(@.tag =~ /^f/i)].title", `["Sword","Rings"]`},
+		{"$.store.book[?(@.tag != 'fiction')].title", `["Sayings","Moby Dick","Rings"]`},
+		{"$..book[?(@.author == \"Tolkien\")].price", `[22.99]`},
+		{"$.numbers[?(@ >= 4)]", `[4,5]`},
+		{"$.store[?(@.color)].price", `[19.95]`},
+	}
+	for _, c := range cases {
+		path, err := Compile(c.expr)
+		if err != nil {
+			t.Errorf("Compile(%q) failed: %v", c.expr, err)
+			continue
+		}
+		got, err := json.Marshal(path.Find(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != c.want {
+			t.Errorf("%s = %s, want %s", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{
+		"$.",
+		"$[",
+		"$[0",
+		"$['a",
+		"$[a]",
+		"$[1:2:3:4]",
+		"$[1:x]",
+		"$[?@.a]",
+		"$[?(@.a == 1]",
+		"$.a b",
+	} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("Compile(%q) succeeded, want an error", expr)
+		} else if !strings.HasPrefix(err.Error(), "jsonpath: ") {
+			t.Errorf("Compile(%q) = %v, want a jsonpath error", expr, err)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	data := decode(t, store)
+	if r := Query(data, "$.store.book[*].price"); r.Err() != nil || r.Len() != 4 {
+		t.Errorf("Query = %d values, %v", r.Len(), r.Err())
+	}
+	if r := Query(data, "$["); r.Err() == nil || r.Len() != 0 {
+		t.Errorf("Query of an invalid expression = %d values, %v, want an error", r.Len(), r.Err())
+	}
+	if got := Query(data, "$..author").Strings(); strings.Join(got, ",") != "Rees,Waugh,Melville,Tolkien" {
+		t.Errorf("Strings = %q", got)
+	}
+}
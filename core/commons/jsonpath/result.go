@@ -0,0 +1,148 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/bitly/go-simplejson"
+)
+
+// Result holds the values selected by a query.
+// Typed accessors skip values that cannot be converted.
+type Result struct {
+	values []interface{}
+	err    error
+}
+
+// NewResult returns a Result holding values, or err if the query failed.
+func NewResult(values []interface{}, err error) *Result {
+	return &Result{values: values, err: err}
+}
+
+// Err returns the error of an invalid expression or missing document.
+func (this *Result) Err() error {
+	return this.err
+}
+
+// Len returns the number of selected values.
+func (this *Result) Len() int {
+	return len(this.values)
+}
+
+// Values returns the selected values as decoded by encoding/json.
+func (this *Result) Values() []interface{} {
+	return this.values
+}
+
+// Get returns the i-th value wrapped as simplejson object, or nil.
+func (this *Result) Get(i int) *simplejson.Json {
+	if i < 0 || i >= len(this.values) {
+		return nil
+	}
+	js := simplejson.New()
+	js.SetPath(nil, this.values[i])
+	return js
+}
+
+// First returns the first value wrapped as simplejson object, or nil.
+func (this *Result) First() *simplejson.Json {
+	return this.Get(0)
+}
+
+// Jsons returns all values wrapped as simplejson objects.
+func (this *Result) Jsons() []*simplejson.Json {
+	jss := make([]*simplejson.Json, 0, len(this.values))
+	for i := range this.values {
+		jss = append(jss, this.Get(i))
+	}
+	return jss
+}
+
+// String returns the first value as string, or "" if there is none.
+func (this *Result) String() string {
+	if ss := this.Strings(); len(ss) > 0 {
+		return ss[0]
+	}
+	return ""
+}
+
+// Strings returns the values as strings. Objects and arrays are encoded as JSON.
+func (this *Result) Strings() []string {
+	ss := make([]string, 0, len(this.values))
+	for _, v := range this.values {
+		switch t := v.(type) {
+		case string:
+			ss = append(ss, t)
+		case json.Number:
+			ss = append(ss, t.String())
+		case nil:
+			ss = append(ss, "")
+		default:
+			b, err := json.Marshal(t)
+			if err == nil {
+				ss = append(ss, string(b))
+			}
+		}
+	}
+	return ss
+}
+
+// Int64s returns the numeric values (or numeric strings) as int64.
+func (this *Result) Int64s() []int64 {
+	ns := make([]int64, 0, len(this.values))
+	for _, v := range this.values {
+		switch t := v.(type) {
+		case json.Number:
+			if n, err := t.Int64(); err == nil {
+				ns = append(ns, n)
+			} else if f, err := t.Float64(); err == nil {
+				ns = append(ns, int64(f))
+			}
+		case float64:
+			ns = append(ns, int64(t))
+		case string:
+			if n, err := strconv.ParseInt(t, 10, 64); err == nil {
+				ns = append(ns, n)
+			}
+		}
+	}
+	return ns
+}
+
+// Float64s returns the numeric values (or numeric strings) as float64.
+func (this *Result) Float64s() []float64 {
+	fs := make([]float64, 0, len(this.values))
+	for _, v := range this.values {
+		if f, ok := toFloat(v); ok {
+			fs = append(fs, f)
+		} else if s, ok := v.(string); ok {
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				fs = append(fs, f)
+			}
+		}
+	}
+	return fs
+}
+
+// Bools returns the boolean values.
+func (this *Result) Bools() []bool {
+	bs := make([]bool, 0, len(this.values))
+	for _, v := range this.values {
+		if b, ok := v.(bool); ok {
+			bs = append(bs, b)
+		}
+	}
+	return bs
+}
+
+// Decode stores the values in the slice pointed to by v, e.g. *[]Record.
+func (this *Result) Decode(v interface{}) error {
+	if this.err != nil {
+		return this.err
+	}
+	b, err := json.Marshal(this.values)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
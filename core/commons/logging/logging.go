@@ -0,0 +1,49 @@
+// Package logging contains helpers for the *slog.Logger shared by crawler components.
+//
+// Records use these keys: task, url, url_tag, attempt, status, duration and error.
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/viixv/crawler/core/commons/request"
+)
+
+// Setter is implemented by components that log through an injected logger.
+// Crawler.SetLogger passes its logger to the downloader, scheduler, processor
+// and pipelines that implement it.
+type Setter interface {
+	SetLogger(l *slog.Logger)
+}
+
+// Or returns l, or slog.Default() when l is nil.
+func Or(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return slog.Default()
+	}
+	return l
+}
+
+// Discard returns a logger that drops every record.
+func Discard() *slog.Logger {
+	return slog.New(discardHandler{})
+}
+
+// Request returns the url and url_tag attributes of req.
+func Request(req *request.Request) []any {
+	if req == nil {
+		return nil
+	}
+	if req.GetUrlTag() == "" {
+		return []any{"url", req.GetUrl()}
+	}
+	return []any{"url", req.GetUrl(), "url_tag", req.GetUrlTag()}
+}
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
@@ -0,0 +1,75 @@
+package page
+
+import (
+	"net/url"
+
+	"github.com/viixv/crawler/core/commons/feed"
+	"github.com/viixv/crawler/core/commons/request"
+	"github.com/viixv/crawler/core/commons/utils"
+)
+
+// SetFeed saves the feed result.
+func (this *Page) SetFeed(f *feed.Feed) *Page {
+	this.feed = f
+	return this
+}
+
+// GetFeed returns the feed result, nil when the response type is not "feed".
+func (this *Page) GetFeed() *feed.Feed {
+	return this.feed
+}
+
+// ExtractFeedLinks returns the links of the feed entries as requests, resolved
+// against the final response url, normalised and filtered like ExtractLinks.
+// Tags and Restrict of opts apply to html only and are ignored. The title of
+// the entry is kept in Meta under MetaAnchorText, MetaLinkSource is "feed".
+func (this *Page) ExtractFeedLinks(opts *LinkOptions) []*request.Request {
+	if opts == nil {
+		opts = &LinkOptions{}
+	}
+	if this.feed == nil {
+		return nil
+	}
+	base, err := url.Parse(this.GetFinalUrl())
+	if err != nil {
+		return nil
+	}
+	respType := opts.RespType
+	if respType == "" {
+		respType = "html"
+	}
+	denyExt := opts.DenyExtensions
+	if denyExt == nil {
+		denyExt = DefaultDenyExtensions
+	}
+
+	var reqs []*request.Request
+	seen := make(map[string]bool)
+	for _, e := range this.feed.Entries {
+		u := resolveLink(base, e.Link)
+		if u == nil {
+			continue
+		}
+		fragment := u.Fragment
+		u = utils.NormalizeUrl(u)
+		if opts.KeepFragment {
+			u.Fragment = fragment
+		}
+		link := u.String()
+		if !opts.KeepDuplicates && seen[link] {
+			continue
+		}
+		if !allowLink(u, link, opts, denyExt) {
+			continue
+		}
+		seen[link] = true
+		reqs = append(reqs, request.New(link).RespType(respType).Tag(opts.UrlTag).
+			Meta(MetaAnchorText, e.Title).Meta(MetaLinkSource, "feed").Build())
+	}
+	return reqs
+}
+
+// FollowFeed extracts the entry links with opts and adds them as target requests.
+func (this *Page) FollowFeed(opts *LinkOptions) *Page {
+	return this.AddTargetRequestsWithParams(this.ExtractFeedLinks(opts))
+}
@@ -0,0 +1,240 @@
+package page
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/viixv/crawler/core/commons/request"
+	"github.com/viixv/crawler/core/commons/utils"
+)
+
+// LinkSources maps element names to the attribute holding their link.
+var LinkSources = map[string]string{
+	"a":      "href",
+	"area":   "href",
+	"img":    "src",
+	"script": "src",
+	"iframe": "src",
+	"link":   "href",
+	"embed":  "src",
+	"source": "src",
+	"frame":  "src",
+}
+
+// DefaultDenyExtensions is used by ExtractLinks when LinkOptions.DenyExtensions is nil.
+var DefaultDenyExtensions = []string{
+	"7z", "apk", "avi", "bin", "bmp", "css", "dmg", "doc", "docx", "exe", "flv",
+	"gif", "gz", "ico", "iso", "jar", "jpeg", "jpg", "js", "m4a", "mkv", "mov",
+	"mp3", "mp4", "mpeg", "msi", "ogg", "pdf", "png", "ppt", "pptx", "rar", "svg",
+	"tar", "tgz", "tif", "tiff", "wav", "webm", "webp", "wma", "wmv", "xls", "xlsx", "zip",
+}
+
+// LinkOptions configures Page.ExtractLinks. The zero value extracts all <a> and
+// <area> links of the page that do not point to a file with DefaultDenyExtensions.
+type LinkOptions struct {
+	// Tags lists the elements to collect, keys of LinkSources. Default is a and area.
+	Tags []string
+	// Restrict limits extraction to elements inside the matching CSS selector.
+	Restrict string
+
+	// Allow keeps only urls matching at least one of the expressions.
+	Allow []*regexp.Regexp
+	// Deny drops urls matching any of the expressions.
+	Deny []*regexp.Regexp
+	// AllowDomains keeps only urls on these domains or their sub domains.
+	AllowDomains []string
+	// DenyDomains drops urls on these domains or their sub domains.
+	DenyDomains []string
+	// DenyExtensions drops urls whose path ends with one of these extensions.
+	// Set it to an empty non-nil slice to allow every extension.
+	DenyExtensions []string
+
+	// SkipNofollow drops links marked rel="nofollow".
+	SkipNofollow bool
+	// KeepFragment keeps the #fragment of urls, which is removed by default.
+	KeepFragment bool
+	// KeepDuplicates returns one request per link instead of one per url.
+	KeepDuplicates bool
+
+	// RespType is the response type of the returned requests, default "html".
+	RespType string
+	// UrlTag is the tag of the returned requests.
+	UrlTag string
+}
+
+// Anchor text and source element of extracted links are kept in Request.Meta under these keys.
+const (
+	MetaAnchorText = "anchor_text"
+	MetaLinkSource = "link_source"
+)
+
+// ExtractLinks collects links of the html page, resolves them against the final
+// response url and <base href>, normalises and filters them, and returns them as
+// GET requests whose Meta holds MetaAnchorText and MetaLinkSource.
+func (this *Page) ExtractLinks(opts *LinkOptions) []*request.Request {
+	if opts == nil {
+		opts = &LinkOptions{}
+	}
+	doc := this.docParser
+	if doc == nil {
+		return nil
+	}
+	base, err := url.Parse(this.GetFinalUrl())
+	if err != nil {
+		return nil
+	}
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if b, err := base.Parse(strings.TrimSpace(href)); err == nil {
+			base = b
+		}
+	}
+
+	tags := opts.Tags
+	if len(tags) == 0 {
+		tags = []string{"a", "area"}
+	}
+	respType := opts.RespType
+	if respType == "" {
+		respType = "html"
+	}
+	denyExt := opts.DenyExtensions
+	if denyExt == nil {
+		denyExt = DefaultDenyExtensions
+	}
+
+	scope := doc.Selection
+	if opts.Restrict != "" {
+		scope = doc.Find(opts.Restrict)
+	}
+
+	var reqs []*request.Request
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		attr, ok := LinkSources[tag]
+		if !ok {
+			continue
+		}
+		scope.Find(tag).Each(func(i int, s *goquery.Selection) {
+			raw, ok := s.Attr(attr)
+			if !ok {
+				return
+			}
+			if opts.SkipNofollow && hasToken(s.AttrOr("rel", ""), "nofollow") {
+				return
+			}
+			u := resolveLink(base, raw)
+			if u == nil {
+				return
+			}
+			fragment := u.Fragment
+			u = utils.NormalizeUrl(u)
+			if opts.KeepFragment {
+				u.Fragment = fragment
+			}
+			link := u.String()
+			if !opts.KeepDuplicates && seen[link] {
+				return
+			}
+			if !allowLink(u, link, opts, denyExt) {
+				return
+			}
+			seen[link] = true
+			text := strings.Join(strings.Fields(s.Text()), " ")
+			if text == "" {
+				text = strings.TrimSpace(s.AttrOr("alt", s.AttrOr("title", "")))
+			}
+			reqs = append(reqs, request.New(link).RespType(respType).Tag(opts.UrlTag).
+				Meta(MetaAnchorText, text).Meta(MetaLinkSource, tag).Build())
+		})
+	}
+	return reqs
+}
+
+// ExtractLinkUrls is like ExtractLinks but returns only the urls.
+func (this *Page) ExtractLinkUrls(opts *LinkOptions) []string {
+	var urls []string
+	for _, req := range this.ExtractLinks(opts) {
+		urls = append(urls, req.GetUrl())
+	}
+	return urls
+}
+
+// AddTargetLinks extracts links with opts and adds them as target requests.
+func (this *Page) AddTargetLinks(opts *LinkOptions) *Page {
+	return this.AddTargetRequestsWithParams(this.ExtractLinks(opts))
+}
+
+func resolveLink(base *url.URL, raw string) *url.URL {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.HasPrefix(raw, "#") {
+		return nil
+	}
+	u, err := base.Parse(raw)
+	if err != nil {
+		return nil
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		// javascript:, mailto:, data: and the like.
+		return nil
+	}
+	return u
+}
+
+func allowLink(u *url.URL, link string, opts *LinkOptions, denyExt []string) bool {
+	host := u.Hostname()
+	if len(opts.AllowDomains) > 0 && !matchDomain(host, opts.AllowDomains) {
+		return false
+	}
+	if matchDomain(host, opts.DenyDomains) {
+		return false
+	}
+	if ext := strings.TrimPrefix(strings.ToLower(path.Ext(u.Path)), "."); ext != "" {
+		for _, e := range denyExt {
+			if strings.TrimPrefix(strings.ToLower(e), ".") == ext {
+				return false
+			}
+		}
+	}
+	if len(opts.Allow) > 0 {
+		allowed := false
+		for _, re := range opts.Allow {
+			if re.MatchString(link) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	for _, re := range opts.Deny {
+		if re.MatchString(link) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchDomain reports whether host is one of domains or a sub domain of one.
+func matchDomain(host string, domains []string) bool {
+	host = strings.ToLower(host)
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(d, "."))
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
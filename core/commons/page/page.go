@@ -2,12 +2,15 @@
 package page
 
 import (
-	"log"
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/antchfx/xmlquery"
 	"github.com/bitly/go-simplejson"
+	"github.com/viixv/crawler/core/commons/feed"
+	"github.com/viixv/crawler/core/commons/jsonpath"
 	"github.com/viixv/crawler/core/commons/request"
 	"github.com/viixv/crawler/core/commons/result"
 )
@@ -25,8 +28,24 @@ type Page struct {
 	// 结果文本
 	body string
 
-	header  http.Header
-	cookies []*http.Cookie
+	statusCode int
+	header     http.Header
+	cookies    []*http.Cookie
+
+	// 重定向之后最终响应的URL。
+	finalUrl string
+
+	// The redirects is the redirect responses before the final one.
+	redirects []Redirect
+
+	// The truncated is set when the body was cut at Request.MaxBodyBytes.
+	truncated bool
+
+	// The change is the change state of the page in incremental mode.
+	change string
+
+	// The duplicateOf is the url of a page with nearly the same content, see neardup.
+	duplicateOf string
 
 	// The docParser is a pointer of goquery boject that contains html result.
 	docParser *goquery.Document
@@ -34,6 +53,12 @@ type Page struct {
 	// The jsonMap is the json result.
 	jsonMap *simplejson.Json
 
+	// The feed is the RSS or Atom result.
+	feed *feed.Feed
+
+	// The xmlDoc is the xml result.
+	xmlDoc *xmlquery.Node
+
 	// The pItems is object for save Key-Values in PageProcesser.
 	// And pItems is output in Pipline.
 	pItems *result.ResultItems
@@ -47,6 +72,17 @@ func NewPage(req *request.Request) *Page {
 	return &Page{pItems: result.NewResultItems(req), req: req}
 }
 
+// SetStatusCode save the status code of http responce
+func (this *Page) SetStatusCode(code int) *Page {
+	this.statusCode = code
+	return this
+}
+
+// GetStatusCode returns the status code of http responce, 0 if there was no responce.
+func (this *Page) GetStatusCode() int {
+	return this.statusCode
+}
+
 // SetHeader save the header of http responce
 func (this *Page) SetHeader(header http.Header) {
 	this.header = header
@@ -67,6 +103,79 @@ func (this *Page) GetCookies() []*http.Cookie {
 	return this.cookies
 }
 
+// SetFinalUrl saves the url of the final response after redirects.
+func (this *Page) SetFinalUrl(url string) *Page {
+	this.finalUrl = url
+	return this
+}
+
+// GetFinalUrl returns the url of the final response after redirects.
+// It falls back to the request url when no response has been recorded.
+func (this *Page) GetFinalUrl() string {
+	if this.finalUrl == "" && this.req != nil {
+		return this.req.GetUrl()
+	}
+	return this.finalUrl
+}
+
+// Redirect is a redirect response followed while downloading a page.
+type Redirect struct {
+	Url        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+}
+
+// SetRedirects saves the redirect responses followed, in order.
+func (this *Page) SetRedirects(redirects []Redirect) *Page {
+	this.redirects = redirects
+	return this
+}
+
+// GetRedirects returns the redirect responses followed before the final url,
+// the first one is the request url. It is empty when there was no redirect.
+func (this *Page) GetRedirects() []Redirect {
+	return this.redirects
+}
+
+// SetTruncated marks the body as cut at Request.MaxBodyBytes.
+func (this *Page) SetTruncated(truncated bool) *Page {
+	this.truncated = truncated
+	return this
+}
+
+// IsTruncated tells whether the body was cut at Request.MaxBodyBytes.
+func (this *Page) IsTruncated() bool {
+	return this.truncated
+}
+
+// Change states of a page compared with its last crawl, see incremental.Tracker.
+const (
+	ChangeNew       = "new"
+	ChangeChanged   = "changed"
+	ChangeUnchanged = "unchanged"
+)
+
+// SetChange sets the change state of the page.
+func (this *Page) SetChange(change string) *Page {
+	this.change = change
+	return this
+}
+
+// GetChange returns the change state of the page, "" when the crawl is not incremental.
+func (this *Page) GetChange() string {
+	return this.change
+}
+
+// SetDuplicateOf marks the page as a near duplicate of the page at url.
+func (this *Page) SetDuplicateOf(url string) *Page {
+	this.duplicateOf = url
+	return this
+}
+
+// GetDuplicateOf returns the url of the page this one nearly duplicates, "" when the content is unique.
+func (this *Page) GetDuplicateOf() string {
+	return this.duplicateOf
+}
+
 // IsSucc test whether download process success or not.
 func (this *Page) IsSucc() bool {
 	return !this.isFail
@@ -122,7 +231,7 @@ func (this *Page) GetUrlTag() string {
 
 // AddTargetRequest adds one new Request waitting for crawl.
 func (this *Page) AddTargetRequest(url string, respType string) *Page {
-	this.targetRequests = append(this.targetRequests, request.NewRequest(url, respType, "", "GET", "", nil, nil, nil, nil))
+	this.targetRequests = append(this.targetRequests, request.New(url).RespType(respType).Build())
 	return this
 }
 
@@ -136,8 +245,7 @@ func (this *Page) AddTargetRequests(urls []string, respType string) *Page {
 
 // AddTargetRequestWithProxy adds one new Request waitting for crawl.
 func (this *Page) AddTargetRequestWithProxy(url string, respType string, proxyHost string) *Page {
-
-	this.targetRequests = append(this.targetRequests, request.NewRequestWithProxy(url, respType, "", "GET", "", nil, nil, proxyHost, nil, nil))
+	this.targetRequests = append(this.targetRequests, request.New(url).RespType(respType).Proxy(proxyHost).Build())
 	return this
 }
 
@@ -150,7 +258,7 @@ func (this *Page) AddTargetRequestsWithProxy(urls []string, respType string, pro
 }
 
 // AddTargetRequest adds one new Request waitting for crawl.
-// The respType is "html" or "json" or "jsonp" or "text".
+// The respType is "html" or "json" or "jsonp" or "text" or "feed" or "xml".
 // The urltag is name for marking url and distinguish different urls in PageProcesser and Pipeline.
 // The method is POST or GET.
 // The postdata is http body string.
@@ -202,7 +310,6 @@ func (this *Page) ResetHtmlParser() *goquery.Document {
 	var err error
 	this.docParser, err = goquery.NewDocumentFromReader(r)
 	if err != nil {
-		log.Println(err.Error())
 		panic(err.Error())
 	}
 	return this.docParser
@@ -218,3 +325,13 @@ func (this *Page) SetJson(js *simplejson.Json) *Page {
 func (this *Page) GetJson() *simplejson.Json {
 	return this.jsonMap
 }
+
+// JsonQuery evaluates a JSONPath expression against the json result,
+// e.g. p.JsonQuery("$.data.list[?(@.price < 10)].title").Strings().
+// It works for both "json" and "jsonp" response types.
+func (this *Page) JsonQuery(path string) *jsonpath.Result {
+	if this.jsonMap == nil {
+		return jsonpath.NewResult(nil, errors.New("page has no json result"))
+	}
+	return jsonpath.Query(this.jsonMap.Interface(), path)
+}
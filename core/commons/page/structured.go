@@ -0,0 +1,20 @@
+package page
+
+import (
+	"github.com/viixv/crawler/core/commons/structured"
+)
+
+// StructuredData returns the schema.org items of an html page, embedded as
+// JSON-LD, microdata or RDFa. It is nil for other pages.
+func (this *Page) StructuredData() []*structured.Item {
+	if this.docParser == nil {
+		return nil
+	}
+	return structured.Parse(this.docParser, this.GetFinalUrl())
+}
+
+// StructuredDataOf returns the items of the page of one of the types, nested
+// ones included, e.g. StructuredDataOf("Product", "Offer").
+func (this *Page) StructuredDataOf(types ...string) []*structured.Item {
+	return structured.Filter(this.StructuredData(), types...)
+}
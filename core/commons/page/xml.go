@@ -0,0 +1,35 @@
+package page
+
+import (
+	"github.com/antchfx/xmlquery"
+	"github.com/viixv/crawler/core/commons/xmldoc"
+)
+
+// SetXml saves the xml result.
+func (this *Page) SetXml(doc *xmlquery.Node) *Page {
+	this.xmlDoc = doc
+	return this
+}
+
+// GetXml returns the xml result, nil when the response type is not "xml".
+func (this *Page) GetXml() *xmlquery.Node {
+	return this.xmlDoc
+}
+
+// XmlQuery evaluates an XPath expression against the xml result,
+// e.g. p.XmlQuery("//url/loc").Strings().
+func (this *Page) XmlQuery(expr string) *xmldoc.Result {
+	return xmldoc.Query(this.xmlDoc, expr, nil)
+}
+
+// XmlQueryNS is XmlQuery with the prefixes of the expression bound to
+// namespaces, so that documents using other prefixes match as well.
+func (this *Page) XmlQueryNS(expr string, ns map[string]string) *xmldoc.Result {
+	return xmldoc.Query(this.xmlDoc, expr, ns)
+}
+
+// XmlSelect evaluates a CSS like selector against the xml result,
+// e.g. p.XmlSelect("soap|Body > GetPriceResponse > Price").String().
+func (this *Page) XmlSelect(selector string) *xmldoc.Result {
+	return xmldoc.Select(this.xmlDoc, selector, nil)
+}
@@ -0,0 +1,320 @@
+// Package redis is a minimal client for servers speaking the Redis protocol
+// (RESP), and an in-process stand-in server implementing the commands the
+// crawler uses.
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNil is returned by the helpers for nil replies.
+var ErrNil = errors.New("redis: nil reply")
+
+// Error is an error reply of the server.
+type Error string
+
+func (this Error) Error() string {
+	return string(this)
+}
+
+// Client sends commands over a small pool of connections. It is safe for concurrent use.
+type Client struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+
+	mutex sync.Mutex
+	idle  []*conn
+	max   int
+}
+
+type conn struct {
+	c  net.Conn
+	br *bufio.Reader
+	bw *bufio.Writer
+}
+
+// NewClient creates a client of the server at addr, e.g. "127.0.0.1:6379".
+// Connections are opened on first use.
+func NewClient(addr string) *Client {
+	return &Client{addr: addr, timeout: 10 * time.Second, max: 8}
+}
+
+// SetPassword makes new connections send AUTH.
+func (this *Client) SetPassword(password string) *Client {
+	this.password = password
+	return this
+}
+
+// SetDB makes new connections SELECT the database.
+func (this *Client) SetDB(db int) *Client {
+	this.db = db
+	return this
+}
+
+// SetTimeout sets the dial, read and write timeout. Default 10s.
+func (this *Client) SetTimeout(d time.Duration) *Client {
+	this.timeout = d
+	return this
+}
+
+// Do sends a command and returns its reply: string for simple and bulk
+// strings, nil for nil replies, int64 for integers, []interface{} for arrays
+// and Error for error replies.
+func (this *Client) Do(args ...interface{}) (interface{}, error) {
+	cn, err := this.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := cn.do(this.timeout, args...)
+	if _, ok := err.(Error); err != nil && !ok {
+		// The connection is in an unknown state.
+		cn.c.Close()
+		return nil, err
+	}
+	this.put(cn)
+	return reply, err
+}
+
+// Multi sends the commands in a MULTI/EXEC transaction, the server runs them
+// at once, and returns their replies. A command the server refuses discards
+// the whole transaction and its error is returned.
+func (this *Client) Multi(cmds ...[]interface{}) ([]interface{}, error) {
+	cn, err := this.get()
+	if err != nil {
+		return nil, err
+	}
+	replies, err := cn.multi(this.timeout, cmds)
+	if _, ok := err.(Error); err != nil && !ok {
+		cn.c.Close()
+		return nil, err
+	}
+	this.put(cn)
+	return replies, err
+}
+
+// Close closes the idle connections.
+func (this *Client) Close() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for _, cn := range this.idle {
+		cn.c.Close()
+	}
+	this.idle = nil
+	return nil
+}
+
+func (this *Client) get() (*conn, error) {
+	this.mutex.Lock()
+	if n := len(this.idle); n > 0 {
+		cn := this.idle[n-1]
+		this.idle = this.idle[:n-1]
+		this.mutex.Unlock()
+		return cn, nil
+	}
+	this.mutex.Unlock()
+
+	c, err := net.DialTimeout("tcp", this.addr, this.timeout)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{c: c, br: bufio.NewReader(c), bw: bufio.NewWriter(c)}
+	if this.password != "" {
+		if _, err := cn.do(this.timeout, "AUTH", this.password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if this.db != 0 {
+		if _, err := cn.do(this.timeout, "SELECT", this.db); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+func (this *Client) put(cn *conn) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if len(this.idle) >= this.max {
+		cn.c.Close()
+		return
+	}
+	this.idle = append(this.idle, cn)
+}
+
+func (this *conn) do(timeout time.Duration, args ...interface{}) (interface{}, error) {
+	this.c.SetDeadline(time.Now().Add(timeout))
+	if err := writeCommand(this.bw, args); err != nil {
+		return nil, err
+	}
+	if err := this.bw.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(this.br)
+}
+
+func (this *conn) multi(timeout time.Duration, cmds [][]interface{}) ([]interface{}, error) {
+	if _, err := this.do(timeout, "MULTI"); err != nil {
+		return nil, err
+	}
+	for _, args := range cmds {
+		if _, err := this.do(timeout, args...); err != nil {
+			if _, ok := err.(Error); ok {
+				if _, derr := this.do(timeout, "DISCARD"); derr != nil {
+					return nil, derr
+				}
+			}
+			return nil, err
+		}
+	}
+	reply, err := this.do(timeout, "EXEC")
+	if err != nil {
+		return nil, err
+	}
+	replies, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %T for EXEC", reply)
+	}
+	return replies, nil
+}
+
+func writeCommand(w *bufio.Writer, args []interface{}) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var s string
+		switch v := arg.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		case int:
+			s = strconv.Itoa(v)
+		case int64:
+			s = strconv.FormatInt(v, 10)
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			s = fmt.Sprint(v)
+		}
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+	}
+	return nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				if _, ok := err.(Error); !ok {
+					return nil, err
+				}
+				items[i] = err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply %q", line)
+}
+
+// Int64 converts an integer reply.
+func Int64(reply interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	switch v := reply.(type) {
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case nil:
+		return 0, ErrNil
+	}
+	return 0, fmt.Errorf("redis: unexpected reply %T for an integer", reply)
+}
+
+// String converts a string reply.
+func String(reply interface{}, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	switch v := reply.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case nil:
+		return "", ErrNil
+	}
+	return "", fmt.Errorf("redis: unexpected reply %T for a string", reply)
+}
+
+// Strings converts an array reply, nil elements become empty strings.
+func Strings(reply interface{}, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok {
+		if reply == nil {
+			return nil, ErrNil
+		}
+		return nil, fmt.Errorf("redis: unexpected reply %T for an array", reply)
+	}
+	strs := make([]string, len(items))
+	for i, item := range items {
+		if s, ok := item.(string); ok {
+			strs[i] = s
+		}
+	}
+	return strs, nil
+}
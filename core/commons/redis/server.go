@@ -0,0 +1,734 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server is an in-process stand-in for a Redis server. It keeps strings,
+// lists, sets and sorted sets in memory and implements the commands used by
+// the crawler, each of them atomically. It is meant for examples and local
+// runs, not as a replacement for Redis.
+type Server struct {
+	mutex    sync.Mutex
+	strs     map[string]string
+	lists    map[string][]string
+	sets     map[string]map[string]bool
+	zsets    map[string]map[string]float64
+	password string
+
+	ln    net.Listener
+	conns map[net.Conn]bool
+	wg    sync.WaitGroup
+}
+
+func NewServer() *Server {
+	this := &Server{conns: make(map[net.Conn]bool)}
+	this.flush()
+	return this
+}
+
+// SetPassword makes the server require AUTH.
+func (this *Server) SetPassword(password string) *Server {
+	this.password = password
+	return this
+}
+
+// Start listens on addr, e.g. "127.0.0.1:0", and returns the address listened on.
+func (this *Server) Start(addr string) (string, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	this.ln = ln
+	this.wg.Add(1)
+	go func() {
+		defer this.wg.Done()
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			this.mutex.Lock()
+			this.conns[c] = true
+			this.mutex.Unlock()
+			this.wg.Add(1)
+			go this.serve(c)
+		}
+	}()
+	return ln.Addr().String(), nil
+}
+
+// Close stops listening and closes the open connections.
+func (this *Server) Close() error {
+	if this.ln == nil {
+		return nil
+	}
+	err := this.ln.Close()
+	this.mutex.Lock()
+	for c := range this.conns {
+		c.Close()
+	}
+	this.mutex.Unlock()
+	this.wg.Wait()
+	return err
+}
+
+func (this *Server) flush() {
+	this.strs = make(map[string]string)
+	this.lists = make(map[string][]string)
+	this.sets = make(map[string]map[string]bool)
+	this.zsets = make(map[string]map[string]float64)
+}
+
+func (this *Server) serve(c net.Conn) {
+	defer this.wg.Done()
+	defer func() {
+		c.Close()
+		this.mutex.Lock()
+		delete(this.conns, c)
+		this.mutex.Unlock()
+	}()
+	br := bufio.NewReader(c)
+	bw := bufio.NewWriter(c)
+	authed := this.password == ""
+	// queued holds the commands of a MULTI until EXEC, nil outside of one.
+	var queued [][]string
+	aborted := false
+	for {
+		args, err := readCommand(br)
+		if err != nil {
+			if err != io.EOF {
+				writeReply(bw, Error("ERR "+err.Error()))
+				bw.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		name := strings.ToUpper(args[0])
+		var reply interface{}
+		switch {
+		case name == "AUTH":
+			if len(args) == 2 && args[1] == this.password {
+				authed = true
+				reply = "OK"
+			} else {
+				reply = Error("WRONGPASS invalid password")
+			}
+		case !authed:
+			reply = Error("NOAUTH Authentication required.")
+		case name == "QUIT":
+			writeReply(bw, "OK")
+			bw.Flush()
+			return
+		case name == "MULTI":
+			if queued != nil {
+				reply = Error("ERR MULTI calls can not be nested")
+			} else {
+				queued, aborted = [][]string{}, false
+				reply = "OK"
+			}
+		case name == "EXEC" || name == "DISCARD":
+			if queued == nil {
+				reply = Error("ERR " + name + " without MULTI")
+			} else if name == "DISCARD" {
+				reply = "OK"
+			} else if aborted {
+				reply = Error("EXECABORT Transaction discarded because of previous errors.")
+			} else {
+				reply = this.ExecMulti(queued...)
+			}
+			queued = nil
+		case queued != nil:
+			if reply = checkCommand(args); reply != nil {
+				aborted = true
+			} else {
+				queued = append(queued, args)
+				reply = "QUEUED"
+			}
+		default:
+			reply = this.Exec(args...)
+		}
+		writeReply(bw, reply)
+		if err := bw.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Exec runs one command, as sent by a client, and returns its reply.
+func (this *Server) Exec(args ...string) interface{} {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.exec(args)
+}
+
+// ExecMulti runs the commands of a transaction at once and returns their replies.
+func (this *Server) ExecMulti(cmds ...[]string) []interface{} {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	replies := make([]interface{}, len(cmds))
+	for i, args := range cmds {
+		replies[i] = this.exec(args)
+	}
+	return replies
+}
+
+func (this *Server) exec(args []string) interface{} {
+	if reply := checkCommand(args); reply != nil {
+		return reply
+	}
+	return serverCommands[strings.ToUpper(args[0])].f(this, args[1:])
+}
+
+// checkCommand returns the error reply of an unknown command or of wrong arguments.
+func checkCommand(args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	cmd, ok := serverCommands[name]
+	if !ok {
+		return Error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+	if len(args)-1 < cmd.min || (cmd.max >= 0 && len(args)-1 > cmd.max) {
+		return Error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+	}
+	return nil
+}
+
+type serverCommand struct {
+	min, max int
+	f        func(s *Server, args []string) interface{}
+}
+
+var errWrongType = Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+var serverCommands map[string]*serverCommand
+
+func init() {
+	serverCommands = map[string]*serverCommand{
+		"PING":          {0, 1, (*Server).ping},
+		"ECHO":          {1, 1, func(s *Server, a []string) interface{} { return a[0] }},
+		"SELECT":        {1, 1, func(s *Server, a []string) interface{} { return "OK" }},
+		"FLUSHALL":      {0, 1, func(s *Server, a []string) interface{} { s.flush(); return "OK" }},
+		"FLUSHDB":       {0, 1, func(s *Server, a []string) interface{} { s.flush(); return "OK" }},
+		"DEL":           {1, -1, (*Server).del},
+		"EXISTS":        {1, -1, (*Server).exists},
+		"GET":           {1, 1, (*Server).get},
+		"SET":           {2, 2, (*Server).set},
+		"INCR":          {1, 1, (*Server).incr},
+		"LPUSH":         {2, -1, (*Server).lpush},
+		"RPUSH":         {2, -1, (*Server).rpush},
+		"LPOP":          {1, 1, (*Server).lpop},
+		"RPOP":          {1, 1, (*Server).rpop},
+		"RPOPLPUSH":     {2, 2, (*Server).rpoplpush},
+		"LLEN":          {1, 1, (*Server).llen},
+		"LRANGE":        {3, 3, (*Server).lrange},
+		"LREM":          {3, 3, (*Server).lrem},
+		"SADD":          {2, -1, (*Server).sadd},
+		"SREM":          {2, -1, (*Server).srem},
+		"SISMEMBER":     {2, 2, (*Server).sismember},
+		"SCARD":         {1, 1, (*Server).scard},
+		"ZADD":          {3, -1, (*Server).zadd},
+		"ZREM":          {2, -1, (*Server).zrem},
+		"ZSCORE":        {2, 2, (*Server).zscore},
+		"ZCARD":         {1, 1, (*Server).zcard},
+		"ZRANGEBYSCORE": {3, 6, (*Server).zrangebyscore},
+	}
+}
+
+// kind returns the type of the value at key, "" when there is none.
+func (this *Server) kind(key string) string {
+	if _, ok := this.strs[key]; ok {
+		return "string"
+	}
+	if _, ok := this.lists[key]; ok {
+		return "list"
+	}
+	if _, ok := this.sets[key]; ok {
+		return "set"
+	}
+	if _, ok := this.zsets[key]; ok {
+		return "zset"
+	}
+	return ""
+}
+
+func (this *Server) check(key string, kind string) bool {
+	k := this.kind(key)
+	return k == "" || k == kind
+}
+
+func (this *Server) ping(a []string) interface{} {
+	if len(a) == 1 {
+		return a[0]
+	}
+	return "PONG"
+}
+
+func (this *Server) del(a []string) interface{} {
+	n := int64(0)
+	for _, key := range a {
+		if this.kind(key) != "" {
+			n++
+		}
+		delete(this.strs, key)
+		delete(this.lists, key)
+		delete(this.sets, key)
+		delete(this.zsets, key)
+	}
+	return n
+}
+
+func (this *Server) exists(a []string) interface{} {
+	n := int64(0)
+	for _, key := range a {
+		if this.kind(key) != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func (this *Server) get(a []string) interface{} {
+	if !this.check(a[0], "string") {
+		return errWrongType
+	}
+	if v, ok := this.strs[a[0]]; ok {
+		return v
+	}
+	return nil
+}
+
+func (this *Server) set(a []string) interface{} {
+	this.del(a[:1])
+	this.strs[a[0]] = a[1]
+	return "OK"
+}
+
+func (this *Server) incr(a []string) interface{} {
+	if !this.check(a[0], "string") {
+		return errWrongType
+	}
+	n := int64(0)
+	if v, ok := this.strs[a[0]]; ok {
+		var err error
+		if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return Error("ERR value is not an integer or out of range")
+		}
+	}
+	n++
+	this.strs[a[0]] = strconv.FormatInt(n, 10)
+	return n
+}
+
+func (this *Server) lpush(a []string) interface{} {
+	if !this.check(a[0], "list") {
+		return errWrongType
+	}
+	l := this.lists[a[0]]
+	for _, v := range a[1:] {
+		l = append([]string{v}, l...)
+	}
+	this.lists[a[0]] = l
+	return int64(len(l))
+}
+
+func (this *Server) rpush(a []string) interface{} {
+	if !this.check(a[0], "list") {
+		return errWrongType
+	}
+	this.lists[a[0]] = append(this.lists[a[0]], a[1:]...)
+	return int64(len(this.lists[a[0]]))
+}
+
+func (this *Server) setList(key string, l []string) {
+	if len(l) == 0 {
+		delete(this.lists, key)
+		return
+	}
+	this.lists[key] = l
+}
+
+func (this *Server) lpop(a []string) interface{} {
+	if !this.check(a[0], "list") {
+		return errWrongType
+	}
+	l := this.lists[a[0]]
+	if len(l) == 0 {
+		return nil
+	}
+	this.setList(a[0], l[1:])
+	return l[0]
+}
+
+func (this *Server) rpop(a []string) interface{} {
+	if !this.check(a[0], "list") {
+		return errWrongType
+	}
+	l := this.lists[a[0]]
+	if len(l) == 0 {
+		return nil
+	}
+	this.setList(a[0], l[:len(l)-1])
+	return l[len(l)-1]
+}
+
+func (this *Server) rpoplpush(a []string) interface{} {
+	if !this.check(a[0], "list") || !this.check(a[1], "list") {
+		return errWrongType
+	}
+	v := this.rpop(a[:1])
+	if v == nil {
+		return nil
+	}
+	this.lpush([]string{a[1], v.(string)})
+	return v
+}
+
+func (this *Server) llen(a []string) interface{} {
+	if !this.check(a[0], "list") {
+		return errWrongType
+	}
+	return int64(len(this.lists[a[0]]))
+}
+
+// span converts redis start and stop indexes, which may be negative, to a slice range.
+func span(start, stop string, n int) (int, int, error) {
+	i, err1 := strconv.Atoi(start)
+	j, err2 := strconv.Atoi(stop)
+	if err1 != nil || err2 != nil {
+		return 0, 0, errors.New("value is not an integer or out of range")
+	}
+	if i < 0 {
+		i += n
+	}
+	if j < 0 {
+		j += n
+	}
+	if i < 0 {
+		i = 0
+	}
+	if j >= n {
+		j = n - 1
+	}
+	if i > j {
+		return 0, 0, nil
+	}
+	return i, j + 1, nil
+}
+
+func (this *Server) lrange(a []string) interface{} {
+	if !this.check(a[0], "list") {
+		return errWrongType
+	}
+	l := this.lists[a[0]]
+	i, j, err := span(a[1], a[2], len(l))
+	if err != nil {
+		return Error("ERR " + err.Error())
+	}
+	items := make([]interface{}, 0, j-i)
+	for _, v := range l[i:j] {
+		items = append(items, v)
+	}
+	return items
+}
+
+func (this *Server) lrem(a []string) interface{} {
+	if !this.check(a[0], "list") {
+		return errWrongType
+	}
+	count, err := strconv.Atoi(a[1])
+	if err != nil {
+		return Error("ERR value is not an integer or out of range")
+	}
+	l := this.lists[a[0]]
+	removed := 0
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	keep := make([]string, 0, len(l))
+	if count >= 0 {
+		for _, v := range l {
+			if v == a[2] && (limit == 0 || removed < limit) {
+				removed++
+				continue
+			}
+			keep = append(keep, v)
+		}
+	} else {
+		for i := len(l) - 1; i >= 0; i-- {
+			if l[i] == a[2] && removed < limit {
+				removed++
+				continue
+			}
+			keep = append([]string{l[i]}, keep...)
+		}
+	}
+	this.setList(a[0], keep)
+	return int64(removed)
+}
+
+func (this *Server) sadd(a []string) interface{} {
+	if !this.check(a[0], "set") {
+		return errWrongType
+	}
+	s, ok := this.sets[a[0]]
+	if !ok {
+		s = make(map[string]bool)
+		this.sets[a[0]] = s
+	}
+	n := int64(0)
+	for _, v := range a[1:] {
+		if !s[v] {
+			s[v] = true
+			n++
+		}
+	}
+	return n
+}
+
+func (this *Server) srem(a []string) interface{} {
+	if !this.check(a[0], "set") {
+		return errWrongType
+	}
+	s := this.sets[a[0]]
+	n := int64(0)
+	for _, v := range a[1:] {
+		if s[v] {
+			delete(s, v)
+			n++
+		}
+	}
+	if len(s) == 0 {
+		delete(this.sets, a[0])
+	}
+	return n
+}
+
+func (this *Server) sismember(a []string) interface{} {
+	if !this.check(a[0], "set") {
+		return errWrongType
+	}
+	if this.sets[a[0]][a[1]] {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func (this *Server) scard(a []string) interface{} {
+	if !this.check(a[0], "set") {
+		return errWrongType
+	}
+	return int64(len(this.sets[a[0]]))
+}
+
+func (this *Server) zadd(a []string) interface{} {
+	if !this.check(a[0], "zset") {
+		return errWrongType
+	}
+	if len(a[1:])%2 != 0 {
+		return Error("ERR syntax error")
+	}
+	z, ok := this.zsets[a[0]]
+	if !ok {
+		z = make(map[string]float64)
+	}
+	n := int64(0)
+	for i := 1; i < len(a); i += 2 {
+		score, err := strconv.ParseFloat(a[i], 64)
+		if err != nil {
+			return Error("ERR value is not a valid float")
+		}
+		if _, ok := z[a[i+1]]; !ok {
+			n++
+		}
+		z[a[i+1]] = score
+	}
+	this.zsets[a[0]] = z
+	return n
+}
+
+func (this *Server) zrem(a []string) interface{} {
+	if !this.check(a[0], "zset") {
+		return errWrongType
+	}
+	z := this.zsets[a[0]]
+	n := int64(0)
+	for _, v := range a[1:] {
+		if _, ok := z[v]; ok {
+			delete(z, v)
+			n++
+		}
+	}
+	if len(z) == 0 {
+		delete(this.zsets, a[0])
+	}
+	return n
+}
+
+func (this *Server) zscore(a []string) interface{} {
+	if !this.check(a[0], "zset") {
+		return errWrongType
+	}
+	if score, ok := this.zsets[a[0]][a[1]]; ok {
+		return strconv.FormatFloat(score, 'f', -1, 64)
+	}
+	return nil
+}
+
+func (this *Server) zcard(a []string) interface{} {
+	if !this.check(a[0], "zset") {
+		return errWrongType
+	}
+	return int64(len(this.zsets[a[0]]))
+}
+
+// parseBound parses a ZRANGEBYSCORE bound: a number, -inf, +inf or (number for exclusive.
+func parseBound(s string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+	switch strings.ToLower(s) {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, exclusive, err
+}
+
+func (this *Server) zrangebyscore(a []string) interface{} {
+	if !this.check(a[0], "zset") {
+		return errWrongType
+	}
+	min, minEx, err1 := parseBound(a[1])
+	max, maxEx, err2 := parseBound(a[2])
+	if err1 != nil || err2 != nil {
+		return Error("ERR min or max is not a float")
+	}
+	offset, count := 0, -1
+	if len(a) > 3 {
+		if len(a) != 6 || strings.ToUpper(a[3]) != "LIMIT" {
+			return Error("ERR syntax error")
+		}
+		var err error
+		if offset, err = strconv.Atoi(a[4]); err != nil {
+			return Error("ERR value is not an integer or out of range")
+		}
+		if count, err = strconv.Atoi(a[5]); err != nil {
+			return Error("ERR value is not an integer or out of range")
+		}
+	}
+
+	type member struct {
+		v     string
+		score float64
+	}
+	var members []member
+	for v, score := range this.zsets[a[0]] {
+		if score < min || (minEx && score == min) || score > max || (maxEx && score == max) {
+			continue
+		}
+		members = append(members, member{v, score})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].score != members[j].score {
+			return members[i].score < members[j].score
+		}
+		return members[i].v < members[j].v
+	})
+	items := make([]interface{}, 0)
+	for i, m := range members {
+		if i < offset {
+			continue
+		}
+		if count >= 0 && len(items) >= count {
+			break
+		}
+		items = append(items, m.v)
+	}
+	return items
+}
+
+// Limits of a command, as in Redis, so that one client cannot use up the memory.
+const (
+	maxArgs     = 1024 * 1024
+	maxBulkSize = 512 * 1024 * 1024
+)
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		// Inline command, as typed in telnet.
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > maxArgs {
+		return nil, errors.New("Protocol error: invalid multibulk length")
+	}
+	// The count is not trusted for the allocation, the args have to arrive first.
+	capacity := n
+	if capacity > 16 {
+		capacity = 16
+	}
+	args := make([]string, 0, capacity)
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("Protocol error: expected '$', got %q", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkSize {
+			return nil, errors.New("Protocol error: invalid bulk length")
+		}
+		var b strings.Builder
+		if _, err := io.CopyN(&b, r, int64(size)); err != nil {
+			return nil, err
+		}
+		if end, err := readLine(r); err != nil || end != "" {
+			return nil, errors.New("Protocol error: bulk is not terminated by CRLF")
+		}
+		args = append(args, b.String())
+	}
+	return args, nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case Error:
+		w.WriteString("-" + string(v) + "\r\n")
+	case int64:
+		w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case string:
+		if v == "OK" || v == "PONG" || v == "QUEUED" {
+			w.WriteString("+" + v + "\r\n")
+			return
+		}
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	default:
+		w.WriteString("-ERR unsupported reply\r\n")
+	}
+}
@@ -0,0 +1,138 @@
+package redis
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCommand(t *testing.T) {
+	cases := []struct {
+		in   string
+		args []string
+	}{
+		{"*2\r\n$3\r\nGET\r\n$1\r\nk\r\n", []string{"GET", "k"}},
+		{"*1\r\n$0\r\n\r\n", []string{""}},
+		{"*0\r\n", []string{}},
+		{"PING hello\r\n", []string{"PING", "hello"}},
+		{"*1\r\n$4\r\na\r\nb\r\n", []string{"a\r\nb"}},
+	}
+	for _, c := range cases {
+		args, err := readCommand(bufio.NewReader(strings.NewReader(c.in)))
+		if err != nil {
+			t.Errorf("readCommand(%q) failed: %v", c.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, c.args) {
+			t.Errorf("readCommand(%q) = %q, want %q", c.in, args, c.args)
+		}
+	}
+}
+
+func TestReadCommandMalformed(t *testing.T) {
+	for _, in := range []string{
+		"*-1\r\n",
+		"*x\r\n",
+		"*2000000\r\n",
+		"*99999999999999999999\r\n",
+		"*1\r\n$-1\r\n",
+		"*1\r\n$999999999999\r\n",
+		"*1\r\n+GET\r\n",
+		"*1\r\n$3\r\nGETX\r\n",
+		"*1\r\n$3\r\nGE",
+		"*2\r\n$3\r\nGET\r\n",
+	} {
+		if args, err := readCommand(bufio.NewReader(strings.NewReader(in))); err == nil {
+			t.Errorf("readCommand(%q) = %q, want an error", in, args)
+		}
+	}
+}
+
+func TestServerSurvivesMalformedInput(t *testing.T) {
+	s := NewServer()
+	addr, err := s.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, in := range []string{"*-1\r\n", "*1\r\n$-5\r\n", "*1\r\n$9999999999\r\n"} {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+		c.Write([]byte(in))
+		line, err := bufio.NewReader(c).ReadString('\n')
+		c.Close()
+		if err != nil || !strings.HasPrefix(line, "-ERR Protocol error") {
+			t.Errorf("reply to %q = %q, %v, want a protocol error", in, line, err)
+		}
+	}
+
+	client := NewClient(addr).SetTimeout(5 * time.Second)
+	defer client.Close()
+	if reply, err := client.Do("PING"); err != nil || reply != "PONG" {
+		t.Fatalf("PING after malformed input = %v, %v", reply, err)
+	}
+}
+
+func TestServerCommands(t *testing.T) {
+	s := NewServer()
+	cases := []struct {
+		args  []string
+		reply interface{}
+	}{
+		{[]string{"SET", "k", "v"}, "OK"},
+		{[]string{"GET", "k"}, "v"},
+		{[]string{"LPUSH", "k", "x"}, errWrongType},
+		{[]string{"INCR", "n"}, int64(1)},
+		{[]string{"RPUSH", "l", "a", "b"}, int64(2)},
+		{[]string{"RPOPLPUSH", "l", "m"}, "b"},
+		{[]string{"LRANGE", "m", "0", "-1"}, []interface{}{"b"}},
+		{[]string{"SADD", "s", "a", "a"}, int64(1)},
+		{[]string{"SISMEMBER", "s", "a"}, int64(1)},
+		{[]string{"ZADD", "z", "2", "b", "1", "a"}, int64(2)},
+		{[]string{"ZRANGEBYSCORE", "z", "-inf", "1"}, []interface{}{"a"}},
+		{[]string{"ZRANGEBYSCORE", "z", "(1", "+inf", "LIMIT", "0", "1"}, []interface{}{"b"}},
+		{[]string{"DEL", "k", "l", "m", "missing"}, int64(3)},
+		{[]string{"GET", "k"}, nil},
+		{[]string{"NOPE"}, Error("ERR unknown command 'NOPE'")},
+	}
+	for _, c := range cases {
+		if reply := s.Exec(c.args...); !reflect.DeepEqual(reply, c.reply) {
+			t.Errorf("%q = %#v, want %#v", c.args, reply, c.reply)
+		}
+	}
+}
+
+func TestMulti(t *testing.T) {
+	s := NewServer()
+	addr, err := s.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := NewClient(addr).SetTimeout(5 * time.Second)
+	defer client.Close()
+
+	replies, err := client.Multi([]interface{}{"RPUSH", "l", "a", "b"}, []interface{}{"LREM", "l", 1, "a"}, []interface{}{"GET", "k"})
+	if want := []interface{}{int64(2), int64(1), nil}; err != nil || !reflect.DeepEqual(replies, want) {
+		t.Fatalf("Multi = %#v, %v, want %#v", replies, err, want)
+	}
+	// A refused command discards the transaction.
+	if _, err := client.Multi([]interface{}{"RPUSH", "l", "c"}, []interface{}{"NOPE"}); err == nil {
+		t.Fatal("Multi with an unknown command succeeded")
+	}
+	if n, err := Int64(client.Do("LLEN", "l")); err != nil || n != 1 {
+		t.Fatalf("LLEN = %d, %v, want 1, the discarded RPUSH must not run", n, err)
+	}
+	for _, cmd := range []string{"EXEC", "DISCARD"} {
+		if _, err := client.Do(cmd); err == nil {
+			t.Errorf("%s without MULTI succeeded", cmd)
+		}
+	}
+}
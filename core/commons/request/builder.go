@@ -0,0 +1,181 @@
+package request
+
+import (
+	"net/http"
+	"time"
+)
+
+// Builder builds a Request step by step:
+//
+//	req := request.New("https://example.com/search").
+//		Post("q=go").
+//		Header("Content-Type", "application/x-www-form-urlencoded").
+//		Tag("search").
+//		Meta("page", "1").
+//		Build()
+type Builder struct {
+	req Request
+}
+
+// New starts a GET request of url expecting html.
+func New(url string) *Builder {
+	return &Builder{req: Request{Url: url, RespType: "html", Method: "GET"}}
+}
+
+// Method sets the http method.
+func (this *Builder) Method(method string) *Builder {
+	this.req.Method = method
+	return this
+}
+
+// Get makes it a GET request without body.
+func (this *Builder) Get() *Builder {
+	this.req.Method = "GET"
+	this.req.PostData = ""
+	return this
+}
+
+// Post makes it a POST request with body.
+func (this *Builder) Post(body string) *Builder {
+	this.req.Method = "POST"
+	this.req.PostData = body
+	return this
+}
+
+// RespType sets how the response is parsed: html, json, jsonp or text.
+func (this *Builder) RespType(respType string) *Builder {
+	this.req.RespType = respType
+	return this
+}
+
+// Json expects a json response.
+func (this *Builder) Json() *Builder {
+	return this.RespType("json")
+}
+
+// Tag sets the UrlTag.
+func (this *Builder) Tag(tag string) *Builder {
+	this.req.UrlTag = tag
+	return this
+}
+
+// Header adds a header value.
+func (this *Builder) Header(key string, value string) *Builder {
+	if this.req.Header == nil {
+		this.req.Header = http.Header{}
+	}
+	this.req.Header.Add(key, value)
+	return this
+}
+
+// Headers adds every value of header.
+func (this *Builder) Headers(header http.Header) *Builder {
+	for k, vs := range header {
+		for _, v := range vs {
+			this.Header(k, v)
+		}
+	}
+	return this
+}
+
+// Cookie adds a cookie.
+func (this *Builder) Cookie(c *http.Cookie) *Builder {
+	this.req.Cookies = append(this.req.Cookies, c)
+	return this
+}
+
+// Proxy sends the request through the proxy, e.g. "http://127.0.0.1:8080".
+func (this *Builder) Proxy(host string) *Builder {
+	this.req.ProxyHost = host
+	return this
+}
+
+// Meta sets a value carried along with the request.
+func (this *Builder) Meta(key string, value string) *Builder {
+	if this.req.Meta == nil {
+		this.req.Meta = make(map[string]string)
+	}
+	this.req.Meta[key] = value
+	return this
+}
+
+// Redirect sets the redirect policy.
+func (this *Builder) Redirect(policy *RedirectPolicy) *Builder {
+	this.req.Redirect = policy
+	return this
+}
+
+// MaxRedirects limits the redirects followed, 0 follows none.
+func (this *Builder) MaxRedirects(n int) *Builder {
+	p := this.policy()
+	if n == 0 {
+		n = NoRedirects
+	}
+	p.MaxRedirects = n
+	return this
+}
+
+// SameHost follows only redirects to the host of the request.
+func (this *Builder) SameHost() *Builder {
+	this.policy().SameHost = true
+	return this
+}
+
+// Timeout bounds the whole download including reading the body.
+func (this *Builder) Timeout(d time.Duration) *Builder {
+	this.req.Timeout = d
+	return this
+}
+
+// MaxBodyBytes bounds the response body, mode is BodyTruncate or BodyFail.
+func (this *Builder) MaxBodyBytes(n int64, mode string) *Builder {
+	this.req.MaxBodyBytes = n
+	this.req.BodyLimit = mode
+	return this
+}
+
+// NotBefore delays the download until t, the zero time downloads it now.
+func (this *Builder) NotBefore(t time.Time) *Builder {
+	if t.IsZero() {
+		this.req.NotBefore = nil
+	} else {
+		this.req.NotBefore = &t
+	}
+	return this
+}
+
+// After delays the download by d from now.
+func (this *Builder) After(d time.Duration) *Builder {
+	return this.NotBefore(time.Now().Add(d))
+}
+
+func (this *Builder) policy() *RedirectPolicy {
+	if this.req.Redirect == nil {
+		this.req.Redirect = &RedirectPolicy{}
+	}
+	return this.req.Redirect
+}
+
+// Build returns the request. The builder may be used again, later changes do
+// not affect requests already built.
+func (this *Builder) Build() *Request {
+	req := this.req
+	if req.Header != nil {
+		req.Header = req.Header.Clone()
+	}
+	if req.Cookies != nil {
+		req.Cookies = append([]*http.Cookie(nil), req.Cookies...)
+	}
+	if req.Meta != nil {
+		meta := make(map[string]string, len(req.Meta))
+		for k, v := range req.Meta {
+			meta[k] = v
+		}
+		req.Meta = meta
+	}
+	if req.Redirect != nil {
+		policy := *req.Redirect
+		req.Redirect = &policy
+	}
+	return &req
+}
@@ -0,0 +1,38 @@
+package request
+
+import (
+	"time"
+)
+
+// Modes of Request.BodyLimit, what happens to a response body larger than MaxBodyBytes.
+const (
+	// BodyTruncate keeps the first MaxBodyBytes bytes and marks the page truncated.
+	BodyTruncate = "truncate"
+	// BodyFail fails the download.
+	BodyFail = "fail"
+)
+
+// Limits are defaults for the requests that do not set their own, see Crawler.SetRequestLimits.
+type Limits struct {
+	Timeout      time.Duration
+	MaxBodyBytes int64
+	BodyLimit    string
+	Redirect     *RedirectPolicy
+}
+
+// Apply fills the limits req leaves unset.
+func (this *Limits) Apply(req *Request) {
+	if req.Timeout == 0 {
+		req.Timeout = this.Timeout
+	}
+	if req.MaxBodyBytes == 0 {
+		req.MaxBodyBytes = this.MaxBodyBytes
+		if req.BodyLimit == "" {
+			req.BodyLimit = this.BodyLimit
+		}
+	}
+	if req.Redirect == nil && req.checkRedirect == nil && this.Redirect != nil {
+		policy := *this.Redirect
+		req.Redirect = &policy
+	}
+}
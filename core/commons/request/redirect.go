@@ -0,0 +1,35 @@
+package request
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// NoRedirects as RedirectPolicy.MaxRedirects follows no redirect.
+const NoRedirects = -1
+
+// RedirectPolicy tells the downloader which redirects to follow.
+type RedirectPolicy struct {
+	// MaxRedirects is the number of redirects followed, 0 keeps the net/http
+	// default of 10 and NoRedirects follows none.
+	MaxRedirects int `json:"max_redirects,omitempty"`
+	// SameHost refuses redirects to another host than the one of the request.
+	SameHost bool `json:"same_host,omitempty"`
+}
+
+// CheckRedirect implements http.Client.CheckRedirect. When a redirect is
+// refused the download fails with the returned error.
+func (this *RedirectPolicy) CheckRedirect(req *http.Request, via []*http.Request) error {
+	max := this.MaxRedirects
+	if max == 0 {
+		max = 10
+	}
+	if max < 0 || len(via) > max {
+		return fmt.Errorf("stopped after %d redirects", len(via)-1)
+	}
+	if this.SameHost && len(via) > 0 && !strings.EqualFold(req.URL.Hostname(), via[0].URL.Hostname()) {
+		return fmt.Errorf("redirect to other host %s refused", req.URL.Host)
+	}
+	return nil
+}
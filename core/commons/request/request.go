@@ -1,34 +1,60 @@
+// Package request describes what the crawler downloads. A Request is plain
+// data: it can be stored as JSON and sent to other processes.
 package request
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/utils"
 )
 
 type Request struct {
-	Url           string
-	RespType      string
-	Method        string
-	PostData      string
-	UrlTag        string
-	Header        http.Header
-	Cookies       []*http.Cookie
-	ProxyHost     string
+	Url       string         `json:"url"`
+	RespType  string         `json:"resp_type,omitempty"`
+	Method    string         `json:"method,omitempty"`
+	PostData  string         `json:"post_data,omitempty"`
+	UrlTag    string         `json:"url_tag,omitempty"`
+	Header    http.Header    `json:"header,omitempty"`
+	Cookies   []*http.Cookie `json:"cookies,omitempty"`
+	ProxyHost string         `json:"proxy_host,omitempty"`
+	// Redirect limits the redirects followed, nil follows the net/http default.
+	Redirect *RedirectPolicy `json:"redirect,omitempty"`
+	// Timeout bounds the whole download including reading the body, 0 waits as long as it takes.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// MaxBodyBytes bounds the response body, 0 reads it all.
+	MaxBodyBytes int64 `json:"max_body_bytes,omitempty"`
+	// BodyLimit is BodyTruncate (the default) or BodyFail.
+	BodyLimit string `json:"body_limit,omitempty"`
+	// NotBefore delays the download, the scheduler holds the request until then.
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	// Retries counts the times the crawler scheduled the request again, e.g. after a Retry-After.
+	Retries int `json:"retries,omitempty"`
+	// checkRedirect is only set by the positional constructors, it is not serialized.
 	checkRedirect func(req *http.Request, via []*http.Request) error
-	Meta          interface{}
+	Meta          map[string]string `json:"meta,omitempty"`
 }
 
+// NewRequest creates a request from positional arguments, New is easier to read.
+// checkRedirect is not serialized, prefer a RedirectPolicy.
 func NewRequest(url string, respType string, urlTag string, method string,
 	postdata string, header http.Header, cookies []*http.Cookie,
 	checkRedirect func(req *http.Request, via []*http.Request) error,
-	meta interface{}) *Request {
-	return &Request{url, respType, method, postdata, urlTag, header, cookies, "", checkRedirect, meta}
+	meta map[string]string) *Request {
+	return &Request{Url: url, RespType: respType, Method: method, PostData: postdata, UrlTag: urlTag,
+		Header: header, Cookies: cookies, checkRedirect: checkRedirect, Meta: meta}
 }
 
 func NewRequestWithProxy(url string, respType string, urltag string, method string,
 	postdata string, header http.Header, cookies []*http.Cookie, proxyHost string,
 	checkRedirect func(req *http.Request, via []*http.Request) error,
-	meta interface{}) *Request {
-	return &Request{url, respType, method, postdata, urltag, header, cookies, proxyHost, checkRedirect, meta}
+	meta map[string]string) *Request {
+	req := NewRequest(url, respType, urltag, method, postdata, header, cookies, checkRedirect, meta)
+	req.ProxyHost = proxyHost
+	return req
 }
 
 func (this *Request) AddProxyHost(host string) *Request {
@@ -68,10 +94,74 @@ func (this *Request) GetResponceType() string {
 	return this.RespType
 }
 
+// GetRedirectFunc returns the redirect check of the request for http.Client.CheckRedirect.
 func (this *Request) GetRedirectFunc() func(req *http.Request, via []*http.Request) error {
-	return this.checkRedirect
+	if this.checkRedirect != nil {
+		return this.checkRedirect
+	}
+	if this.Redirect != nil {
+		return this.Redirect.CheckRedirect
+	}
+	return nil
+}
+
+func (this *Request) GetTimeout() time.Duration {
+	return this.Timeout
+}
+
+func (this *Request) GetMaxBodyBytes() int64 {
+	return this.MaxBodyBytes
+}
+
+// GetBodyLimit returns BodyTruncate or BodyFail.
+func (this *Request) GetBodyLimit() string {
+	if this.BodyLimit == "" {
+		return BodyTruncate
+	}
+	return this.BodyLimit
+}
+
+// GetNotBefore returns when the request may be downloaded, zero for now.
+func (this *Request) GetNotBefore() time.Time {
+	if this.NotBefore == nil {
+		return time.Time{}
+	}
+	return *this.NotBefore
 }
 
-func (this *Request) GetMeta() interface{} {
+// IsDue tells whether the request may be downloaded at now.
+func (this *Request) IsDue(now time.Time) bool {
+	return !this.GetNotBefore().After(now)
+}
+
+func (this *Request) GetMeta() map[string]string {
 	return this.Meta
 }
+
+// GetMetaValue returns the Meta value of key, "" when it is not set.
+func (this *Request) GetMetaValue(key string) string {
+	return this.Meta[key]
+}
+
+// SetMeta sets a Meta value.
+func (this *Request) SetMeta(key string, value string) *Request {
+	if this.Meta == nil {
+		this.Meta = make(map[string]string)
+	}
+	this.Meta[key] = value
+	return this
+}
+
+// Fingerprint identifies what the request fetches, for schedulers and dedupe
+// filters: the hex SHA-1 of the method, the normalized url and the body.
+// Header, tag and Meta do not change it.
+func (this *Request) Fingerprint() string {
+	method := strings.ToUpper(this.Method)
+	if method == "" {
+		method = "GET"
+	}
+	h := sha1.New()
+	h.Write([]byte(method + " " + utils.NormalizeUrlString(this.Url) + "\n"))
+	h.Write([]byte(this.PostData))
+	return hex.EncodeToString(h.Sum(nil))
+}
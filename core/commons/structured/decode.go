@@ -0,0 +1,171 @@
+package structured
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02"}
+
+// Decode stores the item in the struct pointed to by v. A field takes the
+// property named by its json tag, by its name with a lower case first letter
+// otherwise; the tags "@type" and "@id" take the types and the id. Fields may
+// be strings, numbers, bools, time.Time, structs or pointers to structs for
+// nested items, and slices of those for every value of the property, e.g.
+//
+//	type Product struct {
+//		Name   string   `json:"name"`
+//		Offers []*Offer `json:"offers"`
+//	}
+//
+// Values which do not convert to the type of their field are an error.
+func (this *Item) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("structured: Decode needs a pointer to a struct")
+	}
+	return this.decode(rv.Elem(), make(map[*Item]bool))
+}
+
+func (this *Item) decode(rv reflect.Value, path map[*Item]bool) error {
+	path[this] = true
+	defer delete(path, this)
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := fieldName(f)
+		if name == "-" {
+			continue
+		}
+		var values []interface{}
+		switch name {
+		case "@type":
+			for _, t := range this.Types {
+				values = append(values, t)
+			}
+		case "@id":
+			if this.Id != "" {
+				values = []interface{}{this.Id}
+			}
+		default:
+			values = this.Properties[name]
+		}
+		if len(values) == 0 {
+			continue
+		}
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(fv.Type(), 0, len(values))
+			for _, value := range values {
+				e := reflect.New(fv.Type().Elem()).Elem()
+				if ok, err := set(e, value, path); err != nil {
+					return fmt.Errorf("structured: %s: %s", name, err.Error())
+				} else if ok {
+					slice = reflect.Append(slice, e)
+				}
+			}
+			fv.Set(slice)
+			continue
+		}
+		if _, err := set(fv, values[0], path); err != nil {
+			return fmt.Errorf("structured: %s: %s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+func fieldName(f reflect.StructField) string {
+	if tag := f.Tag.Get("json"); tag != "" {
+		if name := strings.Split(tag, ",")[0]; name != "" {
+			return name
+		}
+	}
+	r, size := utf8.DecodeRuneInString(f.Name)
+	return string(unicode.ToLower(r)) + f.Name[size:]
+}
+
+// set stores value in fv. It returns false when a nested item was skipped as a cycle.
+func set(fv reflect.Value, value interface{}, path map[*Item]bool) (bool, error) {
+	if item, ok := value.(*Item); ok {
+		switch {
+		case fv.Kind() == reflect.Struct && fv.Type() != timeType:
+			if path[item] {
+				return false, nil
+			}
+			return true, item.decode(fv, path)
+		case fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct && fv.Type().Elem() != timeType:
+			if path[item] {
+				return false, nil
+			}
+			p := reflect.New(fv.Type().Elem())
+			if err := item.decode(p.Elem(), path); err != nil {
+				return false, err
+			}
+			fv.Set(p)
+			return true, nil
+		}
+		// A nested item into a plain field gives its name.
+		value = item.name()
+	}
+
+	s := value.(string)
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return false, err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return false, err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return false, err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return false, err
+		}
+		fv.SetFloat(n)
+	case reflect.Struct:
+		if fv.Type() != timeType {
+			return false, fmt.Errorf("%q is not an item", s)
+		}
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				fv.Set(reflect.ValueOf(t))
+				return true, nil
+			}
+		}
+		return false, fmt.Errorf("%q is not a date", s)
+	case reflect.Ptr:
+		p := reflect.New(fv.Type().Elem())
+		if ok, err := set(p.Elem(), s, path); !ok || err != nil {
+			return ok, err
+		}
+		fv.Set(p)
+	default:
+		return false, fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return true, nil
+}
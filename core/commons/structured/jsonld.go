@@ -0,0 +1,123 @@
+package structured
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ParseJsonLd returns the items of the <script type="application/ld+json">
+// blocks of doc. The nodes of a @graph are items, and references to their
+// @id are replaced by the node. Blocks which are not valid JSON are skipped.
+func ParseJsonLd(doc *goquery.Document) []*Item {
+	var items []*Item
+	doc.Find(`script[type="application/ld+json"]`).Each(func(i int, s *goquery.Selection) {
+		dec := json.NewDecoder(strings.NewReader(strings.TrimSpace(s.Text())))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return
+		}
+		p := &ldParser{ids: make(map[string]*Item)}
+		var block []*Item
+		for _, node := range topNodes(v) {
+			if item, ok := p.value(node).(*Item); ok {
+				block = append(block, item)
+			}
+		}
+		p.resolve()
+		items = append(items, block...)
+	})
+	return items
+}
+
+// topNodes returns the nodes of a block: the block itself, its items or its @graph.
+func topNodes(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		var nodes []interface{}
+		for _, e := range v {
+			nodes = append(nodes, topNodes(e)...)
+		}
+		return nodes
+	case map[string]interface{}:
+		if graph, ok := v["@graph"]; ok {
+			return topNodes(graph)
+		}
+		return []interface{}{v}
+	}
+	return nil
+}
+
+type ldParser struct {
+	ids  map[string]*Item
+	refs []*Item
+}
+
+// value converts a JSON-LD value to a string or an *Item, nil when empty.
+func (this *ldParser) value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case map[string]interface{}:
+		if value, ok := v["@value"]; ok {
+			return this.value(value)
+		}
+		item := newItem(JsonLd)
+		for key, prop := range v {
+			switch key {
+			case "@context", "@graph":
+			case "@type":
+				for _, t := range flatList(prop) {
+					if s, ok := t.(string); ok {
+						item.Types = append(item.Types, shorten(s))
+					}
+				}
+			case "@id":
+				item.Id, _ = prop.(string)
+			default:
+				for _, e := range flatList(prop) {
+					if value := this.value(e); value != nil {
+						item.add(key, value)
+					}
+				}
+			}
+		}
+		if item.Id != "" {
+			if len(item.Types) == 0 && len(item.Properties) == 0 {
+				// A reference, resolved when the block is read.
+				this.refs = append(this.refs, item)
+			} else if _, ok := this.ids[item.Id]; !ok {
+				this.ids[item.Id] = item
+			}
+		}
+		return item
+	}
+	return nil
+}
+
+// resolve fills the references with the node they point to.
+func (this *ldParser) resolve() {
+	for _, ref := range this.refs {
+		if node, ok := this.ids[ref.Id]; ok {
+			*ref = *node
+		}
+	}
+}
+
+func flatList(v interface{}) []interface{} {
+	if list, ok := v.([]interface{}); ok {
+		var flat []interface{}
+		for _, e := range list {
+			flat = append(flat, flatList(e)...)
+		}
+		return flat
+	}
+	return []interface{}{v}
+}
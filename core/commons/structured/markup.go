@@ -0,0 +1,161 @@
+package structured
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// syntax is how items are marked up with attributes, microdata or RDFa.
+type syntax struct {
+	source string
+	// scope is the attribute starting an item.
+	scope    string
+	typeAttr string
+	propAttr string
+	idAttrs  []string
+}
+
+var microdataSyntax = &syntax{source: Microdata, scope: "itemscope", typeAttr: "itemtype", propAttr: "itemprop", idAttrs: []string{"itemid"}}
+
+// RDFa Lite with the schema.org vocabulary, as in vocab="https://schema.org/" typeof="Product".
+var rdfaSyntax = &syntax{source: Rdfa, scope: "typeof", typeAttr: "typeof", propAttr: "property", idAttrs: []string{"resource", "about"}}
+
+// ParseMicrodata returns the top level itemscopes of doc.
+func ParseMicrodata(doc *goquery.Document, base string) []*Item {
+	return microdataSyntax.parse(doc, base)
+}
+
+// ParseRdfa returns the top level typeof elements of doc.
+func ParseRdfa(doc *goquery.Document, base string) []*Item {
+	return rdfaSyntax.parse(doc, base)
+}
+
+func (this *syntax) parse(doc *goquery.Document, base string) []*Item {
+	baseUrl, _ := url.Parse(base)
+	var items []*Item
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && hasAttr(n, this.scope) {
+			items = append(items, this.item(n, baseUrl))
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range doc.Nodes {
+		walk(n)
+	}
+	return items
+}
+
+func (this *syntax) item(n *html.Node, base *url.URL) *Item {
+	item := newItem(this.source)
+	for _, t := range strings.Fields(attr(n, this.typeAttr)) {
+		item.Types = append(item.Types, shorten(t))
+	}
+	for _, a := range this.idAttrs {
+		if id := attr(n, a); id != "" {
+			item.Id = resolve(base, id)
+			break
+		}
+	}
+	this.props(n, item, base)
+	return item
+}
+
+// props adds the properties below n to item, nested items keep theirs.
+func (this *syntax) props(n *html.Node, item *Item, base *url.URL) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		nested := hasAttr(c, this.scope)
+		if names := strings.Fields(attr(c, this.propAttr)); len(names) > 0 {
+			var value interface{}
+			if nested {
+				value = this.item(c, base)
+			} else {
+				value = propValue(c, base)
+			}
+			for _, name := range names {
+				item.add(name, value)
+			}
+		}
+		if !nested {
+			this.props(c, item, base)
+		}
+	}
+}
+
+// propValue returns the value of a property element, as defined by microdata.
+func propValue(n *html.Node, base *url.URL) string {
+	if hasAttr(n, "content") {
+		return attr(n, "content")
+	}
+	switch n.Data {
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		return resolve(base, attr(n, "src"))
+	case "a", "area", "link":
+		return resolve(base, attr(n, "href"))
+	case "object":
+		return resolve(base, attr(n, "data"))
+	case "data", "meter":
+		return attr(n, "value")
+	case "time":
+		if hasAttr(n, "datetime") {
+			return attr(n, "datetime")
+		}
+	}
+	if r := attr(n, "resource"); r != "" {
+		return resolve(base, r)
+	}
+	return text(n)
+}
+
+func text(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+		for c := c.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func resolve(base *url.URL, ref string) string {
+	if base == nil || ref == "" {
+		return ref
+	}
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
@@ -0,0 +1,273 @@
+// Package structured parses the schema.org data embedded in html pages as
+// JSON-LD, microdata or RDFa into one nested structure.
+package structured
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/viixv/crawler/core/commons/result"
+)
+
+// Sources of an Item.
+const (
+	JsonLd    = "jsonld"
+	Microdata = "microdata"
+	Rdfa      = "rdfa"
+)
+
+// Item is an entity, e.g. a Product with its Offers. Types and property names
+// of the schema.org vocabulary are shortened: http://schema.org/Product is Product.
+type Item struct {
+	Types  []string
+	Id     string
+	Source string
+	// Properties holds the values of each property in order, strings or *Item.
+	Properties map[string][]interface{}
+}
+
+func newItem(source string) *Item {
+	return &Item{Source: source, Properties: make(map[string][]interface{})}
+}
+
+func (this *Item) add(prop string, value interface{}) {
+	prop = shorten(prop)
+	this.Properties[prop] = append(this.Properties[prop], value)
+}
+
+// Parse returns the items of doc: the JSON-LD ones, then the microdata and
+// the RDFa ones, in document order. Relative urls are resolved against base.
+func Parse(doc *goquery.Document, base string) []*Item {
+	items := ParseJsonLd(doc)
+	items = append(items, ParseMicrodata(doc, base)...)
+	return append(items, ParseRdfa(doc, base)...)
+}
+
+// Is tells whether the item has one of the types.
+func (this *Item) Is(types ...string) bool {
+	for _, t := range this.Types {
+		for _, want := range types {
+			if t == shorten(want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Type returns the first type of the item, "" when it has none.
+func (this *Item) Type() string {
+	if len(this.Types) == 0 {
+		return ""
+	}
+	return this.Types[0]
+}
+
+// Get returns the first value of prop as a string, a nested item gives its name.
+func (this *Item) Get(prop string) string {
+	if values := this.Strings(prop); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Strings returns the values of prop as strings, nested items give their name,
+// url or id.
+func (this *Item) Strings(prop string) []string {
+	var values []string
+	for _, v := range this.Properties[shorten(prop)] {
+		switch v := v.(type) {
+		case string:
+			values = append(values, v)
+		case *Item:
+			if name := v.name(); name != "" {
+				values = append(values, name)
+			}
+		}
+	}
+	return values
+}
+
+func (this *Item) name() string {
+	for _, prop := range []string{"name", "url"} {
+		for _, v := range this.Properties[prop] {
+			if s, ok := v.(string); ok && s != "" {
+				return s
+			}
+		}
+	}
+	return this.Id
+}
+
+// Item returns the first nested item of prop, nil when there is none.
+func (this *Item) Item(prop string) *Item {
+	if items := this.Items(prop); len(items) > 0 {
+		return items[0]
+	}
+	return nil
+}
+
+// Items returns the nested items of prop.
+func (this *Item) Items(prop string) []*Item {
+	var items []*Item
+	for _, v := range this.Properties[shorten(prop)] {
+		if item, ok := v.(*Item); ok {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Find returns the items for which match is true, nested items included, in
+// depth first order.
+func Find(items []*Item, match func(item *Item) bool) []*Item {
+	var found []*Item
+	seen := make(map[*Item]bool)
+	var walk func(item *Item)
+	walk = func(item *Item) {
+		if seen[item] {
+			return
+		}
+		seen[item] = true
+		if match(item) {
+			found = append(found, item)
+		}
+		for _, values := range item.Properties {
+			for _, v := range values {
+				if nested, ok := v.(*Item); ok {
+					walk(nested)
+				}
+			}
+		}
+	}
+	for _, item := range items {
+		walk(item)
+	}
+	return found
+}
+
+// Filter returns the items of one of the types, e.g. Filter(items, "Product",
+// "Offer"), nested items included.
+func Filter(items []*Item, types ...string) []*Item {
+	return Find(items, func(item *Item) bool {
+		return item.Is(types...)
+	})
+}
+
+// Map returns the item as JSON ready values: @type, @id and the properties,
+// a single value as is and several as a list.
+func (this *Item) Map() map[string]interface{} {
+	return this.toMap(make(map[*Item]bool))
+}
+
+func (this *Item) toMap(path map[*Item]bool) map[string]interface{} {
+	path[this] = true
+	defer delete(path, this)
+	m := make(map[string]interface{}, len(this.Properties)+2)
+	if len(this.Types) == 1 {
+		m["@type"] = this.Types[0]
+	} else if len(this.Types) > 1 {
+		m["@type"] = this.Types
+	}
+	if this.Id != "" {
+		m["@id"] = this.Id
+	}
+	for prop, values := range this.Properties {
+		list := make([]interface{}, 0, len(values))
+		for _, v := range values {
+			if nested, ok := v.(*Item); ok {
+				if path[nested] {
+					// A cycle, e.g. a page whose author links back to it.
+					v = map[string]interface{}{"@id": nested.Id}
+				} else {
+					v = nested.toMap(path)
+				}
+			}
+			list = append(list, v)
+		}
+		if len(list) == 1 {
+			m[prop] = list[0]
+		} else {
+			m[prop] = list
+		}
+	}
+	return m
+}
+
+// Flatten returns the string values of the item by dotted path, e.g.
+// "offers.price". The second value of a property has the suffix .1, the
+// third .2 and so on.
+func (this *Item) Flatten() map[string]string {
+	flat := make(map[string]string)
+	this.flatten("", flat, make(map[*Item]bool))
+	return flat
+}
+
+func (this *Item) flatten(prefix string, flat map[string]string, path map[*Item]bool) {
+	path[this] = true
+	defer delete(path, this)
+	if len(this.Types) > 0 {
+		flat[prefix+"@type"] = strings.Join(this.Types, ",")
+	}
+	if this.Id != "" {
+		flat[prefix+"@id"] = this.Id
+	}
+	for prop, values := range this.Properties {
+		for i, v := range values {
+			key := prefix + prop
+			if i > 0 {
+				key += "." + strconv.Itoa(i)
+			}
+			switch v := v.(type) {
+			case string:
+				flat[key] = v
+			case *Item:
+				if path[v] {
+					flat[key] = v.name()
+				} else {
+					v.flatten(key+".", flat, path)
+				}
+			}
+		}
+	}
+}
+
+// AddTo adds the flattened values of the item to items, their keys prefixed
+// with prefix, e.g. "product.".
+func (this *Item) AddTo(items *result.ResultItems, prefix string) {
+	for k, v := range this.Flatten() {
+		items.AddItem(prefix+k, v)
+	}
+}
+
+// AddAll adds the items to res, each prefixed with its lower cased type, e.g.
+// "product.name"; the second item of a type is "product.1.name" and so on.
+func AddAll(res *result.ResultItems, items []*Item) {
+	seen := make(map[string]int)
+	for _, item := range items {
+		prefix := strings.ToLower(item.Type())
+		if prefix == "" {
+			prefix = "item"
+		}
+		if n := seen[prefix]; n > 0 {
+			item.AddTo(res, prefix+"."+strconv.Itoa(n)+".")
+		} else {
+			item.AddTo(res, prefix+".")
+		}
+		seen[prefix]++
+	}
+}
+
+var schemaPrefixes = []string{"http://schema.org/", "https://schema.org/", "schema:", "http://www.schema.org/", "https://www.schema.org/"}
+
+// shorten removes the schema.org vocabulary from a type or a property.
+func shorten(name string) string {
+	name = strings.TrimSpace(name)
+	for _, p := range schemaPrefixes {
+		if strings.HasPrefix(name, p) {
+			return name[len(p):]
+		}
+	}
+	return name
+}
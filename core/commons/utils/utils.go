@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
+	"net/url"
 	"os"
 	"regexp"
 	"strings"
@@ -73,6 +74,9 @@ func IsNum(a string) bool {
 }
 
 // simple xml to string  support utf8
+//
+// Deprecated: it keeps the last text of each element name only, use the "xml"
+// response type and Page.XmlQuery instead.
 func XML2mapstr(xmldoc string) map[string]string {
 	var t xml.Token
 	var err error
@@ -105,3 +109,36 @@ func MakeHash(s string) string {
 	hash := fmt.Sprintf("%x", crc32.Checksum([]byte(s), IEEETable))
 	return hash
 }
+
+// NormalizeUrl returns the canonical form of an absolute url.
+// The scheme and host are lower-cased, the default port and fragment are removed,
+// an empty path becomes "/" and query parameters are sorted by key.
+func NormalizeUrl(u *url.URL) *url.URL {
+	n := *u
+	n.Scheme = strings.ToLower(n.Scheme)
+	n.Host = strings.ToLower(n.Host)
+	if n.Scheme == "http" && strings.HasSuffix(n.Host, ":80") {
+		n.Host = strings.TrimSuffix(n.Host, ":80")
+	} else if n.Scheme == "https" && strings.HasSuffix(n.Host, ":443") {
+		n.Host = strings.TrimSuffix(n.Host, ":443")
+	}
+	if n.Host != "" && n.Path == "" {
+		n.Path = "/"
+	}
+	if n.RawQuery != "" {
+		n.RawQuery = n.Query().Encode()
+	}
+	n.Fragment = ""
+	n.RawFragment = ""
+	return &n
+}
+
+// NormalizeUrlString is like NormalizeUrl but works on strings.
+// The input is returned unchanged if it cannot be parsed.
+func NormalizeUrlString(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	return NormalizeUrl(u).String()
+}
@@ -0,0 +1,123 @@
+package xmldoc
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+)
+
+// Result holds the nodes selected by a query.
+type Result struct {
+	nodes []*xmlquery.Node
+	err   error
+}
+
+// NewResult returns a Result holding nodes, or err if the query failed.
+func NewResult(nodes []*xmlquery.Node, err error) *Result {
+	return &Result{nodes: nodes, err: err}
+}
+
+// Query evaluates an XPath expression against doc. The prefixes of ns are
+// bound to namespaces, e.g. {"s": "http://schemas.xmlsoap.org/soap/envelope/"}
+// for "//s:Body"; without ns the prefixes of the document are matched.
+func Query(doc *xmlquery.Node, expr string, ns map[string]string) *Result {
+	if doc == nil {
+		return NewResult(nil, errors.New("no xml document"))
+	}
+	var x *xpath.Expr
+	var err error
+	if len(ns) > 0 {
+		x, err = xpath.CompileWithNS(expr, ns)
+	} else {
+		x, err = xpath.Compile(expr)
+	}
+	if err != nil {
+		return NewResult(nil, err)
+	}
+	return NewResult(xmlquery.QuerySelectorAll(doc, x), nil)
+}
+
+// Select evaluates a CSS like selector against doc, see Selector.
+func Select(doc *xmlquery.Node, selector string, ns map[string]string) *Result {
+	expr, err := Selector(selector)
+	if err != nil {
+		return NewResult(nil, err)
+	}
+	return Query(doc, expr, ns)
+}
+
+// Err returns the error of an invalid expression or missing document.
+func (this *Result) Err() error {
+	return this.err
+}
+
+// Len returns the number of selected nodes.
+func (this *Result) Len() int {
+	return len(this.nodes)
+}
+
+// Nodes returns the selected nodes.
+func (this *Result) Nodes() []*xmlquery.Node {
+	return this.nodes
+}
+
+// First returns the first node, or nil.
+func (this *Result) First() *xmlquery.Node {
+	if len(this.nodes) == 0 {
+		return nil
+	}
+	return this.nodes[0]
+}
+
+// String returns the text of the first node, or "" if there is none.
+func (this *Result) String() string {
+	if ss := this.Strings(); len(ss) > 0 {
+		return ss[0]
+	}
+	return ""
+}
+
+// Strings returns the trimmed text of each node. Selected attributes give their value.
+func (this *Result) Strings() []string {
+	ss := make([]string, 0, len(this.nodes))
+	for _, n := range this.nodes {
+		ss = append(ss, strings.TrimSpace(n.InnerText()))
+	}
+	return ss
+}
+
+// Attrs returns the attribute name of each node having it, e.g. "xml:lang".
+func (this *Result) Attrs(name string) []string {
+	var ss []string
+	for _, n := range this.nodes {
+		if v, ok := Attr(n, name); ok {
+			ss = append(ss, v)
+		}
+	}
+	return ss
+}
+
+// Xml returns the markup of each node.
+func (this *Result) Xml() []string {
+	ss := make([]string, 0, len(this.nodes))
+	for _, n := range this.nodes {
+		ss = append(ss, n.OutputXML(true))
+	}
+	return ss
+}
+
+// Attr returns the attribute name of n, "prefix:local" for a prefixed one, and whether n has it.
+func Attr(n *xmlquery.Node, name string) (string, bool) {
+	space, local := "", name
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		space, local = name[:i], name[i+1:]
+	}
+	for _, a := range n.Attr {
+		if a.Name.Local == local && a.Name.Space == space {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,289 @@
+package xmldoc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Selector translates a CSS like selector into XPath. It supports element names,
+// with a namespace prefix written soap|Body, *, the descendant, child (>),
+// adjacent (+) and sibling (~) combinators, groups (,), the attribute tests
+// [a], [a=v], [a~=v], [a^=v], [a$=v] and [a*=v], and :first-child,
+// :last-child and :nth-child(n). Names are matched as in XPath: by prefix, or
+// by namespace when the query binds prefixes.
+func Selector(css string) (string, error) {
+	s := &selectorParser{src: css}
+	var groups []string
+	for {
+		x, err := s.selector()
+		if err != nil {
+			return "", fmt.Errorf("selector %q: %s", css, err.Error())
+		}
+		groups = append(groups, x)
+		s.skipSpace()
+		if s.eof() {
+			break
+		}
+		if s.src[s.pos] != ',' {
+			return "", fmt.Errorf("selector %q: unexpected %q at %d", css, s.src[s.pos], s.pos)
+		}
+		s.pos++
+	}
+	return strings.Join(groups, " | "), nil
+}
+
+type selectorParser struct {
+	src string
+	pos int
+}
+
+func (this *selectorParser) eof() bool {
+	return this.pos >= len(this.src)
+}
+
+func (this *selectorParser) skipSpace() bool {
+	start := this.pos
+	for !this.eof() && strings.IndexByte(" \t\r\n", this.src[this.pos]) >= 0 {
+		this.pos++
+	}
+	return this.pos > start
+}
+
+func (this *selectorParser) selector() (string, error) {
+	this.skipSpace()
+	step, err := this.compound()
+	if err != nil {
+		return "", err
+	}
+	x := "//" + step
+	for {
+		spaced := this.skipSpace()
+		if this.eof() || this.src[this.pos] == ',' {
+			return x, nil
+		}
+		combinator := byte(' ')
+		if c := this.src[this.pos]; c == '>' || c == '+' || c == '~' {
+			combinator = c
+			this.pos++
+			this.skipSpace()
+		} else if !spaced {
+			return "", fmt.Errorf("unexpected %q at %d", c, this.pos)
+		}
+		step, err := this.compound()
+		if err != nil {
+			return "", err
+		}
+		switch combinator {
+		case ' ':
+			x += "//" + step
+		case '>':
+			x += "/" + step
+		case '+':
+			x += "/following-sibling::*[1]/self::" + step
+		case '~':
+			x += "/following-sibling::" + step
+		}
+	}
+}
+
+// compound returns the XPath step of an element name with its tests.
+func (this *selectorParser) compound() (string, error) {
+	start := this.pos
+	name := "*"
+	if !this.eof() && this.src[this.pos] == '*' {
+		this.pos++
+	} else if n, err := this.name(); err != nil {
+		return "", err
+	} else if n != "" {
+		name = n
+	}
+	var tests []string
+	for !this.eof() && (this.src[this.pos] == '[' || this.src[this.pos] == ':') {
+		var t string
+		var err error
+		if this.src[this.pos] == '[' {
+			t, err = this.attribute()
+		} else {
+			t, err = this.pseudo()
+		}
+		if err != nil {
+			return "", err
+		}
+		tests = append(tests, t)
+	}
+	if this.pos == start {
+		if this.eof() {
+			return "", errors.New("unexpected end")
+		}
+		return "", fmt.Errorf("unexpected %q at %d", this.src[this.pos], this.pos)
+	}
+	return name + strings.Join(tests, ""), nil
+}
+
+// name reads a name, prefix|local is returned as prefix:local. It returns ""
+// when there is none; the prefix and the local name must not be empty nor
+// start or end with a dot, as in ".", "a." or "a|".
+func (this *selectorParser) name() (string, error) {
+	start := this.pos
+	part := this.pos
+	for !this.eof() {
+		c := this.src[this.pos]
+		if c == '|' && part == start {
+			if err := this.checkName(part); err != nil {
+				return "", err
+			}
+			this.pos++
+			part = this.pos
+			continue
+		}
+		if c == '-' || c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 {
+			this.pos++
+			continue
+		}
+		break
+	}
+	if this.pos == start {
+		return "", nil
+	}
+	if err := this.checkName(part); err != nil {
+		return "", err
+	}
+	return strings.Replace(this.src[start:this.pos], "|", ":", 1), nil
+}
+
+// checkName checks the part of a name from start to the current position.
+func (this *selectorParser) checkName(start int) error {
+	part := this.src[start:this.pos]
+	if part == "" || part[0] == '.' {
+		return fmt.Errorf("name expected at %d", start)
+	}
+	if part[len(part)-1] == '.' {
+		return fmt.Errorf("name expected at %d", this.pos)
+	}
+	return nil
+}
+
+func (this *selectorParser) attribute() (string, error) {
+	this.pos++ // [
+	this.skipSpace()
+	attr, err := this.name()
+	if err != nil {
+		return "", err
+	}
+	if attr == "" {
+		return "", fmt.Errorf("attribute name expected at %d", this.pos)
+	}
+	attr = "@" + attr
+	this.skipSpace()
+	if this.eof() {
+		return "", errors.New("unexpected end")
+	}
+	if this.src[this.pos] == ']' {
+		this.pos++
+		return "[" + attr + "]", nil
+	}
+	op := ""
+	for _, o := range []string{"=", "~=", "^=", "$=", "*="} {
+		if strings.HasPrefix(this.src[this.pos:], o) {
+			op = o
+		}
+	}
+	if op == "" {
+		return "", fmt.Errorf("unexpected %q at %d", this.src[this.pos], this.pos)
+	}
+	this.pos += len(op)
+	this.skipSpace()
+	value, err := this.value()
+	if err != nil {
+		return "", err
+	}
+	this.skipSpace()
+	if this.eof() || this.src[this.pos] != ']' {
+		return "", fmt.Errorf("] expected at %d", this.pos)
+	}
+	this.pos++
+	v, err := literal(value)
+	if err != nil {
+		return "", err
+	}
+	switch op {
+	case "=":
+		return "[" + attr + "=" + v + "]", nil
+	case "~=":
+		w, err := literal(" " + value + " ")
+		if err != nil {
+			return "", err
+		}
+		return "[contains(concat(' ',normalize-space(" + attr + "),' ')," + w + ")]", nil
+	case "^=":
+		return "[starts-with(" + attr + "," + v + ")]", nil
+	case "$=":
+		return "[ends-with(" + attr + "," + v + ")]", nil
+	default:
+		return "[contains(" + attr + "," + v + ")]", nil
+	}
+}
+
+// value reads a quoted or a bare attribute value.
+func (this *selectorParser) value() (string, error) {
+	if this.eof() {
+		return "", errors.New("unexpected end")
+	}
+	if q := this.src[this.pos]; q == '"' || q == '\'' {
+		end := strings.IndexByte(this.src[this.pos+1:], q)
+		if end < 0 {
+			return "", errors.New("unterminated string")
+		}
+		v := this.src[this.pos+1 : this.pos+1+end]
+		this.pos += end + 2
+		return v, nil
+	}
+	start := this.pos
+	for !this.eof() && this.src[this.pos] != ']' && this.src[this.pos] != ' ' {
+		this.pos++
+	}
+	return this.src[start:this.pos], nil
+}
+
+func (this *selectorParser) pseudo() (string, error) {
+	this.pos++ // :
+	start := this.pos
+	name, err := this.name()
+	if err != nil {
+		return "", err
+	}
+	switch name {
+	case "first-child":
+		return "[not(preceding-sibling::*)]", nil
+	case "last-child":
+		return "[not(following-sibling::*)]", nil
+	case "nth-child":
+		if this.eof() || this.src[this.pos] != '(' {
+			return "", fmt.Errorf("( expected at %d", this.pos)
+		}
+		end := strings.IndexByte(this.src[this.pos:], ')')
+		if end < 0 {
+			return "", errors.New("unterminated :nth-child")
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(this.src[this.pos+1 : this.pos+end]))
+		if err != nil || n < 1 {
+			return "", fmt.Errorf(":nth-child takes a positive number at %d", this.pos+1)
+		}
+		this.pos += end + 1
+		return "[count(preceding-sibling::*)=" + strconv.Itoa(n-1) + "]", nil
+	}
+	return "", fmt.Errorf("unsupported pseudo class %q at %d", name, start)
+}
+
+// literal quotes s as an XPath 1.0 string, which has no escapes.
+func literal(s string) (string, error) {
+	if !strings.Contains(s, "'") {
+		return "'" + s + "'", nil
+	}
+	if !strings.Contains(s, `"`) {
+		return `"` + s + `"`, nil
+	}
+	return "", fmt.Errorf("value %q has both quotes", s)
+}
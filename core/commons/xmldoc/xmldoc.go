@@ -0,0 +1,60 @@
+// Package xmldoc parses xml responses into a namespace aware DOM, queried
+// with XPath or with CSS like selectors, e.g. SOAP envelopes, sitemaps or
+// OAI-PMH records.
+package xmldoc
+
+import (
+	"bytes"
+	"io"
+	"unicode/utf8"
+
+	"github.com/antchfx/xmlquery"
+	"golang.org/x/net/html/charset"
+)
+
+// Parse parses an xml document. A document which is not valid utf-8 is decoded
+// with the encoding of its xml declaration, one which is was decoded already,
+// e.g. by the downloader, and its declaration is ignored.
+func Parse(data []byte) (*xmlquery.Node, error) {
+	valid := utf8.Valid(data)
+	return xmlquery.ParseWithOptions(bytes.NewReader(data), xmlquery.ParserOptions{
+		Decoder: &xmlquery.DecoderOptions{
+			Strict: true,
+			CharsetReader: func(label string, input io.Reader) (io.Reader, error) {
+				if valid {
+					return input, nil
+				}
+				return charset.NewReaderLabel(label, input)
+			},
+		},
+	})
+}
+
+// Namespaces returns the namespaces declared in the document by prefix, the
+// default namespace under "". The first declaration of a prefix wins.
+func Namespaces(doc *xmlquery.Node) map[string]string {
+	ns := make(map[string]string)
+	var walk func(n *xmlquery.Node)
+	walk = func(n *xmlquery.Node) {
+		if n.Type == xmlquery.ElementNode {
+			for _, a := range n.Attr {
+				prefix := ""
+				switch {
+				case a.Name.Space == "xmlns":
+					prefix = a.Name.Local
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+				default:
+					continue
+				}
+				if _, ok := ns[prefix]; !ok {
+					ns[prefix] = a.Value
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return ns
+}
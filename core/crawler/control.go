@@ -0,0 +1,142 @@
+package crawler
+
+import (
+	"sort"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/request"
+)
+
+// IsRunning reports whether Run is in progress.
+func (this *Crawler) IsRunning() bool {
+	this.stateMutex.Lock()
+	defer this.stateMutex.Unlock()
+	return this.running
+}
+
+// Pause stops taking requests from the scheduler. Requests in flight finish.
+func (this *Crawler) Pause() *Crawler {
+	this.stateMutex.Lock()
+	if !this.paused {
+		this.paused = true
+		this.resume = make(chan struct{})
+		if this.cancelTake != nil {
+			this.cancelTake()
+		}
+		this.log().Info("crawl paused")
+	}
+	this.stateMutex.Unlock()
+	return this
+}
+
+// Resume takes requests from the scheduler again after Pause.
+func (this *Crawler) Resume() *Crawler {
+	this.stateMutex.Lock()
+	if this.paused {
+		this.paused = false
+		close(this.resume)
+		this.log().Info("crawl resumed")
+	}
+	this.stateMutex.Unlock()
+	return this
+}
+
+func (this *Crawler) IsPaused() bool {
+	this.stateMutex.Lock()
+	defer this.stateMutex.Unlock()
+	return this.paused
+}
+
+// pausedUntil returns a channel closed on Resume, nil when not paused.
+func (this *Crawler) pausedUntil() chan struct{} {
+	this.stateMutex.Lock()
+	defer this.stateMutex.Unlock()
+	if !this.paused {
+		return nil
+	}
+	return this.resume
+}
+
+// Stop makes Run return once the requests in flight, and those waiting for
+// their host, are done, even if the crawler was set not to exit when
+// complete. Queued requests stay in the scheduler, which Run keeps then:
+// GetScheduler returns them and a later Run crawls them. It ends a Pause.
+func (this *Crawler) Stop() *Crawler {
+	this.stateMutex.Lock()
+	if this.running && !this.stopping {
+		this.stopping = true
+		this.cancel()
+		this.log().Info("crawl stopping")
+	}
+	// A pause ends with the run, the next Run would wait for a Resume otherwise.
+	if this.paused {
+		this.paused = false
+		close(this.resume)
+	}
+	this.stateMutex.Unlock()
+	return this
+}
+
+// Discard releases a crawler which will not run: it fires the OnFinish hooks,
+// which close the files of the pipelines built from a spec, and forgets the
+// requests and pipelines as Run does. It does nothing while the crawler runs.
+func (this *Crawler) Discard() {
+	if this.IsRunning() {
+		return
+	}
+	this.hooks.FireFinish(this)
+	this.close()
+}
+
+func (this *Crawler) IsStopping() bool {
+	this.stateMutex.Lock()
+	defer this.stateMutex.Unlock()
+	return this.stopping
+}
+
+// Active returns the number of requests in flight.
+func (this *Crawler) Active() uint {
+	this.stateMutex.Lock()
+	c := this.cController
+	this.stateMutex.Unlock()
+	if c == nil {
+		return 0
+	}
+	return c.Has()
+}
+
+func (this *Crawler) waitActive() {
+	for this.cController.Has() > 0 {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// InFlightRequest is a request being downloaded or processed.
+type InFlightRequest struct {
+	Request *request.Request
+	Started time.Time
+}
+
+// InFlight returns the requests being downloaded or processed, oldest first.
+func (this *Crawler) InFlight() []*InFlightRequest {
+	this.stateMutex.Lock()
+	reqs := make([]*InFlightRequest, 0, len(this.inFlight))
+	for req, started := range this.inFlight {
+		reqs = append(reqs, &InFlightRequest{Request: req, Started: started})
+	}
+	this.stateMutex.Unlock()
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Started.Before(reqs[j].Started) })
+	return reqs
+}
+
+func (this *Crawler) startFlight(req *request.Request) {
+	this.stateMutex.Lock()
+	this.inFlight[req] = time.Now()
+	this.stateMutex.Unlock()
+}
+
+func (this *Crawler) endFlight(req *request.Request) {
+	this.stateMutex.Lock()
+	delete(this.inFlight, req)
+	this.stateMutex.Unlock()
+}
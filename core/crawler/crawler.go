@@ -1,32 +1,74 @@
 package crawler
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"math/rand"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/viixv/crawler/core/commons/controller"
+	"github.com/viixv/crawler/core/commons/logging"
 	"github.com/viixv/crawler/core/commons/page"
 	"github.com/viixv/crawler/core/commons/request"
 	"github.com/viixv/crawler/core/commons/result"
+	"github.com/viixv/crawler/core/deadletter"
 	"github.com/viixv/crawler/core/downloader"
+	"github.com/viixv/crawler/core/incremental"
+	"github.com/viixv/crawler/core/middleware"
 	"github.com/viixv/crawler/core/pipeline"
 	"github.com/viixv/crawler/core/processor"
 	"github.com/viixv/crawler/core/scheduler"
+	"github.com/viixv/crawler/core/stats"
 )
 
 type Crawler struct {
 	cController      controller.GoroutineController
+	userController   controller.GoroutineController
 	cDownloader      downloader.Downloader
 	cScheduler       scheduler.Scheduler
+	queue            scheduler.Blocking
+	delay            *scheduler.DelayScheduler
 	exitWhenComplete bool
 	goroutines       uint
 	pageProcessor    processor.PageProcessor
 	pipelines        []pipeline.Pipeline
+	pipelineNames    []string
 	sleepType        string
 	startSleepTime   uint
 	endSleepTime     uint
 	taskName         string
+	stats            *stats.Stats
+	metricsAddr      string
+	logger           *slog.Logger
+	middlewares      *middleware.Chain
+	hooks            *middleware.Hooks
+	errorHandler     deadletter.ErrorHandler
+	limits           *request.Limits
+	hostDelay        time.Duration
+	incremental      *incremental.Tracker
+
+	pushMutex  sync.Mutex
+	stateMutex sync.Mutex
+	running    bool
+	paused     bool
+	stopping   bool
+	resume     chan struct{}
+	cancel     context.CancelFunc
+	cancelTake context.CancelFunc
+	inFlight   map[*request.Request]time.Time
+	// hostTurns is the next download time of each host, turns the requests held for it.
+	hostTurns map[string]time.Time
+	turns     map[*request.Request]bool
+	// hostWaiting holds the requests waiting for a slot of their host, see takeHost.
+	hostWaiting map[string][]*request.Request
 }
 
 func NewCrawler(pageProcessor processor.PageProcessor, taskName string) *Crawler {
@@ -41,7 +83,10 @@ func NewCrawler(pageProcessor processor.PageProcessor, taskName string) *Crawler
 		crawler.SetDownloader(downloader.NewHttpDownloader())
 	}
 	crawler.pipelines = make([]pipeline.Pipeline, 0)
-	log.Println("Crawler initialization complete.")
+	crawler.stats = stats.NewStats(taskName)
+	crawler.middlewares = middleware.NewChain()
+	crawler.hooks = middleware.NewHooks()
+	crawler.log().Debug("crawler initialized")
 	return &crawler
 }
 
@@ -50,14 +95,14 @@ func (this *Crawler) TaskName() string {
 }
 
 func (this *Crawler) Get(url string, respType string) *result.ResultItems {
-	req := request.NewRequest(url, respType, "", "GET", "", nil, nil, nil, nil)
+	req := request.New(url).RespType(respType).Build()
 	return this.GetByRequest(req)
 }
 
 // Deal with several urls and return the PageItems slice.
 func (this *Crawler) GetAll(urls []string, respType string) []*result.ResultItems {
 	for _, u := range urls {
-		req := request.NewRequest(u, respType, "", "GET", "", nil, nil, nil, nil)
+		req := request.New(u).RespType(respType).Build()
 		this.AddRequest(req)
 	}
 
@@ -98,45 +143,270 @@ func (this *Crawler) Run() {
 	if this.goroutines == 0 {
 		this.goroutines = 1
 	}
-	this.cController = controller.NewGoroutineControllerChan(this.goroutines)
-
-	for {
-		req := this.cScheduler.Poll()
-		if this.cController.Has() == 0 && req == nil && this.exitWhenComplete {
-			this.pageProcessor.Finish()
-			log.Println("Crawling complete.")
-			break
-		} else if req == nil {
-			time.Sleep(500 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	this.stateMutex.Lock()
+	if this.userController != nil {
+		this.cController = this.userController
+	} else {
+		this.cController = controller.NewGoroutineControllerCond(this.goroutines)
+	}
+	this.running = true
+	this.stopping = false
+	this.cancel = cancel
+	this.inFlight = make(map[*request.Request]time.Time)
+	this.stateMutex.Unlock()
+	this.injectLogger()
+	this.startStats()
+	metrics := this.serveMetrics()
+	this.hooks.FireStart(this)
+
+	queue := this.queue
+	if this.exitWhenComplete {
+		go func() {
+			select {
+			case <-queue.Drained():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	for ctx.Err() == nil {
+		if resume := this.pausedUntil(); resume != nil {
+			select {
+			case <-resume:
+			case <-ctx.Done():
+			}
 			continue
 		}
 		this.cController.GetOne()
+		req, err := queue.Take(this.takeContext(ctx))
+		if err != nil {
+			// Stopped, complete or paused.
+			this.cController.FreeOne()
+			continue
+		}
+		if this.holdForHost(req) {
+			this.done(req)
+			this.cController.FreeOne()
+			continue
+		}
+		host := hostOf(req)
+		if !this.takeHost(this.cController, host, req) {
+			// It waits for its host without holding a global slot.
+			this.cController.FreeOne()
+			continue
+		}
 		go func(req *request.Request) {
 			defer this.cController.FreeOne()
-			log.Println("start crawl : " + req.GetUrl())
-			this.pageProcess(req)
+			for ; req != nil; req = this.handOff(this.cController, host) {
+				this.crawl(req)
+			}
 		}(req)
 	}
+	this.waitActive()
+	this.pageProcessor.Finish()
+	if this.IsStopping() {
+		this.log().Info("crawl stopped", "queued", this.cScheduler.Count())
+	} else {
+		this.log().Info("crawl complete")
+	}
+	this.stats.Finish()
+	this.logStats()
+	if metrics != nil {
+		metrics.Close()
+	}
+	this.hooks.FireFinish(this)
 	this.close()
+	this.stateMutex.Lock()
+	this.running = false
+	this.cancel = nil
+	if this.cancelTake != nil {
+		this.cancelTake()
+		this.cancelTake = nil
+	}
+	this.stateMutex.Unlock()
+}
+
+// takeContext returns a context of ctx that Pause cancels.
+func (this *Crawler) takeContext(ctx context.Context) context.Context {
+	this.stateMutex.Lock()
+	defer this.stateMutex.Unlock()
+	if this.cancelTake != nil {
+		this.cancelTake()
+	}
+	ctx, this.cancelTake = context.WithCancel(ctx)
+	if this.paused {
+		this.cancelTake()
+	}
+	return ctx
+}
+
+func (this *Crawler) crawl(req *request.Request) {
+	this.startFlight(req)
+	defer this.endFlight(req)
+	defer this.done(req)
+	this.log().Debug("start crawl", logging.Request(req)...)
+	this.pageProcess(req)
+}
+
+// done tells the scheduler the crawler finished req, after the requests found
+// on its page were pushed. The idle hook fires when nothing is left to crawl.
+func (this *Crawler) done(req *request.Request) {
+	if acker, ok := this.cScheduler.(scheduler.Acker); ok {
+		acker.Ack(req)
+	}
+	this.queue.Done(req)
+	if !this.exitWhenComplete && this.queue.Outstanding() == 0 {
+		this.hooks.FireIdle(this)
+	}
+}
+
+// SetLogger sets the logger of the crawler. It is passed on to the downloader,
+// scheduler, processor and pipelines implementing logging.Setter when Run starts.
+// Default is slog.Default().
+func (this *Crawler) SetLogger(l *slog.Logger) *Crawler {
+	this.logger = l
+	return this
+}
+
+// GetLogger returns the logger of the crawler, with the task attribute.
+func (this *Crawler) GetLogger() *slog.Logger {
+	return this.log()
+}
+
+func (this *Crawler) log() *slog.Logger {
+	return logging.Or(this.logger).With("task", this.taskName)
+}
+
+func (this *Crawler) injectLogger() {
+	if this.logger == nil {
+		return
+	}
+	l := this.log()
+	components := []interface{}{this.cDownloader, this.cScheduler, this.pageProcessor, this.userController}
+	for _, pipe := range this.pipelines {
+		components = append(components, pipe)
+	}
+	for _, c := range components {
+		if s, ok := c.(logging.Setter); ok {
+			s.SetLogger(l)
+		}
+	}
+}
+
+func (this *Crawler) logStats() {
+	snap := this.stats.Snapshot()
+	codes := make([]any, 0, len(snap.StatusCodes))
+	for code, n := range snap.StatusCodes {
+		codes = append(codes, slog.Uint64(fmt.Sprint(code), n))
+	}
+	changes := make([]any, 0, len(snap.Changes))
+	for state, n := range snap.Changes {
+		changes = append(changes, slog.Uint64(state, n))
+	}
+	this.log().Info("crawl stats",
+		"elapsed", snap.Elapsed,
+		"scheduled", snap.Scheduled,
+		"downloaded", snap.Downloaded,
+		"failed", snap.Failed,
+		"retried", snap.Retried,
+		"deduped", snap.Deduped,
+		"bytes", snap.Bytes,
+		slog.Group("status", codes...),
+		slog.Group("pages", changes...),
+	)
+}
+
+func (this *Crawler) startStats() {
+	this.stats.Reset()
+	// Requests added before Run were scheduled as part of this run, the held ones too.
+	queue, cc := this.queue, this.cController
+	this.stats.AddScheduled(uint64(queue.Count()))
+	dc, _ := this.cScheduler.(scheduler.DuplicateCounter)
+	this.stats.SetSources(stats.Sources{
+		QueueDepth: queue.Count,
+		Active:     func() int { return int(cc.Has()) },
+		Deduped: func() uint64 {
+			if dc != nil {
+				return dc.Duplicates()
+			}
+			return 0
+		},
+	})
+}
+
+func (this *Crawler) serveMetrics() *http.Server {
+	if this.metricsAddr == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", this.MetricsHandler())
+	srv := &http.Server{Addr: this.metricsAddr, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			this.log().Error("metrics server failed", "addr", this.metricsAddr, "error", err)
+		}
+	}()
+	return srv
+}
+
+// Stats returns a snapshot of the counters of the current or last run.
+func (this *Crawler) Stats() *stats.Snapshot {
+	return this.stats.Snapshot()
+}
+
+// MetricsHandler serves the crawler stats in the Prometheus text format.
+func (this *Crawler) MetricsHandler() http.Handler {
+	return stats.Handler(this.stats)
+}
+
+// SetMetricsAddr makes Run serve Prometheus metrics at http://addr/metrics while crawling.
+func (this *Crawler) SetMetricsAddr(addr string) *Crawler {
+	this.metricsAddr = addr
+	return this
 }
 
+// close resets the crawler after Run. The scheduler is kept after Stop,
+// with the requests still queued.
 func (this *Crawler) close() {
-	this.SetScheduler(scheduler.NewQueueScheduler(false))
+	if !this.IsStopping() {
+		this.SetScheduler(scheduler.NewQueueScheduler(false))
+	}
 	this.SetDownloader(downloader.NewHttpDownloader())
 	this.pipelines = make([]pipeline.Pipeline, 0)
+	this.pipelineNames = nil
 	this.exitWhenComplete = true
 }
 
 func (this *Crawler) AddPipeline(p pipeline.Pipeline) *Crawler {
 	this.pipelines = append(this.pipelines, p)
+	this.pipelineNames = append(this.pipelineNames, pipelineName(p, this.pipelines))
 	return this
 }
 
+// SetScheduler sets the scheduler. The crawler waits on it through
+// scheduler.NewBlocking, and holds delayed requests in a
+// scheduler.DelayScheduler unless it is scheduler.Delayed.
 func (this *Crawler) SetScheduler(s scheduler.Scheduler) *Crawler {
 	this.cScheduler = s
+	this.delay = nil
+	if _, ok := s.(scheduler.Delayed); !ok {
+		this.delay = scheduler.NewDelayScheduler(s)
+		s = this.delay
+	}
+	this.queue = scheduler.NewBlocking(s)
 	return this
 }
 
+// Delayed returns the number of requests held until their NotBefore time.
+func (this *Crawler) Delayed() int {
+	if this.delay == nil {
+		return 0
+	}
+	return this.delay.Held()
+}
+
 func (this *Crawler) GetScheduler() scheduler.Scheduler {
 	return this.cScheduler
 }
@@ -150,12 +420,21 @@ func (this *Crawler) GetDownloader() downloader.Downloader {
 	return this.cDownloader
 }
 
+// SetThreadnum sets the number of concurrent downloads. It may be called
+// while the crawler runs.
 func (this *Crawler) SetThreadnum(i uint) *Crawler {
+	this.stateMutex.Lock()
+	defer this.stateMutex.Unlock()
 	this.goroutines = i
+	if r, ok := this.cController.(controller.Resizable); ok && this.running && i > 0 {
+		r.SetCap(i)
+	}
 	return this
 }
 
 func (this *Crawler) GetThreadnum() uint {
+	this.stateMutex.Lock()
+	defer this.stateMutex.Unlock()
 	return this.goroutines
 }
 
@@ -190,14 +469,14 @@ func (this *Crawler) sleep() {
 }
 
 func (this *Crawler) AddUrl(url string, respType string) *Crawler {
-	req := request.NewRequest(url, respType, "", "GET", "", nil, nil, nil, nil)
+	req := request.New(url).RespType(respType).Build()
 	this.AddRequest(req)
 	return this
 }
 
 func (this *Crawler) AddUrls(urls []string, respType string) *Crawler {
 	for _, url := range urls {
-		req := request.NewRequest(url, respType, "", "GET", "", nil, nil, nil, nil)
+		req := request.New(url).RespType(respType).Build()
 		this.AddRequest(req)
 	}
 	return this
@@ -206,17 +485,35 @@ func (this *Crawler) AddUrls(urls []string, respType string) *Crawler {
 // add Request to Schedule
 func (this *Crawler) AddRequest(req *request.Request) *Crawler {
 	if req == nil {
-		log.Println("request is nil")
+		this.log().Warn("request is nil")
 		return this
 	} else if req.GetUrl() == "" {
-		log.Println("request is empty")
+		this.log().Warn("request url is empty", "url_tag", req.GetUrlTag())
 		return this
 	}
-	this.cScheduler.Push(req)
+	if !this.push(req) {
+		return this
+	}
+	this.stats.IncScheduled()
+	this.hooks.FireRequestScheduled(req)
 	return this
 }
 
-//
+// push pushes req to the scheduler and tells whether it was accepted, not
+// dropped as a duplicate. Pushes are serialized to tell theirs apart.
+func (this *Crawler) push(req *request.Request) bool {
+	dc, ok := this.cScheduler.(scheduler.DuplicateCounter)
+	if !ok {
+		this.queue.Push(req)
+		return true
+	}
+	this.pushMutex.Lock()
+	defer this.pushMutex.Unlock()
+	before := dc.Duplicates()
+	this.queue.Push(req)
+	return dc.Duplicates() == before
+}
+
 func (this *Crawler) AddRequests(reqs []*request.Request) *Crawler {
 	for _, req := range reqs {
 		this.AddRequest(req)
@@ -227,36 +524,159 @@ func (this *Crawler) AddRequests(reqs []*request.Request) *Crawler {
 // core processer
 func (this *Crawler) pageProcess(req *request.Request) {
 	var p *page.Page
+	attempts := 0
 	defer func() {
 		if err := recover(); err != nil {
-			if strerr, ok := err.(string); ok {
-				log.Println(strerr)
-			} else {
-				log.Println("pageProcess error")
+			this.log().Error("page process panic", append(logging.Request(req), "error", fmt.Sprint(err))...)
+			this.hooks.FireError(req, fmt.Errorf("panic: %v", err))
+			f := &deadletter.FailedRequest{Request: req, Error: fmt.Sprint(err), Attempts: attempts, Panic: true, Stack: string(debug.Stack())}
+			if p != nil {
+				f.Status = p.GetStatusCode()
 			}
+			this.deadLetter(f)
 		}
 	}()
 
+	if req = this.middlewares.Request(req, this); req == nil {
+		return
+	}
+	if this.limits != nil {
+		this.limits.Apply(req)
+	}
+	if this.notDue(req) {
+		return
+	}
+
+	host := ""
+	if u, err := url.Parse(req.GetUrl()); err == nil {
+		host = u.Host
+	}
+	this.stateMutex.Lock()
+	cc := this.cController
+	this.stateMutex.Unlock()
+	feedback, _ := cc.(controller.Feedback)
 	for i := 0; i < 3; i++ {
+		if i > 0 {
+			this.stats.IncRetried()
+		}
 		this.sleep()
-		p = this.cDownloader.Download(req)
+		attempts++
+		var elapsed time.Duration
+		p, elapsed = this.download(req)
+		if feedback != nil {
+			feedback.Observe(host, p.GetStatusCode(), elapsed, p.IsSucc())
+		}
+
+		var action middleware.Action
+		if p, action = this.middlewares.Response(p, this); action == middleware.Drop {
+			this.log().Debug("page dropped by middleware", logging.Request(req)...)
+			return
+		} else if action == middleware.Retry && p.IsSucc() {
+			p.SetStatus(true, fmt.Sprintf("retry requested by middleware, status %d", p.GetStatusCode()))
+		}
+
+		this.stats.ObserveDownload(host, p.GetStatusCode(), elapsed, len(p.GetBodyStr()), p.IsSucc())
+		attrs := append(logging.Request(req), "attempt", i+1, "status", p.GetStatusCode(), "duration", elapsed)
+		if this.retryLater(req, p) {
+			return
+		}
 		if p.IsSucc() {
+			this.log().Debug("downloaded", attrs...)
 			break
 		}
+		this.log().Debug("download failed", append(attrs, "error", p.Errormsg())...)
 	}
 
 	if !p.IsSucc() {
+		this.stats.IncFailed()
+		this.log().Warn("request failed", append(logging.Request(req), "attempt", attempts, "status", p.GetStatusCode(), "error", p.Errormsg())...)
+		this.hooks.FireError(req, errors.New(p.Errormsg()))
+		this.deadLetter(&deadletter.FailedRequest{Request: req, Error: p.Errormsg(), Status: p.GetStatusCode(), Attempts: attempts})
 		return
 	}
 
+	this.markChange(p, incremental.FingerprintBody)
 	this.pageProcessor.Process(p)
 	for _, req := range p.GetTargetRequests() {
 		this.AddRequest(req)
 	}
+	this.markChange(p, incremental.FingerprintItems)
 
-	if !p.GetSkip() {
-		for _, pipe := range this.pipelines {
-			pipe.Process(p.GetPageItems(), this)
+	if p.GetSkip() || this.dropUnchanged(p) {
+		return
+	}
+	items := this.middlewares.Item(p.GetPageItems(), this)
+	if items == nil {
+		return
+	}
+	this.hooks.FireItem(items)
+	for i, pipe := range this.pipelines {
+		pipe.Process(items, this)
+		this.stats.IncItems(this.pipelineNames[i])
+	}
+}
+
+func (this *Crawler) download(req *request.Request) (*page.Page, time.Duration) {
+	start := time.Now()
+	p := this.cDownloader.Download(req)
+	return p, time.Since(start)
+}
+
+// SetController replaces the fixed size controller created by Run, e.g. by a
+// controller.GoroutineControllerAdaptive. SetThreadnum then sets its ceiling
+// when it is controller.Resizable.
+func (this *Crawler) SetController(c controller.GoroutineController) *Crawler {
+	this.stateMutex.Lock()
+	defer this.stateMutex.Unlock()
+	this.userController = c
+	return this
+}
+
+// SetRequestLimits sets the timeout, body size limit and redirect policy of
+// the requests that do not set their own.
+func (this *Crawler) SetRequestLimits(l *request.Limits) *Crawler {
+	this.limits = l
+	return this
+}
+
+func (this *Crawler) GetRequestLimits() *request.Limits {
+	return this.limits
+}
+
+// SetErrorHandler sets where requests that fail their last download attempt or
+// whose processing panics are reported, e.g. a deadletter.JsonLinesHandler that
+// "crawler retry-failed" can re-seed a crawl from.
+func (this *Crawler) SetErrorHandler(h deadletter.ErrorHandler) *Crawler {
+	this.errorHandler = h
+	return this
+}
+
+func (this *Crawler) GetErrorHandler() deadletter.ErrorHandler {
+	return this.errorHandler
+}
+
+func (this *Crawler) deadLetter(f *deadletter.FailedRequest) {
+	if this.errorHandler == nil {
+		return
+	}
+	f.Task = this.taskName
+	f.Time = time.Now()
+	this.errorHandler.HandleError(f)
+}
+
+// pipelineName names pipe, the last of pipes, by its type for the item
+// counts, e.g. "JsonPipeline", and "JsonPipeline#2" for the second of a type.
+func pipelineName(pipe pipeline.Pipeline, pipes []pipeline.Pipeline) string {
+	typ := fmt.Sprintf("%T", pipe)
+	n := 0
+	for _, p := range pipes {
+		if fmt.Sprintf("%T", p) == typ {
+			n++
 		}
 	}
+	name := typ[strings.LastIndex(typ, ".")+1:]
+	if n > 1 {
+		name += "#" + strconv.Itoa(n)
+	}
+	return name
 }
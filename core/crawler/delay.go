@@ -0,0 +1,107 @@
+package crawler
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/logging"
+	"github.com/viixv/crawler/core/commons/page"
+	"github.com/viixv/crawler/core/commons/request"
+)
+
+// maxRetries is the number of times a request is scheduled again after a Retry-After.
+const maxRetries = 3
+
+// maxRetryAfter is the longest Retry-After honoured, the request fails on longer ones.
+const maxRetryAfter = time.Hour
+
+// SetHostDelay spaces the downloads of each host by at least d. Requests
+// taken too early are held by the scheduler until the turn of their host,
+// instead of sleeping in a goroutine. Default 0.
+func (this *Crawler) SetHostDelay(d time.Duration) *Crawler {
+	this.stateMutex.Lock()
+	defer this.stateMutex.Unlock()
+	this.hostDelay = d
+	return this
+}
+
+// holdForHost gives req the next turn of its host. When the turn is to come
+// it pushes a copy of req due then and returns true.
+func (this *Crawler) holdForHost(req *request.Request) bool {
+	this.stateMutex.Lock()
+	defer this.stateMutex.Unlock()
+	if this.turns[req] {
+		// Held already, this is its turn.
+		delete(this.turns, req)
+		return false
+	}
+	if this.hostDelay <= 0 {
+		return false
+	}
+	u, err := url.Parse(req.GetUrl())
+	if err != nil {
+		return false
+	}
+	if this.hostTurns == nil {
+		this.hostTurns = make(map[string]time.Time)
+		this.turns = make(map[*request.Request]bool)
+	}
+	now := time.Now()
+	turn := this.hostTurns[u.Host]
+	if turn.Before(now) {
+		turn = now
+	}
+	this.hostTurns[u.Host] = turn.Add(this.hostDelay)
+	if !turn.After(now) {
+		return false
+	}
+	held := *req
+	held.NotBefore = &turn
+	this.turns[&held] = true
+	this.queue.Push(&held)
+	return true
+}
+
+// retryLater schedules req again when p asks to come back later with a
+// Retry-After header, on 429 and 503 responses.
+func (this *Crawler) retryLater(req *request.Request, p *page.Page) bool {
+	if p.GetStatusCode() != http.StatusTooManyRequests && p.GetStatusCode() != http.StatusServiceUnavailable {
+		return false
+	}
+	delay, ok := retryAfter(p.GetHeader(), time.Now())
+	if !ok || delay <= 0 || delay > maxRetryAfter || req.Retries >= maxRetries {
+		return false
+	}
+	retry := *req
+	at := time.Now().Add(delay)
+	retry.NotBefore = &at
+	retry.Retries++
+	this.queue.Push(&retry)
+	this.stats.IncRetried()
+	this.log().Info("retry scheduled", append(logging.Request(req), "status", p.GetStatusCode(), "retry_after", delay)...)
+	return true
+}
+
+// retryAfter parses a Retry-After header, in seconds or an http date.
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/controller"
+	"github.com/viixv/crawler/core/commons/request"
+)
+
+// hostBusyDelay is how long a request of a busy host is put off when too many wait for it already.
+const hostBusyDelay = 250 * time.Millisecond
+
+func hostOf(req *request.Request) string {
+	if u, err := url.Parse(req.GetUrl()); err == nil {
+		return u.Host
+	}
+	return ""
+}
+
+// takeHost takes a slot of host for req when the controller limits hosts.
+// When the host is busy, req waits until a request of the host hands its
+// slot over, see handOff, and the caller frees its global slot. Once as many
+// requests wait for host as the controller runs at once, req is scheduled
+// again hostBusyDelay later instead, the scheduler is not emptied into the waiting lists.
+func (this *Crawler) takeHost(cc controller.GoroutineController, host string, req *request.Request) bool {
+	hl, ok := cc.(controller.HostLimiter)
+	if !ok {
+		return true
+	}
+	this.stateMutex.Lock()
+	if hl.TryGetHost(host) {
+		this.stateMutex.Unlock()
+		return true
+	}
+	if uint(len(this.hostWaiting[host])) < cc.Has()+cc.Left() {
+		if this.hostWaiting == nil {
+			this.hostWaiting = make(map[string][]*request.Request)
+		}
+		this.hostWaiting[host] = append(this.hostWaiting[host], req)
+		this.stateMutex.Unlock()
+		return false
+	}
+	this.stateMutex.Unlock()
+	held := *req
+	at := time.Now().Add(hostBusyDelay)
+	held.NotBefore = &at
+	this.queue.Push(&held)
+	this.done(req)
+	return false
+}
+
+// handOff frees the slot of host after a request of it is done, and returns
+// the next request waiting for host when the slot may go to it, nil otherwise.
+func (this *Crawler) handOff(cc controller.GoroutineController, host string) *request.Request {
+	hl, ok := cc.(controller.HostLimiter)
+	if !ok {
+		return nil
+	}
+	this.stateMutex.Lock()
+	defer this.stateMutex.Unlock()
+	hl.FreeHost(host)
+	// The limit of host may have shrunk, the other requests of host hand off later then.
+	reqs := this.hostWaiting[host]
+	if len(reqs) == 0 || !hl.TryGetHost(host) {
+		return nil
+	}
+	req := reqs[0]
+	reqs[0] = nil
+	if len(reqs) == 1 {
+		delete(this.hostWaiting, host)
+	} else {
+		this.hostWaiting[host] = reqs[1:]
+	}
+	return req
+}
@@ -0,0 +1,62 @@
+package crawler
+
+import (
+	"time"
+
+	"github.com/viixv/crawler/core/commons/logging"
+	"github.com/viixv/crawler/core/commons/page"
+	"github.com/viixv/crawler/core/commons/request"
+	"github.com/viixv/crawler/core/incremental"
+)
+
+// SetIncremental makes the crawl incremental: requests not due under the
+// revisit policy of t are skipped, pages are marked new, changed or unchanged,
+// and the items of unchanged pages are not handed to the pipelines unless
+// t emits them. Links of unchanged pages are still followed.
+func (this *Crawler) SetIncremental(t *incremental.Tracker) *Crawler {
+	this.incremental = t
+	return this
+}
+
+func (this *Crawler) GetIncremental() *incremental.Tracker {
+	return this.incremental
+}
+
+// notDue tells whether req is skipped by the revisit policy.
+func (this *Crawler) notDue(req *request.Request) bool {
+	if this.incremental == nil {
+		return false
+	}
+	due, err := this.incremental.Due(req, time.Now())
+	if err != nil {
+		this.log().Warn("incremental store failed", append(logging.Request(req), "error", err)...)
+	}
+	if !due {
+		this.stats.IncChange("not_due")
+		this.log().Debug("request not due", logging.Request(req)...)
+	}
+	return !due
+}
+
+// markChange marks p when the fingerprint of the tracker is taken from fingerprint.
+func (this *Crawler) markChange(p *page.Page, fingerprint string) {
+	if this.incremental == nil || this.incremental.Fingerprint() != fingerprint {
+		return
+	}
+	change, err := this.incremental.Mark(p)
+	if err != nil {
+		this.log().Warn("incremental store failed", append(logging.Request(p.GetRequest()), "error", err)...)
+	}
+	if change != "" {
+		this.stats.IncChange(change)
+	}
+}
+
+// dropUnchanged tells whether the items of p are kept from the pipelines.
+func (this *Crawler) dropUnchanged(p *page.Page) bool {
+	if this.incremental == nil || this.incremental.EmitUnchanged() || p.GetChange() != page.ChangeUnchanged {
+		return false
+	}
+	this.log().Debug("page unchanged", logging.Request(p.GetRequest())...)
+	return true
+}
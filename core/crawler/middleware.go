@@ -0,0 +1,61 @@
+package crawler
+
+import (
+	"github.com/viixv/crawler/core/commons/request"
+	"github.com/viixv/crawler/core/commons/result"
+	"github.com/viixv/crawler/core/commons/task"
+	"github.com/viixv/crawler/core/middleware"
+)
+
+// UseRequest adds middlewares run before each request is downloaded.
+func (this *Crawler) UseRequest(m ...middleware.RequestMiddleware) *Crawler {
+	this.middlewares.UseRequest(m...)
+	return this
+}
+
+// UseResponse adds middlewares run after each download attempt.
+func (this *Crawler) UseResponse(m ...middleware.ResponseMiddleware) *Crawler {
+	this.middlewares.UseResponse(m...)
+	return this
+}
+
+// UseItem adds middlewares run on the items of each page before the pipelines.
+func (this *Crawler) UseItem(m ...middleware.ItemMiddleware) *Crawler {
+	this.middlewares.UseItem(m...)
+	return this
+}
+
+// GetHooks returns the lifecycle hooks of the crawler.
+func (this *Crawler) GetHooks() *middleware.Hooks {
+	return this.hooks
+}
+
+func (this *Crawler) OnStart(f func(t task.Task)) *Crawler {
+	this.hooks.OnStart(f)
+	return this
+}
+
+func (this *Crawler) OnRequestScheduled(f func(req *request.Request)) *Crawler {
+	this.hooks.OnRequestScheduled(f)
+	return this
+}
+
+func (this *Crawler) OnError(f func(req *request.Request, err error)) *Crawler {
+	this.hooks.OnError(f)
+	return this
+}
+
+func (this *Crawler) OnItem(f func(items *result.ResultItems)) *Crawler {
+	this.hooks.OnItem(f)
+	return this
+}
+
+func (this *Crawler) OnIdle(f func(t task.Task)) *Crawler {
+	this.hooks.OnIdle(f)
+	return this
+}
+
+func (this *Crawler) OnFinish(f func(t task.Task)) *Crawler {
+	this.hooks.OnFinish(f)
+	return this
+}
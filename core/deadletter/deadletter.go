@@ -0,0 +1,209 @@
+// Package deadletter records requests the crawler gave up on, so that they can
+// be inspected and crawled again.
+package deadletter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/request"
+)
+
+// FailedRequest describes a request that failed its last download attempt or
+// whose processing panicked.
+type FailedRequest struct {
+	Task     string           `json:"task"`
+	Request  *request.Request `json:"request"`
+	Error    string           `json:"error"`
+	Status   int              `json:"status,omitempty"`
+	Attempts int              `json:"attempts"`
+	// Panic is set when the processor or a pipeline panicked, Stack holds its stack trace.
+	Panic bool      `json:"panic,omitempty"`
+	Stack string    `json:"stack,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// ErrorHandler receives failed requests. It is called from the crawler
+// goroutines and must be safe for concurrent use.
+type ErrorHandler interface {
+	HandleError(f *FailedRequest)
+}
+
+// HandlerFunc adapts a function to ErrorHandler.
+type HandlerFunc func(f *FailedRequest)
+
+func (this HandlerFunc) HandleError(f *FailedRequest) {
+	this(f)
+}
+
+// MultiHandler passes failed requests to each of its handlers.
+type MultiHandler []ErrorHandler
+
+func (this MultiHandler) HandleError(f *FailedRequest) {
+	for _, h := range this {
+		h.HandleError(f)
+	}
+}
+
+// MemoryHandler keeps the most recent failed requests in memory.
+type MemoryHandler struct {
+	mutex  sync.Mutex
+	max    int
+	total  int
+	failed []*FailedRequest
+}
+
+// NewMemoryHandler keeps at most max failed requests, all of them if max <= 0.
+func NewMemoryHandler(max int) *MemoryHandler {
+	return &MemoryHandler{max: max}
+}
+
+func (this *MemoryHandler) HandleError(f *FailedRequest) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.total++
+	this.failed = append(this.failed, f)
+	if this.max > 0 && len(this.failed) > this.max {
+		this.failed = append([]*FailedRequest(nil), this.failed[len(this.failed)-this.max:]...)
+	}
+}
+
+// All returns the kept failed requests, oldest first.
+func (this *MemoryHandler) All() []*FailedRequest {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return append([]*FailedRequest(nil), this.failed...)
+}
+
+// Recent returns up to n failed requests, newest first.
+func (this *MemoryHandler) Recent(n int) []*FailedRequest {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if n > len(this.failed) || n <= 0 {
+		n = len(this.failed)
+	}
+	recent := make([]*FailedRequest, 0, n)
+	for i := len(this.failed) - 1; i >= len(this.failed)-n; i-- {
+		recent = append(recent, this.failed[i])
+	}
+	return recent
+}
+
+// Total returns the number of failed requests received, including dropped ones.
+func (this *MemoryHandler) Total() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.total
+}
+
+// ChanHandler sends failed requests to a channel. Requests are dropped
+// instead of blocking the crawler when the channel is full.
+type ChanHandler struct {
+	c       chan *FailedRequest
+	mutex   sync.Mutex
+	dropped int
+}
+
+func NewChanHandler(size int) *ChanHandler {
+	return &ChanHandler{c: make(chan *FailedRequest, size)}
+}
+
+// C returns the channel failed requests are sent to.
+func (this *ChanHandler) C() <-chan *FailedRequest {
+	return this.c
+}
+
+func (this *ChanHandler) HandleError(f *FailedRequest) {
+	select {
+	case this.c <- f:
+	default:
+		this.mutex.Lock()
+		this.dropped++
+		this.mutex.Unlock()
+	}
+}
+
+// Dropped returns the number of failed requests dropped because the channel was full.
+func (this *ChanHandler) Dropped() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.dropped
+}
+
+// JsonLinesHandler appends failed requests to a file, one JSON object per line.
+type JsonLinesHandler struct {
+	mutex sync.Mutex
+	pFile *os.File
+	enc   *json.Encoder
+	err   error
+}
+
+func NewJsonLinesHandler(path string) (*JsonLinesHandler, error) {
+	pFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &JsonLinesHandler{pFile: pFile, enc: json.NewEncoder(pFile)}, nil
+}
+
+func (this *JsonLinesHandler) HandleError(f *FailedRequest) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if err := this.enc.Encode(f); err != nil && this.err == nil {
+		this.err = err
+	}
+}
+
+// Err returns the first write error.
+func (this *JsonLinesHandler) Err() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.err
+}
+
+// Close closes the underlying file.
+func (this *JsonLinesHandler) Close() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.pFile.Close()
+}
+
+// ReadJsonLines reads the failed requests written by a JsonLinesHandler.
+func ReadJsonLines(path string) ([]*FailedRequest, error) {
+	pFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer pFile.Close()
+
+	var failed []*FailedRequest
+	scanner := bufio.NewScanner(pFile)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		f := &FailedRequest{}
+		if err := json.Unmarshal(scanner.Bytes(), f); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err.Error())
+		}
+		if f.Request == nil || f.Request.GetUrl() == "" {
+			return nil, fmt.Errorf("%s:%d: record has no request url", path, line)
+		}
+		failed = append(failed, f)
+	}
+	return failed, scanner.Err()
+}
+
+// Requests returns the requests of the failed requests.
+func Requests(failed []*FailedRequest) []*request.Request {
+	reqs := make([]*request.Request, 0, len(failed))
+	for _, f := range failed {
+		reqs = append(reqs, f.Request)
+	}
+	return reqs
+}
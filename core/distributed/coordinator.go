@@ -0,0 +1,485 @@
+package distributed
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/logging"
+	"github.com/viixv/crawler/core/commons/request"
+	"github.com/viixv/crawler/core/commons/result"
+	"github.com/viixv/crawler/core/deadletter"
+	"github.com/viixv/crawler/core/pipeline"
+	"github.com/viixv/crawler/core/scheduler"
+)
+
+// MaxBodyBytes limits the size of request bodies.
+const MaxBodyBytes = 32 << 20
+
+type lease struct {
+	id       string
+	worker   string
+	requests []*request.Request
+	expires  time.Time
+}
+
+// Coordinator owns the frontier of a distributed crawl. It is safe for concurrent use.
+type Coordinator struct {
+	taskName   string
+	cScheduler scheduler.Scheduler
+	// queue is cScheduler, wrapped to hold the requests whose NotBefore is ahead.
+	queue        scheduler.Scheduler
+	dedupe       bool
+	ttl          time.Duration
+	maxBatch     int
+	pipelines    []pipeline.Pipeline
+	errorHandler deadletter.ErrorHandler
+	token        string
+	logger       *slog.Logger
+
+	mutex      sync.Mutex
+	seen       map[string]bool
+	leases     map[string]*lease
+	nextId     uint64
+	duplicates uint64
+	leased     uint64
+	completed  uint64
+	expired    uint64
+	failed     uint64
+	items      uint64
+	// reporting counts reports whose items are still on their way to the pipelines.
+	reporting int
+
+	mux    *http.ServeMux
+	server *http.Server
+	stop   chan struct{}
+	once   sync.Once
+	// expiring starts expireLoop with the first lease, once the coordinator is set up.
+	expiring sync.Once
+}
+
+// NewCoordinator creates a coordinator keeping the frontier in the scheduler.
+// Requests whose normalized url was already added are dropped, see SetDedupe,
+// so the scheduler should not remove duplicates itself: it would drop the
+// requests of expired leases when they are queued again. Requests with a
+// NotBefore are held until then, unless the scheduler is scheduler.Delayed.
+func NewCoordinator(taskName string, s scheduler.Scheduler) *Coordinator {
+	this := &Coordinator{
+		taskName:   taskName,
+		cScheduler: s,
+		queue:      s,
+		dedupe:     true,
+		ttl:        30 * time.Second,
+		maxBatch:   100,
+		pipelines:  make([]pipeline.Pipeline, 0),
+		seen:       make(map[string]bool),
+		leases:     make(map[string]*lease),
+		stop:       make(chan struct{}),
+	}
+	if _, ok := s.(scheduler.Delayed); !ok {
+		this.queue = scheduler.NewDelayScheduler(s)
+	}
+	this.mux = http.NewServeMux()
+	this.handle("/lease", "POST", this.serveLease)
+	this.handle("/extend", "POST", this.serveExtend)
+	this.handle("/report", "POST", this.serveReport)
+	this.handle("/requests", "POST", this.serveRequests)
+	this.handle("/status", "GET", this.serveStatus)
+	return this
+}
+
+func (this *Coordinator) TaskName() string {
+	return this.taskName
+}
+
+// SetDedupe turns the dedupe set on or off. Default on.
+func (this *Coordinator) SetDedupe(d bool) *Coordinator {
+	this.dedupe = d
+	return this
+}
+
+// SetLeaseTTL sets how long a worker may hold a lease without extending it. Default 30s.
+func (this *Coordinator) SetLeaseTTL(ttl time.Duration) *Coordinator {
+	this.ttl = ttl
+	return this
+}
+
+// SetMaxBatch caps the number of requests in one lease. Default 100.
+func (this *Coordinator) SetMaxBatch(n int) *Coordinator {
+	this.maxBatch = n
+	return this
+}
+
+// SetToken makes every call require "Authorization: Bearer <token>".
+func (this *Coordinator) SetToken(token string) *Coordinator {
+	this.token = token
+	return this
+}
+
+// AddPipeline adds a pipeline receiving the items reported by the workers.
+func (this *Coordinator) AddPipeline(p pipeline.Pipeline) *Coordinator {
+	this.pipelines = append(this.pipelines, p)
+	return this
+}
+
+// SetErrorHandler sets where requests the workers gave up on are reported.
+func (this *Coordinator) SetErrorHandler(h deadletter.ErrorHandler) *Coordinator {
+	this.errorHandler = h
+	return this
+}
+
+// SetLogger sets the logger of the coordinator, default is slog.Default().
+func (this *Coordinator) SetLogger(l *slog.Logger) {
+	this.logger = l
+}
+
+func (this *Coordinator) log() *slog.Logger {
+	return logging.Or(this.logger).With("task", this.taskName)
+}
+
+// AddRequest adds a request to the frontier unless it is a duplicate.
+func (this *Coordinator) AddRequest(req *request.Request) *Coordinator {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.addLocked(req)
+	return this
+}
+
+func (this *Coordinator) AddRequests(reqs []*request.Request) *Coordinator {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for _, req := range reqs {
+		this.addLocked(req)
+	}
+	return this
+}
+
+func (this *Coordinator) AddUrls(urls []string, respType string) *Coordinator {
+	for _, u := range urls {
+		this.AddRequest(request.New(u).RespType(respType).Build())
+	}
+	return this
+}
+
+func (this *Coordinator) addLocked(req *request.Request) {
+	if req == nil || req.GetUrl() == "" {
+		return
+	}
+	if this.dedupe {
+		key := req.Fingerprint()
+		if this.seen[key] {
+			this.duplicates++
+			return
+		}
+		this.seen[key] = true
+	}
+	this.queue.Push(req)
+}
+
+// Lease takes up to max requests from the frontier for the worker.
+func (this *Coordinator) Lease(worker string, max int) *Lease {
+	if max <= 0 || max > this.maxBatch {
+		max = this.maxBatch
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	var reqs []*request.Request
+	for len(reqs) < max {
+		req := this.queue.Poll()
+		if req == nil {
+			break
+		}
+		reqs = append(reqs, req)
+	}
+	if len(reqs) == 0 {
+		return &Lease{Done: this.doneLocked()}
+	}
+
+	this.expiring.Do(func() { go this.expireLoop() })
+	this.nextId++
+	l := &lease{id: fmt.Sprintf("%s-%d", worker, this.nextId), worker: worker, requests: reqs, expires: time.Now().Add(this.ttl)}
+	this.leases[l.id] = l
+	this.leased += uint64(len(reqs))
+	this.log().Debug("lease granted", "lease", l.id, "worker", worker, "requests", len(reqs))
+	return &Lease{Id: l.id, Requests: reqs, Expires: l.expires}
+}
+
+// Extend renews a lease, it fails when the lease expired or was reported.
+func (this *Coordinator) Extend(worker string, id string) (*Lease, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	l, ok := this.leases[id]
+	if !ok || l.worker != worker {
+		return nil, fmt.Errorf("lease %s is unknown or expired", id)
+	}
+	l.expires = time.Now().Add(this.ttl)
+	return &Lease{Id: l.id, Expires: l.expires}, nil
+}
+
+// Complete applies the results of a lease: target requests go to the
+// frontier, items to the pipelines and failures to the error handler.
+// Results of an expired lease are refused, its requests were re-queued.
+func (this *Coordinator) Complete(report *Report) error {
+	this.mutex.Lock()
+	l, ok := this.leases[report.Lease]
+	if !ok || l.worker != report.Worker {
+		this.mutex.Unlock()
+		return fmt.Errorf("lease %s is unknown or expired", report.Lease)
+	}
+	delete(this.leases, l.id)
+	this.ack(l.requests)
+	this.completed += uint64(len(l.requests))
+	for _, res := range report.Results {
+		for _, req := range res.Targets {
+			this.addLocked(req)
+		}
+		if res.Failed {
+			this.failed++
+		} else if res.Items != nil {
+			this.items++
+		}
+	}
+	this.reporting++
+	this.mutex.Unlock()
+	defer func() {
+		this.mutex.Lock()
+		this.reporting--
+		this.mutex.Unlock()
+	}()
+
+	for _, res := range report.Results {
+		if res.Failed {
+			this.log().Warn("request failed", "worker", report.Worker, "url", requestUrl(res.Request), "error", res.Error)
+			if this.errorHandler != nil {
+				this.errorHandler.HandleError(&deadletter.FailedRequest{Task: this.taskName, Request: res.Request, Error: res.Error,
+					Status: res.Status, Attempts: res.Attempts, Panic: res.Panic, Time: time.Now()})
+			}
+			continue
+		}
+		if res.Items == nil {
+			continue
+		}
+		items := result.NewResultItems(res.Request)
+		for k, v := range res.Items {
+			items.AddItem(k, v)
+		}
+		for _, pipe := range this.pipelines {
+			pipe.Process(items, this)
+		}
+	}
+	return nil
+}
+
+// ack tells a scheduler leasing the requests it hands out, e.g. a
+// RedisScheduler, that the coordinator is done with them. Otherwise they would
+// be handed out again once the lease of the scheduler expires.
+func (this *Coordinator) ack(reqs []*request.Request) {
+	acker, ok := this.cScheduler.(scheduler.Acker)
+	if !ok {
+		return
+	}
+	for _, req := range reqs {
+		acker.Ack(req)
+	}
+}
+
+// Status returns a snapshot of the frontier and the leases.
+func (this *Coordinator) Status() *Status {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	inFlight := 0
+	for _, l := range this.leases {
+		inFlight += len(l.requests)
+	}
+	return &Status{
+		Task:       this.taskName,
+		Queue:      this.queue.Count(),
+		Leases:     len(this.leases),
+		InFlight:   inFlight,
+		Seen:       len(this.seen),
+		Duplicates: this.duplicates,
+		Leased:     this.leased,
+		Completed:  this.completed,
+		Expired:    this.expired,
+		Failed:     this.failed,
+		Items:      this.items,
+		Done:       this.doneLocked(),
+	}
+}
+
+func (this *Coordinator) doneLocked() bool {
+	return this.queue.Count() == 0 && len(this.leases) == 0 && this.reporting == 0
+}
+
+// Wait blocks until the frontier is empty and no lease is out.
+func (this *Coordinator) Wait() {
+	for {
+		if this.Status().Done {
+			return
+		}
+		select {
+		case <-this.stop:
+			return
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// expireLoop puts the requests of expired leases back into the frontier.
+func (this *Coordinator) expireLoop() {
+	for {
+		interval := this.ttl / 4
+		if interval < 50*time.Millisecond {
+			interval = 50 * time.Millisecond
+		}
+		select {
+		case <-this.stop:
+			return
+		case <-time.After(interval):
+		}
+
+		now := time.Now()
+		this.mutex.Lock()
+		for id, l := range this.leases {
+			if now.Before(l.expires) {
+				continue
+			}
+			delete(this.leases, id)
+			this.expired += uint64(len(l.requests))
+			// The scheduler lease is released before the requests are queued again.
+			this.ack(l.requests)
+			for _, req := range l.requests {
+				this.queue.Push(req)
+			}
+			this.log().Warn("lease expired, requests re-queued", "lease", id, "worker", l.worker, "requests", len(l.requests))
+		}
+		this.mutex.Unlock()
+	}
+}
+
+func (this *Coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	this.mux.ServeHTTP(w, r)
+}
+
+// Start listens on addr and serves the workers in the background. It returns
+// the address listened on, useful with port 0.
+func (this *Coordinator) Start(addr string) (string, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	this.server = &http.Server{Handler: this}
+	go func() {
+		if err := this.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			this.log().Error("coordinator server failed", "addr", addr, "error", err)
+		}
+	}()
+	this.log().Info("coordinator listening", "addr", ln.Addr().String())
+	return ln.Addr().String(), nil
+}
+
+// Close stops the server and the lease expiry.
+func (this *Coordinator) Close() error {
+	this.once.Do(func() { close(this.stop) })
+	if this.server == nil {
+		return nil
+	}
+	return this.server.Close()
+}
+
+func (this *Coordinator) handle(pattern string, method string, f http.HandlerFunc) {
+	this.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, "method %s not allowed, use %s", r.Method, method)
+			return
+		}
+		if this.token != "" {
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(this.token)) != 1 {
+				writeError(w, http.StatusUnauthorized, "missing or wrong token")
+				return
+			}
+		}
+		f(w, r)
+	})
+}
+
+func (this *Coordinator) serveLease(w http.ResponseWriter, r *http.Request) {
+	lr := &LeaseRequest{}
+	if !decode(w, r, lr) {
+		return
+	}
+	writeJson(w, http.StatusOK, this.Lease(lr.Worker, lr.Max))
+}
+
+func (this *Coordinator) serveExtend(w http.ResponseWriter, r *http.Request) {
+	er := &ExtendRequest{}
+	if !decode(w, r, er) {
+		return
+	}
+	l, err := this.Extend(er.Worker, er.Lease)
+	if err != nil {
+		writeError(w, http.StatusGone, "%s", err.Error())
+		return
+	}
+	writeJson(w, http.StatusOK, l)
+}
+
+func (this *Coordinator) serveReport(w http.ResponseWriter, r *http.Request) {
+	report := &Report{}
+	if !decode(w, r, report) {
+		return
+	}
+	if err := this.Complete(report); err != nil {
+		writeError(w, http.StatusGone, "%s", err.Error())
+		return
+	}
+	writeJson(w, http.StatusOK, this.Status())
+}
+
+func (this *Coordinator) serveRequests(w http.ResponseWriter, r *http.Request) {
+	var reqs []*request.Request
+	if !decode(w, r, &reqs) {
+		return
+	}
+	this.AddRequests(reqs)
+	writeJson(w, http.StatusAccepted, this.Status())
+}
+
+func (this *Coordinator) serveStatus(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, this.Status())
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(io.LimitReader(r.Body, MaxBodyBytes)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "decode body: %s", err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJson(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+func requestUrl(req *request.Request) string {
+	if req == nil {
+		return ""
+	}
+	return req.GetUrl()
+}
@@ -0,0 +1,265 @@
+package distributed
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/page"
+	"github.com/viixv/crawler/core/commons/request"
+	"github.com/viixv/crawler/core/commons/result"
+	"github.com/viixv/crawler/core/commons/task"
+	"github.com/viixv/crawler/core/scheduler"
+)
+
+var quiet = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// counter counts the pages processed and the items received by url.
+type counter struct {
+	mutex     sync.Mutex
+	processed map[string]int
+	items     map[string]int
+}
+
+func newCounter() *counter {
+	return &counter{processed: make(map[string]int), items: make(map[string]int)}
+}
+
+func (this *counter) count(m map[string]int, url string) {
+	this.mutex.Lock()
+	m[url]++
+	this.mutex.Unlock()
+}
+
+// check fails unless each of urls was processed and received exactly once.
+func (this *counter) check(t *testing.T, urls []string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for _, u := range urls {
+		if n, m := this.processed[u], this.items[u]; n != 1 || m != 1 {
+			t.Errorf("%s processed %d times, its items received %d times, want 1", u, n, m)
+		}
+	}
+	if len(this.processed) != len(urls) || len(this.items) != len(urls) {
+		t.Errorf("%d pages processed, %d received, want %d", len(this.processed), len(this.items), len(urls))
+	}
+}
+
+// linkProcessor follows the links of the test site: page n links to n+1 and 2n.
+type linkProcessor struct {
+	counter *counter
+	base    string
+	pages   int
+}
+
+func (this *linkProcessor) Process(p *page.Page) {
+	url := p.GetRequest().GetUrl()
+	this.counter.count(this.counter.processed, url)
+	p.AddField("url", url)
+	n, err := strconv.Atoi(url[strings.LastIndex(url, "/")+1:])
+	if err != nil {
+		return
+	}
+	for _, next := range []int{n + 1, 2 * n} {
+		if next < this.pages {
+			p.AddTargetRequest(fmt.Sprintf("%s/page/%d", this.base, next), "html")
+		}
+	}
+}
+
+func (this *linkProcessor) Finish() {}
+
+// itemPipeline counts the items the coordinator receives.
+type itemPipeline struct {
+	counter *counter
+}
+
+func (this *itemPipeline) Process(items *result.ResultItems, t task.Task) {
+	this.counter.count(this.counter.items, items.GetRequest().GetUrl())
+}
+
+func newSite(t *testing.T) *httptest.Server {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><body>%s</body></html>", r.URL.Path)
+	}))
+	t.Cleanup(site.Close)
+	return site
+}
+
+func pageUrls(base string, pages int) []string {
+	urls := make([]string, pages)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%s/page/%d", base, i)
+	}
+	return urls
+}
+
+func startCoordinator(t *testing.T, c *Coordinator) string {
+	c.SetLogger(quiet)
+	addr, err := c.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return "http://" + addr
+}
+
+// runWorkers runs the workers until the crawl is done, or fails the test after timeout.
+func runWorkers(t *testing.T, timeout time.Duration, workers ...*Worker) {
+	errs := make(chan error, len(workers))
+	for _, w := range workers {
+		w.SetLogger(quiet)
+		go func(w *Worker) {
+			errs <- w.Run()
+		}(w)
+	}
+	deadline := time.After(timeout)
+	for range workers {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-deadline:
+			for _, w := range workers {
+				w.Stop()
+			}
+			t.Fatal("the crawl did not complete in time")
+		}
+	}
+}
+
+func TestCoordinatorWorkers(t *testing.T) {
+	const pages = 40
+	site := newSite(t)
+	counter := newCounter()
+	c := NewCoordinator("test", scheduler.NewQueueScheduler(false)).SetMaxBatch(3)
+	c.AddPipeline(&itemPipeline{counter: counter})
+	base := startCoordinator(t, c)
+	c.AddUrls([]string{site.URL + "/page/0"}, "html")
+
+	var workers []*Worker
+	for i := 0; i < 3; i++ {
+		w := NewWorker(base, fmt.Sprintf("w%d", i), &linkProcessor{counter: counter, base: site.URL, pages: pages})
+		workers = append(workers, w.SetThreadnum(2).SetBatchSize(3))
+	}
+	runWorkers(t, 30*time.Second, workers...)
+
+	counter.check(t, pageUrls(site.URL, pages))
+	status := c.Status()
+	if !status.Done || status.Completed != pages || status.Expired != 0 || status.Items != pages {
+		t.Errorf("status = %+v, want %d pages completed", status, pages)
+	}
+}
+
+// stallDownloader blocks until release is closed, as a worker hanging on a download.
+type stallDownloader struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (this *stallDownloader) Download(req *request.Request) *page.Page {
+	this.once.Do(func() { close(this.started) })
+	<-this.release
+	p := page.NewPage(req)
+	p.SetStatus(true, "worker killed")
+	return p
+}
+
+// killTransport cuts a worker from the coordinator once killed, as if its process died.
+type killTransport struct {
+	mutex  sync.Mutex
+	killed bool
+}
+
+func (this *killTransport) kill() {
+	this.mutex.Lock()
+	this.killed = true
+	this.mutex.Unlock()
+}
+
+func (this *killTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	this.mutex.Lock()
+	killed := this.killed
+	this.mutex.Unlock()
+	if killed {
+		return nil, errors.New("worker killed")
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestCoordinatorRequeuesExpiredLease(t *testing.T) {
+	const pages = 6
+	site := newSite(t)
+	counter := newCounter()
+	c := NewCoordinator("test", scheduler.NewQueueScheduler(false)).SetLeaseTTL(300 * time.Millisecond)
+	c.AddPipeline(&itemPipeline{counter: counter})
+	base := startCoordinator(t, c)
+	urls := pageUrls(site.URL, pages)
+	c.AddUrls(urls, "html")
+
+	// The first worker leases two pages and dies while downloading them.
+	stall := &stallDownloader{started: make(chan struct{}), release: make(chan struct{})}
+	transport := &killTransport{}
+	dead := NewWorker(base, "dead", &linkProcessor{counter: newCounter()}).SetBatchSize(2).SetDownloader(stall).
+		SetHttpClient(&http.Client{Transport: transport, Timeout: 5 * time.Second})
+	dead.SetLogger(quiet)
+	deadDone := make(chan struct{})
+	go func() {
+		dead.Run()
+		close(deadDone)
+	}()
+	defer func() {
+		dead.Stop()
+		close(stall.release)
+		<-deadDone
+	}()
+	select {
+	case <-stall.started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the first worker did not lease")
+	}
+	transport.kill()
+	if status := c.Status(); status.Leases != 1 || status.InFlight != 2 {
+		t.Fatalf("status = %+v, want the 2 requests of the first worker in flight", status)
+	}
+
+	alive := NewWorker(base, "alive", &linkProcessor{counter: counter})
+	runWorkers(t, 30*time.Second, alive)
+
+	counter.check(t, urls)
+	status := c.Status()
+	if status.Expired != 2 || status.Completed != pages || status.Leases != 0 {
+		t.Errorf("status = %+v, want the 2 requests of the expired lease crawled by the other worker", status)
+	}
+}
+
+func TestCoordinatorHoldsDelayedRequests(t *testing.T) {
+	c := NewCoordinator("test", scheduler.NewQueueScheduler(false))
+	defer c.Close()
+	c.AddRequest(request.New("http://example.com/later").After(200 * time.Millisecond).Build())
+	c.AddUrls([]string{"http://example.com/now"}, "html")
+
+	l := c.Lease("w", 10)
+	if len(l.Requests) != 1 || l.Requests[0].GetUrl() != "http://example.com/now" {
+		t.Fatalf("lease = %+v, want the request that is due only", l)
+	}
+	c.Complete(&Report{Worker: "w", Lease: l.Id})
+	if l := c.Lease("w", 10); len(l.Requests) != 0 || l.Done {
+		t.Fatalf("lease = %+v, want nothing yet and the crawl not done", l)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if l := c.Lease("w", 10); len(l.Requests) != 1 || l.Requests[0].GetUrl() != "http://example.com/later" {
+		t.Fatalf("lease = %+v, want the delayed request once due", l)
+	}
+}
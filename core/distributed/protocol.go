@@ -0,0 +1,78 @@
+// Package distributed spreads a crawl over several processes or machines.
+//
+// A Coordinator owns the frontier and the dedupe set and serves them over
+// HTTP with JSON bodies. Workers lease batches of requests, download and
+// process them, and report the target requests and items of each page back.
+// A lease that is neither extended nor reported before its TTL expires, e.g.
+// because its worker died, is put back into the frontier.
+//
+//	POST /lease     LeaseRequest -> Lease
+//	POST /extend    ExtendRequest -> Lease
+//	POST /report    Report
+//	POST /requests  request.Request array, seeds from outside
+//	GET  /status    Status
+package distributed
+
+import (
+	"time"
+
+	"github.com/viixv/crawler/core/commons/request"
+)
+
+// LeaseRequest asks the coordinator for up to Max requests.
+type LeaseRequest struct {
+	Worker string `json:"worker"`
+	Max    int    `json:"max"`
+}
+
+// Lease is a batch of requests handed to one worker until Expires.
+// An empty lease has no Id; Done is set when the crawl is complete.
+type Lease struct {
+	Id       string             `json:"id,omitempty"`
+	Requests []*request.Request `json:"requests,omitempty"`
+	Expires  time.Time          `json:"expires"`
+	Done     bool               `json:"done"`
+}
+
+// ExtendRequest keeps a lease alive while its requests are processed.
+type ExtendRequest struct {
+	Worker string `json:"worker"`
+	Lease  string `json:"lease"`
+}
+
+// Report completes a lease with one Result per leased request.
+type Report struct {
+	Worker  string    `json:"worker"`
+	Lease   string    `json:"lease"`
+	Results []*Result `json:"results"`
+}
+
+// Result is what a worker got out of one request.
+type Result struct {
+	Request *request.Request `json:"request"`
+	// Targets are the requests the page asked to crawl next.
+	Targets []*request.Request `json:"targets,omitempty"`
+	// Items are the fields of the page, nil when the page was skipped.
+	Items    map[string]string `json:"items,omitempty"`
+	Failed   bool              `json:"failed,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Status   int               `json:"status,omitempty"`
+	Attempts int               `json:"attempts,omitempty"`
+	Panic    bool              `json:"panic,omitempty"`
+}
+
+// Status is a snapshot of the coordinator.
+type Status struct {
+	Task       string `json:"task"`
+	Queue      int    `json:"queue"`
+	Leases     int    `json:"leases"`
+	InFlight   int    `json:"in_flight"`
+	Seen       int    `json:"seen"`
+	Duplicates uint64 `json:"duplicates"`
+	Leased     uint64 `json:"leased"`
+	Completed  uint64 `json:"completed"`
+	Expired    uint64 `json:"expired"`
+	Failed     uint64 `json:"failed"`
+	Items      uint64 `json:"items"`
+	Done       bool   `json:"done"`
+}
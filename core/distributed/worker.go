@@ -0,0 +1,294 @@
+package distributed
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/controller"
+	"github.com/viixv/crawler/core/commons/logging"
+	"github.com/viixv/crawler/core/commons/request"
+	"github.com/viixv/crawler/core/downloader"
+	"github.com/viixv/crawler/core/processor"
+)
+
+// errLeaseGone is returned when the coordinator no longer knows a lease.
+var errLeaseGone = errors.New("lease gone")
+
+// Worker leases requests from a coordinator, downloads and processes them
+// and reports the results back.
+type Worker struct {
+	coordinator   string
+	name          string
+	token         string
+	pageProcessor processor.PageProcessor
+	cDownloader   downloader.Downloader
+	goroutines    uint
+	batch         int
+	exitWhenDone  bool
+	maxFailures   int
+	limits        *request.Limits
+	client        *http.Client
+	logger        *slog.Logger
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewWorker creates a worker of the coordinator at base url coordinator,
+// e.g. http://10.0.0.1:7070. The name must be unique among the workers.
+func NewWorker(coordinator string, name string, pageProcessor processor.PageProcessor) *Worker {
+	return &Worker{
+		coordinator:   strings.TrimRight(coordinator, "/"),
+		name:          name,
+		pageProcessor: pageProcessor,
+		cDownloader:   downloader.NewHttpDownloader(),
+		goroutines:    1,
+		batch:         10,
+		exitWhenDone:  true,
+		maxFailures:   10,
+		client:        &http.Client{Timeout: 30 * time.Second},
+		stop:          make(chan struct{}),
+	}
+}
+
+// SetToken sets the token the coordinator expects.
+func (this *Worker) SetToken(token string) *Worker {
+	this.token = token
+	return this
+}
+
+func (this *Worker) SetDownloader(d downloader.Downloader) *Worker {
+	this.cDownloader = d
+	return this
+}
+
+// SetRequestLimits sets the timeout, body size limit and redirect policy of
+// the requests that do not set their own, see crawler.Crawler.SetRequestLimits.
+func (this *Worker) SetRequestLimits(l *request.Limits) *Worker {
+	this.limits = l
+	return this
+}
+
+// SetHttpClient sets the client used to talk to the coordinator.
+func (this *Worker) SetHttpClient(c *http.Client) *Worker {
+	this.client = c
+	return this
+}
+
+// SetThreadnum sets the number of requests of a lease processed at once.
+func (this *Worker) SetThreadnum(i uint) *Worker {
+	if i > 0 {
+		this.goroutines = i
+	}
+	return this
+}
+
+// SetBatchSize sets the number of requests asked for in one lease. Default 10.
+func (this *Worker) SetBatchSize(n int) *Worker {
+	this.batch = n
+	return this
+}
+
+// SetExitWhenDone makes Run return when the coordinator reports the crawl
+// complete. Default true; otherwise the worker waits for more requests until Stop.
+func (this *Worker) SetExitWhenDone(e bool) *Worker {
+	this.exitWhenDone = e
+	return this
+}
+
+// SetLogger sets the logger of the worker, default is slog.Default().
+// It is passed on to the downloader and processor implementing logging.Setter.
+func (this *Worker) SetLogger(l *slog.Logger) {
+	this.logger = l
+	for _, c := range []interface{}{this.cDownloader, this.pageProcessor} {
+		if s, ok := c.(logging.Setter); ok {
+			s.SetLogger(this.log())
+		}
+	}
+}
+
+func (this *Worker) log() *slog.Logger {
+	return logging.Or(this.logger).With("worker", this.name)
+}
+
+// Stop makes Run return after the current lease.
+func (this *Worker) Stop() {
+	this.once.Do(func() { close(this.stop) })
+}
+
+func (this *Worker) stopped() bool {
+	select {
+	case <-this.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run leases and processes requests until the crawl is done or Stop is
+// called. It fails when the coordinator cannot be reached several times in a row.
+func (this *Worker) Run() error {
+	defer this.pageProcessor.Finish()
+	this.log().Info("worker started", "coordinator", this.coordinator)
+	failures := 0
+	for !this.stopped() {
+		l := &Lease{}
+		err := this.call("/lease", &LeaseRequest{Worker: this.name, Max: this.batch}, l)
+		if err != nil {
+			failures++
+			if failures >= this.maxFailures {
+				return fmt.Errorf("coordinator unreachable: %s", err.Error())
+			}
+			this.log().Warn("lease failed", "error", err, "failures", failures)
+			this.wait(time.Second)
+			continue
+		}
+		failures = 0
+
+		if l.Id == "" {
+			if l.Done && this.exitWhenDone {
+				this.log().Info("crawl done")
+				return nil
+			}
+			this.wait(500 * time.Millisecond)
+			continue
+		}
+		this.runLease(l)
+	}
+	return nil
+}
+
+func (this *Worker) wait(d time.Duration) {
+	select {
+	case <-this.stop:
+	case <-time.After(d):
+	}
+}
+
+func (this *Worker) runLease(l *Lease) {
+	this.log().Debug("lease started", "lease", l.Id, "requests", len(l.Requests))
+	done := make(chan struct{})
+	go this.keepAlive(l, done)
+
+	results := make([]*Result, len(l.Requests))
+	cc := controller.NewGoroutineControllerChan(this.goroutines)
+	var wg sync.WaitGroup
+	for i, req := range l.Requests {
+		cc.GetOne()
+		wg.Add(1)
+		go func(i int, req *request.Request) {
+			defer wg.Done()
+			defer cc.FreeOne()
+			results[i] = this.process(req)
+		}(i, req)
+	}
+	wg.Wait()
+	close(done)
+
+	err := this.call("/report", &Report{Worker: this.name, Lease: l.Id, Results: results}, nil)
+	if err != nil {
+		this.log().Warn("report refused, the requests will be crawled again", "lease", l.Id, "error", err)
+		return
+	}
+	this.log().Debug("lease reported", "lease", l.Id)
+}
+
+// keepAlive extends the lease at a third of its remaining time until done is closed.
+func (this *Worker) keepAlive(l *Lease, done chan struct{}) {
+	expires := l.Expires
+	for {
+		interval := time.Until(expires) / 3
+		if interval < 50*time.Millisecond {
+			interval = 50 * time.Millisecond
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+		ext := &Lease{}
+		if err := this.call("/extend", &ExtendRequest{Worker: this.name, Lease: l.Id}, ext); err != nil {
+			this.log().Warn("lease extension failed", "lease", l.Id, "error", err)
+			if err == errLeaseGone {
+				return
+			}
+			continue
+		}
+		expires = ext.Expires
+	}
+}
+
+// process downloads a request with up to 3 attempts and runs the processor on it.
+func (this *Worker) process(req *request.Request) (res *Result) {
+	res = &Result{Request: req}
+	defer func() {
+		if err := recover(); err != nil {
+			this.log().Error("page process panic", append(logging.Request(req), "error", fmt.Sprint(err))...)
+			res = &Result{Request: req, Failed: true, Error: fmt.Sprint(err), Attempts: res.Attempts, Panic: true}
+		}
+	}()
+
+	if this.limits != nil {
+		this.limits.Apply(req)
+	}
+	p := this.cDownloader.Download(req)
+	res.Attempts = 1
+	for ; !p.IsSucc() && res.Attempts < 3; res.Attempts++ {
+		p = this.cDownloader.Download(req)
+	}
+	if !p.IsSucc() {
+		res.Failed = true
+		res.Error = p.Errormsg()
+		res.Status = p.GetStatusCode()
+		return res
+	}
+
+	this.pageProcessor.Process(p)
+	res.Targets = p.GetTargetRequests()
+	if !p.GetSkip() {
+		res.Items = p.GetPageItems().GetAll()
+	}
+	return res
+}
+
+func (this *Worker) call(path string, in interface{}, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequest("POST", this.coordinator+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if this.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+this.token)
+	}
+	resp, err := this.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusGone {
+		return errLeaseGone
+	}
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("%s: %s %s", path, resp.Status, e.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -1,30 +1,50 @@
 package downloader
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/bitly/go-simplejson"
+	"github.com/viixv/crawler/core/commons/feed"
+	"github.com/viixv/crawler/core/commons/logging"
 	"github.com/viixv/crawler/core/commons/page"
 	"github.com/viixv/crawler/core/commons/request"
 	"github.com/viixv/crawler/core/commons/utils"
+	"github.com/viixv/crawler/core/commons/xmldoc"
 	"golang.org/x/net/html/charset"
 )
 
 type HttpDownloader struct {
+	logger *slog.Logger
 }
 
 func NewHttpDownloader() *HttpDownloader {
 	return &HttpDownloader{}
 }
 
+// SetLogger sets the logger of the downloader, default is slog.Default().
+func (this *HttpDownloader) SetLogger(l *slog.Logger) {
+	this.logger = l
+}
+
+func (this *HttpDownloader) log() *slog.Logger {
+	return logging.Or(this.logger)
+}
+
 func (this *HttpDownloader) Download(req *request.Request) *page.Page {
 	var respType string
 	var p = page.NewPage(req)
@@ -38,49 +58,56 @@ func (this *HttpDownloader) Download(req *request.Request) *page.Page {
 		return this.downloadJson(p, req)
 	case "text":
 		return this.downloadText(p, req)
+	case "feed":
+		return this.downloadFeed(p, req)
+	case "xml":
+		return this.downloadXml(p, req)
 	default:
-		log.Println("error request type:" + respType)
+		this.log().Error("unknown response type", append(logging.Request(req), "resp_type", respType)...)
+		p.SetStatus(true, "error request type:"+respType)
 	}
 	return p
 }
 
-// Charset auto determine. Use golang.org/x/net/html/charset. Get page body and change it to utf-8
-func (this *HttpDownloader) changeCharsetEncodingAuto(contentTypeStr string, sor io.ReadCloser) string {
+// Charset auto determine. Use golang.org/x/net/html/charset. Get page body and change it to utf-8.
+// At most limit bytes are read when limit is positive, truncated tells whether the body was longer.
+// The encoding of the xml declaration is used when sniffXml is set and the content type has no charset.
+func (this *HttpDownloader) changeCharsetEncodingAuto(contentTypeStr string, sor io.ReadCloser, limit int64, sniffXml bool) (string, bool, error) {
 	var err error
-	destReader, err := charset.NewReader(sor, contentTypeStr)
+	destReader, err := newCharsetReader(sor, contentTypeStr, sniffXml)
 
 	if err != nil {
-		log.Println(err.Error())
+		this.log().Debug("charset detection failed", "content_type", contentTypeStr, "error", err)
 		destReader = sor
 	}
 
-	var sorbody []byte
-	if sorbody, err = ioutil.ReadAll(destReader); err != nil {
-		log.Println(err.Error())
+	sorbody, truncated, err := readLimited(destReader, limit)
+	if err != nil {
+		this.log().Debug("read body failed", "error", err)
 	}
 	bodystr := string(sorbody)
 
-	return bodystr
+	return bodystr, truncated, err
 }
 
-func (this *HttpDownloader) changeCharsetEncodingAutoGzipSupport(contentTypeStr string, sor io.ReadCloser) string {
+func (this *HttpDownloader) changeCharsetEncodingAutoGzipSupport(contentTypeStr string, sor io.ReadCloser, limit int64, sniffXml bool) (string, bool, error) {
 	var err error
 	gzipReader, err := gzip.NewReader(sor)
 	if err != nil {
-		log.Println(err.Error())
-		return ""
+		this.log().Debug("gzip body is invalid", "error", err)
+		return "", false, nil
 	}
 	defer gzipReader.Close()
-	destReader, err := charset.NewReader(gzipReader, contentTypeStr)
+	destReader, err := newCharsetReader(gzipReader, contentTypeStr, sniffXml)
 
 	if err != nil {
-		log.Println(err.Error())
+		this.log().Debug("charset detection failed", "content_type", contentTypeStr, "error", err)
 		destReader = sor
 	}
 
-	var sorbody []byte
-	if sorbody, err = ioutil.ReadAll(destReader); err != nil {
-		log.Println(err.Error())
+	sorbody, truncated, err := readLimited(destReader, limit)
+	if err != nil {
+		this.log().Debug("read body failed", "error", err)
 		// For gb2312, an error will be returned.
 		// Error like: simplifiedchinese: invalid GBK encoding
 		// return ""
@@ -88,13 +115,73 @@ func (this *HttpDownloader) changeCharsetEncodingAutoGzipSupport(contentTypeStr
 	//e,name,certain := charset.DetermineEncoding(sorbody,contentTypeStr)
 	bodystr := string(sorbody)
 
-	return bodystr
+	return bodystr, truncated, err
+}
+
+var xmlEncoding = regexp.MustCompile(`^\s*<\?xml[^>]*\sencoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+// newCharsetReader is charset.NewReader, which finds the charset of html pages
+// only. With sniffXml the encoding of the xml declaration is used when the
+// content type has no charset.
+func newCharsetReader(r io.Reader, contentType string, sniffXml bool) (io.Reader, error) {
+	if sniffXml {
+		if _, params, err := mime.ParseMediaType(contentType); err != nil || params["charset"] == "" {
+			br := bufio.NewReader(r)
+			head, _ := br.Peek(1024)
+			head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+			if m := xmlEncoding.FindSubmatch(head); m != nil {
+				contentType = "text/xml; charset=" + string(m[1])
+			}
+			r = br
+		}
+	}
+	return charset.NewReader(r, contentType)
+}
+
+// readLimited reads r to the end, or its first limit bytes when limit is
+// positive. A rune cut at the limit is dropped.
+func readLimited(r io.Reader, limit int64) ([]byte, bool, error) {
+	if limit <= 0 {
+		body, err := ioutil.ReadAll(r)
+		return body, false, err
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if int64(len(body)) <= limit {
+		return body, false, err
+	}
+	body = body[:limit]
+	for i := 0; i < utf8.UTFMax && len(body) > 0; i++ {
+		if r, size := utf8.DecodeLastRune(body); r != utf8.RuneError || size != 1 {
+			break
+		}
+		body = body[:len(body)-1]
+	}
+	return body, true, err
+}
+
+// isTimeout tells whether err is a timeout, e.g. Request.Timeout passed while reading the body.
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// redirectChain returns the redirect responses that led to resp, oldest first.
+func redirectChain(resp *http.Response) []page.Redirect {
+	var chain []page.Redirect
+	for r := resp.Request; r != nil && r.Response != nil; r = r.Response.Request {
+		if r.Response.Request == nil || r.Response.Request.URL == nil {
+			break
+		}
+		chain = append([]page.Redirect{{Url: r.Response.Request.URL.String(), StatusCode: r.Response.StatusCode}}, chain...)
+	}
+	return chain
 }
 
 // choose http GET/method to download
 func connectByHttp(p *page.Page, req *request.Request) (*http.Response, error) {
 	client := &http.Client{
 		CheckRedirect: req.GetRedirectFunc(),
+		Timeout:       req.GetTimeout(),
 	}
 
 	httpReq, err := http.NewRequest(req.GetMethod(), req.GetUrl(), strings.NewReader(req.GetPostdata()))
@@ -113,7 +200,6 @@ func connectByHttp(p *page.Page, req *request.Request) (*http.Response, error) {
 	if resp, err = client.Do(httpReq); err != nil {
 		if e, ok := err.(*url.Error); ok && e.Err != nil && e.Err.Error() == "normal" {
 		} else {
-			log.Println(err.Error())
 			p.SetStatus(true, err.Error())
 			return nil, err
 		}
@@ -134,6 +220,8 @@ func connectByHttpProxy(p *page.Page, req *request.Request) (*http.Response, err
 		Transport: &http.Transport{
 			Proxy: http.ProxyURL(proxy),
 		},
+		CheckRedirect: req.GetRedirectFunc(),
+		Timeout:       req.GetTimeout(),
 	}
 	resp, err := client.Do(httpReq)
 	if err != nil {
@@ -148,7 +236,7 @@ func (this *HttpDownloader) downloadFile(p *page.Page, req *request.Request) (*p
 	var err error
 	var urlstr string
 	if urlstr = req.GetUrl(); len(urlstr) == 0 {
-		log.Println("url is empty")
+		this.log().Warn("url is empty")
 		p.SetStatus(true, "url is empty")
 		return p, ""
 	}
@@ -162,40 +250,123 @@ func (this *HttpDownloader) downloadFile(p *page.Page, req *request.Request) (*p
 	}
 
 	if err != nil {
+		p.SetStatus(true, err.Error())
+		this.log().Debug("download failed", append(logging.Request(req), "error", err)...)
 		return p, ""
 	}
 
 	p.SetHeader(resp.Header)
 	p.SetCookies(resp.Cookies())
+	p.SetStatusCode(resp.StatusCode)
+	if resp.Request != nil && resp.Request.URL != nil {
+		p.SetFinalUrl(resp.Request.URL.String())
+	}
+	p.SetRedirects(redirectChain(resp))
+	defer resp.Body.Close()
+
+	limit := req.GetMaxBodyBytes()
+	if limit > 0 && req.GetBodyLimit() == request.BodyFail && resp.ContentLength > limit {
+		p.SetStatus(true, fmt.Sprintf("response body of %d bytes exceeds the limit of %d bytes", resp.ContentLength, limit))
+		return p, ""
+	}
 
 	var bodyStr string
+	var truncated bool
+	sniffXml := req.GetResponceType() == "feed" || req.GetResponceType() == "xml"
 	if resp.Header.Get("Content-Encoding") == "gzip" {
-		bodyStr = this.changeCharsetEncodingAutoGzipSupport(resp.Header.Get("Content-Type"), resp.Body)
+		bodyStr, truncated, err = this.changeCharsetEncodingAutoGzipSupport(resp.Header.Get("Content-Type"), resp.Body, limit, sniffXml)
 	} else {
-		bodyStr = this.changeCharsetEncodingAuto(resp.Header.Get("Content-Type"), resp.Body)
+		bodyStr, truncated, err = this.changeCharsetEncodingAuto(resp.Header.Get("Content-Type"), resp.Body, limit, sniffXml)
+	}
+	if err != nil && isTimeout(err) {
+		p.SetStatus(true, err.Error())
+		return p, ""
+	}
+	if truncated {
+		if req.GetBodyLimit() == request.BodyFail {
+			p.SetStatus(true, fmt.Sprintf("response body exceeds the limit of %d bytes", limit))
+			return p, ""
+		}
+		this.log().Debug("response body truncated", append(logging.Request(req), "max_body_bytes", limit)...)
+		p.SetTruncated(true)
 	}
-	defer resp.Body.Close()
 	return p, bodyStr
 }
 
 func (this *HttpDownloader) downloadHtml(p *page.Page, req *request.Request) *page.Page {
-	var err error
 	p, destbody := this.downloadFile(p, req)
 	if !p.IsSucc() {
 		return p
 	}
+	return parseHtml(p, destbody)
+}
+
+func (this *HttpDownloader) downloadJson(p *page.Page, req *request.Request) *page.Page {
+	p, destbody := this.downloadFile(p, req)
+	if !p.IsSucc() {
+		return p
+	}
+	return parseJson(p, destbody)
+}
+
+func (this *HttpDownloader) downloadText(p *page.Page, req *request.Request) *page.Page {
+	p, destbody := this.downloadFile(p, req)
+	if !p.IsSucc() {
+		return p
+	}
+
+	p.SetBodyStr(destbody).SetStatus(false, "")
+	return p
+}
+
+func (this *HttpDownloader) downloadFeed(p *page.Page, req *request.Request) *page.Page {
+	p, destbody := this.downloadFile(p, req)
+	if !p.IsSucc() {
+		return p
+	}
+	return parseFeed(p, destbody)
+}
+
+func (this *HttpDownloader) downloadXml(p *page.Page, req *request.Request) *page.Page {
+	p, destbody := this.downloadFile(p, req)
+	if !p.IsSucc() {
+		return p
+	}
+	return parseXml(p, destbody)
+}
+
+// ParseBody fills the page with an already downloaded body, as Download does
+// after fetching it. It is used to process saved pages without a network.
+func ParseBody(p *page.Page, body string) *page.Page {
+	switch p.GetRequest().GetResponceType() {
+	case "html":
+		return parseHtml(p, body)
+	case "json", "jsonp":
+		return parseJson(p, body)
+	case "text":
+		p.SetBodyStr(body).SetStatus(false, "")
+		return p
+	case "feed":
+		return parseFeed(p, body)
+	case "xml":
+		return parseXml(p, body)
+	}
+	p.SetStatus(true, "error request type:"+p.GetRequest().GetResponceType())
+	return p
+}
+
+func parseHtml(p *page.Page, destbody string) *page.Page {
+	var err error
 	bodyReader := bytes.NewReader([]byte(destbody))
 
 	var doc *goquery.Document
 	if doc, err = goquery.NewDocumentFromReader(bodyReader); err != nil {
-		log.Println(err.Error())
 		p.SetStatus(true, err.Error())
 		return p
 	}
 
 	var body string
 	if body, err = doc.Html(); err != nil {
-		log.Println(err.Error())
 		p.SetStatus(true, err.Error())
 		return p
 	}
@@ -205,16 +376,11 @@ func (this *HttpDownloader) downloadHtml(p *page.Page, req *request.Request) *pa
 	return p
 }
 
-func (this *HttpDownloader) downloadJson(p *page.Page, req *request.Request) *page.Page {
+func parseJson(p *page.Page, destbody string) *page.Page {
 	var err error
-	p, destbody := this.downloadFile(p, req)
-	if !p.IsSucc() {
-		return p
-	}
-
 	var body []byte
 	body = []byte(destbody)
-	mtype := req.GetResponceType()
+	mtype := p.GetRequest().GetResponceType()
 	if mtype == "jsonp" {
 		tmpstr := utils.JsonpToJson(destbody)
 		body = []byte(tmpstr)
@@ -222,7 +388,6 @@ func (this *HttpDownloader) downloadJson(p *page.Page, req *request.Request) *pa
 
 	var r *simplejson.Json
 	if r, err = simplejson.NewJson(body); err != nil {
-		log.Println(string(body) + "\t" + err.Error())
 		p.SetStatus(true, err.Error())
 		return p
 	}
@@ -233,12 +398,22 @@ func (this *HttpDownloader) downloadJson(p *page.Page, req *request.Request) *pa
 	return p
 }
 
-func (this *HttpDownloader) downloadText(p *page.Page, req *request.Request) *page.Page {
-	p, destbody := this.downloadFile(p, req)
-	if !p.IsSucc() {
+func parseFeed(p *page.Page, destbody string) *page.Page {
+	f, err := feed.Parse([]byte(destbody))
+	if err != nil {
+		p.SetStatus(true, err.Error())
 		return p
 	}
+	p.SetBodyStr(destbody).SetFeed(f).SetStatus(false, "")
+	return p
+}
 
-	p.SetBodyStr(destbody).SetStatus(false, "")
+func parseXml(p *page.Page, destbody string) *page.Page {
+	doc, err := xmldoc.Parse([]byte(destbody))
+	if err != nil {
+		p.SetStatus(true, err.Error())
+		return p
+	}
+	p.SetBodyStr(destbody).SetXml(doc).SetStatus(false, "")
 	return p
 }
@@ -0,0 +1,131 @@
+// Package incremental remembers what was crawled so that a recrawl tells new,
+// changed and unchanged pages apart and skips the urls not due yet.
+package incremental
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/page"
+	"github.com/viixv/crawler/core/commons/request"
+)
+
+// What the fingerprint of a page is computed from.
+const (
+	// FingerprintBody hashes the downloaded body.
+	FingerprintBody = "body"
+	// FingerprintItems hashes the items extracted by the processor, so that
+	// ads, dates or tokens around them do not count as changes.
+	FingerprintItems = "items"
+)
+
+// Tracker compares the pages with their last crawl, see Crawler.SetIncremental.
+type Tracker struct {
+	store         Store
+	fingerprint   string
+	policy        RevisitPolicy
+	emitUnchanged bool
+
+	mutex sync.Mutex
+}
+
+// NewTracker creates a tracker keeping its records in store, fingerprinting
+// the pages as FingerprintBody or FingerprintItems.
+func NewTracker(store Store, fingerprint string) (*Tracker, error) {
+	if fingerprint != FingerprintBody && fingerprint != FingerprintItems {
+		return nil, fmt.Errorf("unknown fingerprint %q, want %s or %s", fingerprint, FingerprintBody, FingerprintItems)
+	}
+	return &Tracker{store: store, fingerprint: fingerprint}, nil
+}
+
+// SetRevisitPolicy sets when a url crawled is due again. Default is nil,
+// every url is due at each crawl.
+func (this *Tracker) SetRevisitPolicy(p RevisitPolicy) *Tracker {
+	this.policy = p
+	return this
+}
+
+// SetEmitUnchanged hands the items of unchanged pages to the pipelines too.
+// Default false, the pipelines receive only new and changed items.
+func (this *Tracker) SetEmitUnchanged(emit bool) *Tracker {
+	this.emitUnchanged = emit
+	return this
+}
+
+func (this *Tracker) EmitUnchanged() bool {
+	return this.emitUnchanged
+}
+
+func (this *Tracker) Fingerprint() string {
+	return this.fingerprint
+}
+
+func (this *Tracker) Store() Store {
+	return this.store
+}
+
+// Due tells whether req is due for a fetch at now under the revisit policy.
+func (this *Tracker) Due(req *request.Request, now time.Time) (bool, error) {
+	rec, err := this.store.Get(req.Fingerprint())
+	if err != nil || rec == nil {
+		return true, err
+	}
+	return rec.Next == nil || !now.Before(*rec.Next), nil
+}
+
+// Mark fingerprints p, sets its change state and records the fetch.
+func (this *Tracker) Mark(p *page.Page) (string, error) {
+	fp, err := this.hash(p)
+	if err != nil {
+		return "", err
+	}
+	req := p.GetRequest()
+	key := req.Fingerprint()
+	now := time.Now()
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	rec, err := this.store.Get(key)
+	if err != nil {
+		return "", err
+	}
+	change := page.ChangeUnchanged
+	if rec == nil {
+		change = page.ChangeNew
+		rec = &Record{Key: key, First: now, Changed: now}
+	} else if rec.Fingerprint != fp {
+		change = page.ChangeChanged
+		rec.Changed = now
+		rec.Changes++
+	}
+	rec.Url = req.GetUrl()
+	rec.Fingerprint = fp
+	rec.Fetched = now
+	rec.Fetches++
+	rec.Next = nil
+	if this.policy != nil {
+		next := now.Add(this.policy.Interval(rec))
+		rec.Next = &next
+	}
+	p.SetChange(change)
+	return change, this.store.Put(rec)
+}
+
+func (this *Tracker) hash(p *page.Page) (string, error) {
+	var data []byte
+	if this.fingerprint == FingerprintItems {
+		// Maps are marshalled with sorted keys.
+		var err error
+		if data, err = json.Marshal(p.GetPageItems().GetAll()); err != nil {
+			return "", err
+		}
+	} else {
+		data = []byte(p.GetBodyStr())
+	}
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,42 @@
+package incremental
+
+import (
+	"time"
+)
+
+// RevisitPolicy tells how long a url is left alone after a fetch.
+type RevisitPolicy interface {
+	// Interval returns the time until the next visit of the url of rec,
+	// rec being updated with the fetch just done.
+	Interval(rec *Record) time.Duration
+}
+
+// FixedInterval revisits every url at the same interval.
+type FixedInterval time.Duration
+
+func (this FixedInterval) Interval(rec *Record) time.Duration {
+	return time.Duration(this)
+}
+
+// Adaptive revisits a url at the mean interval between the changes observed
+// on it, between Min and Max. A url never seen changing waits twice as long
+// as it has been observed, a new url waits Min.
+type Adaptive struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+func (this *Adaptive) Interval(rec *Record) time.Duration {
+	observed := rec.Fetched.Sub(rec.First)
+	d := 2 * observed
+	if rec.Changes > 0 {
+		d = observed / time.Duration(rec.Changes)
+	}
+	if d < this.Min {
+		d = this.Min
+	}
+	if this.Max > 0 && d > this.Max {
+		d = this.Max
+	}
+	return d
+}
@@ -0,0 +1,160 @@
+package incremental
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record is what is remembered of a url between crawls.
+type Record struct {
+	// Key is the request fingerprint, see request.Request.Fingerprint.
+	Key string `json:"key"`
+	Url string `json:"url"`
+	// Fingerprint is the hash of the body or of the items of the last fetch.
+	Fingerprint string    `json:"fingerprint"`
+	First       time.Time `json:"first"`
+	Fetched     time.Time `json:"fetched"`
+	// Changed is the last fetch which found new content.
+	Changed time.Time `json:"changed"`
+	Fetches int       `json:"fetches"`
+	// Changes counts the fetches which found the content changed, the first one excluded.
+	Changes int `json:"changes"`
+	// Next is when the url is due again, nil when it is always due.
+	Next *time.Time `json:"next,omitempty"`
+}
+
+// Store keeps the records of the urls crawled.
+type Store interface {
+	// Get returns the record of key, nil when the url was never crawled.
+	Get(key string) (*Record, error)
+	Put(rec *Record) error
+}
+
+// MemoryStore keeps the records in memory, for crawlers running for long.
+type MemoryStore struct {
+	mutex   sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+func (this *MemoryStore) Get(key string) (*Record, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	rec, ok := this.records[key]
+	if !ok {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+func (this *MemoryStore) Put(rec *Record) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.records[rec.Key] = *rec
+	return nil
+}
+
+// Len returns the number of urls recorded.
+func (this *MemoryStore) Len() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return len(this.records)
+}
+
+// FileStore keeps the records in memory and appends them to a JSON Lines
+// file, the last line of a key wins. The file is compacted when opened.
+type FileStore struct {
+	MemoryStore
+	path string
+}
+
+// NewFileStore loads the records of the file at path, which is created if missing.
+func NewFileStore(path string) (*FileStore, error) {
+	this := &FileStore{MemoryStore: MemoryStore{records: make(map[string]Record)}, path: path}
+	lines, err := this.load()
+	if err != nil {
+		return nil, err
+	}
+	if lines > len(this.records) {
+		if err := this.compact(); err != nil {
+			return nil, err
+		}
+	}
+	return this, nil
+}
+
+func (this *FileStore) load() (int, error) {
+	f, err := os.Open(this.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		rec := Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.Key == "" {
+			continue
+		}
+		this.records[rec.Key] = rec
+		lines++
+	}
+	return lines, scanner.Err()
+}
+
+// compact rewrites the file with one line per key.
+func (this *FileStore) compact() error {
+	tmp := this.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, rec := range this.records {
+		if err := enc.Encode(rec); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, this.path)
+}
+
+func (this *FileStore) Put(rec *Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	f, err := os.OpenFile(this.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	this.records[rec.Key] = *rec
+	return nil
+}
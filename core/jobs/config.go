@@ -0,0 +1,105 @@
+package jobs
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/viixv/crawler/core/crawler"
+	"github.com/viixv/crawler/core/spec"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is a jobs file. Spec and history paths are relative to the file:
+//
+//	history: history.jsonl
+//	jobs:
+//	  - spec: news.yaml
+//	    schedule: "0 * * * *"
+//	  - name: prices-fast
+//	    spec: prices.yaml
+//	    schedule: "@every 15m"
+type Config struct {
+	// History is the JSON Lines file of the runs. Default is in memory.
+	History string       `yaml:"history"`
+	Jobs    []*JobConfig `yaml:"jobs"`
+}
+
+// JobConfig is a job of a Config.
+type JobConfig struct {
+	// Name defaults to the name of the spec.
+	Name     string `yaml:"name"`
+	Spec     string `yaml:"spec"`
+	Schedule string `yaml:"schedule"`
+}
+
+// LoadConfig reads a jobs file and checks its schedules and specs.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	conf := &Config{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.SetStrict(true)
+	if err := dec.Decode(conf); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	dir := filepath.Dir(path)
+	if conf.History != "" && !filepath.IsAbs(conf.History) {
+		conf.History = filepath.Join(dir, conf.History)
+	}
+	for i, jc := range conf.Jobs {
+		if jc.Spec == "" {
+			return nil, fmt.Errorf("%s: jobs[%d]: spec is required", path, i)
+		}
+		if !filepath.IsAbs(jc.Spec) {
+			jc.Spec = filepath.Join(dir, jc.Spec)
+		}
+		schedule, err := ParseSchedule(jc.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("%s: jobs[%d]: %s", path, i, err.Error())
+		}
+		if schedule.Next(time.Now()).IsZero() {
+			return nil, fmt.Errorf("%s: jobs[%d]: schedule %q never fires", path, i, jc.Schedule)
+		}
+		s, err := spec.Load(jc.Spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: jobs[%d]: %s", path, i, err.Error())
+		}
+		if jc.Name == "" {
+			jc.Name = s.Name
+		}
+	}
+	return conf, nil
+}
+
+// Runner creates a runner of the jobs. Each run loads its spec again, so
+// that edits apply from the next run on.
+func (this *Config) Runner() (*Runner, error) {
+	var history History
+	if this.History != "" {
+		history = NewFileHistory(this.History)
+	}
+	r := NewRunner(history)
+	for _, jc := range this.Jobs {
+		schedule, err := ParseSchedule(jc.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		path := jc.Spec
+		job := &Job{Name: jc.Name, Schedule: schedule, Build: func() (*crawler.Crawler, error) {
+			s, err := spec.Load(path)
+			if err != nil {
+				return nil, err
+			}
+			return s.Build()
+		}}
+		if err := r.Add(job); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,184 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells when a job runs next.
+type Schedule interface {
+	// Next returns the first run time after t.
+	Next(t time.Time) time.Time
+}
+
+// Every is a Schedule running at a fixed interval.
+type Every time.Duration
+
+func (this Every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(this))
+}
+
+func (this Every) String() string {
+	return "@every " + time.Duration(this).String()
+}
+
+// cronSchedule is a parsed cron expression, a bit set per field.
+type cronSchedule struct {
+	expr                          string
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+
+var dayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// ParseSchedule parses a cron expression with the five fields minute, hour,
+// day of month, month and day of week, e.g. "30 6 * * mon-fri"; a descriptor
+// such as @daily or @hourly; or "@every 90m". Times are in the local zone.
+func ParseSchedule(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(expr[len("@every "):]))
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %s", expr, err.Error())
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("schedule %q: interval must be positive", expr)
+		}
+		return Every(d), nil
+	}
+	fields := expr
+	if d, ok := descriptors[expr]; ok {
+		fields = d
+	}
+	parts := strings.Fields(fields)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("schedule %q: want 5 fields, got %d", expr, len(parts))
+	}
+	s := &cronSchedule{expr: expr}
+	var err error
+	if s.minute, err = parseField(parts[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("schedule %q: minute: %s", expr, err.Error())
+	}
+	if s.hour, err = parseField(parts[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("schedule %q: hour: %s", expr, err.Error())
+	}
+	if s.dom, err = parseField(parts[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("schedule %q: day of month: %s", expr, err.Error())
+	}
+	if s.month, err = parseField(parts[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("schedule %q: month: %s", expr, err.Error())
+	}
+	if s.dow, err = parseField(parts[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("schedule %q: day of week: %s", expr, err.Error())
+	}
+	// 7 is sunday too.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = parts[2] == "*" || parts[2] == "?"
+	s.dowStar = parts[4] == "*" || parts[4] == "?"
+	return s, nil
+}
+
+// parseField parses a comma separated list of *, n, a-b, with an optional /step.
+func parseField(field string, min int, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rng, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step in %q", item)
+			}
+			rng = item[:i]
+		}
+		lo, hi := min, max
+		if rng != "*" && rng != "?" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = fieldValue(bounds[0], names); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = fieldValue(bounds[1], names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", item, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func fieldValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad value %q", s)
+	}
+	return v, nil
+}
+
+func (this *cronSchedule) String() string {
+	return this.expr
+}
+
+func (this *cronSchedule) dayMatches(t time.Time) bool {
+	dom := this.dom&(1<<uint(t.Day())) != 0
+	dow := this.dow&(1<<uint(t.Weekday())) != 0
+	if this.domStar || this.dowStar {
+		return dom && dow
+	}
+	// Both restricted: either matches, as in cron.
+	return dom || dow
+}
+
+func (this *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if this.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !this.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if this.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if this.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
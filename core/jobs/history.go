@@ -0,0 +1,137 @@
+package jobs
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/viixv/crawler/core/stats"
+)
+
+// Statuses of a Run.
+const (
+	StatusRunning = "running"
+	StatusOk      = "ok"
+	StatusFailed  = "failed"
+	// StatusSkipped is a trigger dropped because the previous run of the job was not finished.
+	StatusSkipped = "skipped"
+)
+
+// Run is a run of a job.
+type Run struct {
+	Job      string          `json:"job"`
+	Trigger  string          `json:"trigger"`
+	Status   string          `json:"status"`
+	Error    string          `json:"error,omitempty"`
+	Started  time.Time       `json:"started"`
+	Finished *time.Time      `json:"finished,omitempty"`
+	Stats    *stats.Snapshot `json:"stats,omitempty"`
+}
+
+// Duration returns how long the run took, 0 while it is running.
+func (this *Run) Duration() time.Duration {
+	if this.Finished == nil {
+		return 0
+	}
+	return this.Finished.Sub(this.Started)
+}
+
+// History keeps the finished runs of the jobs.
+type History interface {
+	Record(run *Run) error
+	// Runs returns the last n runs of job, of every job when job is "", in the order they were recorded.
+	Runs(job string, n int) ([]*Run, error)
+}
+
+// MemoryHistory keeps the runs in memory.
+type MemoryHistory struct {
+	mutex sync.Mutex
+	runs  []*Run
+}
+
+func NewMemoryHistory() *MemoryHistory {
+	return &MemoryHistory{}
+}
+
+func (this *MemoryHistory) Record(run *Run) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.runs = append(this.runs, run)
+	return nil
+}
+
+func (this *MemoryHistory) Runs(job string, n int) ([]*Run, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return lastRuns(this.runs, job, n), nil
+}
+
+// FileHistory appends the runs to a JSON Lines file, so that they outlive the process.
+type FileHistory struct {
+	path  string
+	mutex sync.Mutex
+}
+
+func NewFileHistory(path string) *FileHistory {
+	return &FileHistory{path: path}
+}
+
+func (this *FileHistory) Record(run *Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	f, err := os.OpenFile(this.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (this *FileHistory) Runs(job string, n int) ([]*Run, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	f, err := os.Open(this.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var runs []*Run
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		run := &Run{}
+		if err := json.Unmarshal(scanner.Bytes(), run); err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lastRuns(runs, job, n), nil
+}
+
+func lastRuns(runs []*Run, job string, n int) []*Run {
+	var matched []*Run
+	for _, run := range runs {
+		if job == "" || run.Job == job {
+			matched = append(matched, run)
+		}
+	}
+	if n > 0 && len(matched) > n {
+		matched = matched[len(matched)-n:]
+	}
+	return matched
+}
@@ -0,0 +1,287 @@
+// Package jobs runs named crawls again and again, on cron expressions or
+// fixed intervals, and keeps the history of their runs.
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/logging"
+	"github.com/viixv/crawler/core/commons/task"
+	"github.com/viixv/crawler/core/crawler"
+)
+
+// Triggers of a Run.
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// ErrRunning is returned when a job is triggered while its previous run is not finished.
+var ErrRunning = errors.New("job is already running")
+
+// Job is a crawl run on a schedule. Build returns a new crawler for each run,
+// a Crawler forgets its seeds and pipelines when Run returns.
+type Job struct {
+	// Name identifies the job, usually the TaskName of the crawlers built.
+	Name     string
+	Schedule Schedule
+	Build    func() (*crawler.Crawler, error)
+}
+
+// JobStatus is the state of a job.
+type JobStatus struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	// Next is nil when the schedule never fires again.
+	Next    *time.Time `json:"next,omitempty"`
+	Running bool       `json:"running"`
+	Last    *Run       `json:"last,omitempty"`
+}
+
+// Runner triggers the jobs on their schedules once started. A job never runs
+// twice at once: a trigger during a run is recorded as skipped.
+type Runner struct {
+	history History
+	logger  *slog.Logger
+
+	mutex   sync.Mutex
+	jobs    map[string]*Job
+	next    map[string]time.Time
+	running map[string]*crawler.Crawler
+	stop    chan struct{}
+	started bool
+	wg      sync.WaitGroup
+}
+
+// NewRunner creates a runner recording runs in history, in memory when nil.
+func NewRunner(history History) *Runner {
+	if history == nil {
+		history = NewMemoryHistory()
+	}
+	return &Runner{
+		history: history,
+		jobs:    make(map[string]*Job),
+		next:    make(map[string]time.Time),
+		running: make(map[string]*crawler.Crawler),
+		stop:    make(chan struct{}),
+	}
+}
+
+// SetLogger sets the logger of the runner, default is slog.Default().
+func (this *Runner) SetLogger(l *slog.Logger) {
+	this.logger = l
+}
+
+func (this *Runner) log() *slog.Logger {
+	return logging.Or(this.logger)
+}
+
+// History returns where the runs are recorded.
+func (this *Runner) History() History {
+	return this.history
+}
+
+// Add adds a job. Names must be unique.
+func (this *Runner) Add(job *Job) error {
+	if job.Name == "" || job.Schedule == nil || job.Build == nil {
+		return errors.New("job needs a name, a schedule and a build function")
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if _, ok := this.jobs[job.Name]; ok {
+		return fmt.Errorf("job %q is defined twice", job.Name)
+	}
+	this.jobs[job.Name] = job
+	if this.started {
+		this.schedule(job)
+	}
+	return nil
+}
+
+// Job returns the job named name, nil if there is none.
+func (this *Runner) Job(name string) *Job {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.jobs[name]
+}
+
+// Jobs returns the state of every job, sorted by name.
+func (this *Runner) Jobs() []*JobStatus {
+	this.mutex.Lock()
+	statuses := make([]*JobStatus, 0, len(this.jobs))
+	for name, job := range this.jobs {
+		next := this.next[name]
+		if next.IsZero() {
+			next = job.Schedule.Next(time.Now())
+		}
+		_, running := this.running[name]
+		status := &JobStatus{Name: name, Schedule: fmt.Sprint(job.Schedule), Running: running}
+		if !next.IsZero() {
+			status.Next = &next
+		}
+		statuses = append(statuses, status)
+	}
+	this.mutex.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	for _, s := range statuses {
+		if runs, err := this.history.Runs(s.Name, 1); err == nil && len(runs) > 0 {
+			s.Last = runs[0]
+		}
+	}
+	return statuses
+}
+
+// Run runs the job named name now and waits for the end of the run.
+func (this *Runner) Run(name string) (*Run, error) {
+	return this.run(name, TriggerManual)
+}
+
+func (this *Runner) run(name string, trigger string) (*Run, error) {
+	run := &Run{Job: name, Trigger: trigger, Status: StatusRunning, Started: time.Now()}
+	this.mutex.Lock()
+	job, ok := this.jobs[name]
+	if !ok {
+		this.mutex.Unlock()
+		return nil, fmt.Errorf("unknown job %q", name)
+	}
+	if _, busy := this.running[name]; busy {
+		this.mutex.Unlock()
+		run.Status = StatusSkipped
+		run.Error = ErrRunning.Error()
+		finished := run.Started
+		run.Finished = &finished
+		this.record(run)
+		this.log().Warn("job run skipped, the previous one is not finished", "job", name, "trigger", trigger)
+		return run, ErrRunning
+	}
+	// Reserved while building.
+	this.running[name] = nil
+	this.mutex.Unlock()
+
+	defer func() {
+		if err := recover(); err != nil {
+			run.Status = StatusFailed
+			run.Error = fmt.Sprintf("panic: %v", err)
+		}
+		this.mutex.Lock()
+		delete(this.running, name)
+		this.mutex.Unlock()
+		finished := time.Now()
+		run.Finished = &finished
+		this.record(run)
+		this.log().Info("job run finished", "job", name, "status", run.Status, "duration", run.Duration())
+	}()
+
+	this.log().Info("job run started", "job", name, "trigger", trigger)
+	c, err := job.Build()
+	if err != nil {
+		run.Status = StatusFailed
+		run.Error = err.Error()
+		return run, nil
+	}
+	this.mutex.Lock()
+	this.running[name] = c
+	stopped := this.isStopped()
+	this.mutex.Unlock()
+	if stopped {
+		c.Discard()
+		run.Status = StatusFailed
+		run.Error = "runner stopped"
+		return run, nil
+	}
+	// Stop does not reach a crawler which is not running yet.
+	c.OnStart(func(t task.Task) {
+		if this.isStopped() {
+			c.Stop()
+		}
+	})
+
+	c.Run()
+	run.Stats = c.Stats()
+	run.Status = StatusOk
+	if run.Stats.Downloaded == 0 && run.Stats.Failed > 0 {
+		run.Status = StatusFailed
+		run.Error = fmt.Sprintf("every request failed (%d)", run.Stats.Failed)
+	}
+	return run, nil
+}
+
+func (this *Runner) record(run *Run) {
+	if err := this.history.Record(run); err != nil {
+		this.log().Error("job history failed", "job", run.Job, "error", err)
+	}
+}
+
+// Start triggers the jobs on their schedules until Stop.
+func (this *Runner) Start() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.started {
+		return
+	}
+	this.started = true
+	for _, job := range this.jobs {
+		this.schedule(job)
+	}
+}
+
+// schedule starts the trigger loop of job. The mutex must be held.
+func (this *Runner) schedule(job *Job) {
+	this.wg.Add(1)
+	go func() {
+		defer this.wg.Done()
+		for {
+			next := job.Schedule.Next(time.Now())
+			if next.IsZero() {
+				this.log().Warn("job schedule never fires", "job", job.Name)
+				return
+			}
+			this.mutex.Lock()
+			this.next[job.Name] = next
+			this.mutex.Unlock()
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-this.stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			this.wg.Add(1)
+			go func() {
+				defer this.wg.Done()
+				this.run(job.Name, TriggerSchedule)
+			}()
+		}
+	}()
+}
+
+func (this *Runner) isStopped() bool {
+	select {
+	case <-this.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop stops triggering jobs, stops the running crawls and waits for them.
+func (this *Runner) Stop() {
+	this.mutex.Lock()
+	if !this.isStopped() {
+		close(this.stop)
+	}
+	for _, c := range this.running {
+		if c != nil {
+			c.Stop()
+		}
+	}
+	this.mutex.Unlock()
+	this.wg.Wait()
+}
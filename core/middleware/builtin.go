@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/viixv/crawler/core/commons/page"
+	"github.com/viixv/crawler/core/commons/request"
+	"github.com/viixv/crawler/core/commons/task"
+)
+
+// SetHeader returns a request middleware setting a header on every request,
+// e.g. SetHeader("Authorization", "Bearer "+token).
+func SetHeader(key, value string) RequestMiddleware {
+	return RequestFunc(func(req *request.Request, t task.Task) *request.Request {
+		header := http.Header{}
+		for k, v := range req.GetHeader() {
+			header[k] = v
+		}
+		header.Set(key, value)
+		r := *req
+		r.Header = header
+		return &r
+	})
+}
+
+// RetryStatus returns a response middleware retrying responses with one of the status codes.
+func RetryStatus(codes ...int) ResponseMiddleware {
+	return ResponseFunc(func(p *page.Page, t task.Task) (*page.Page, Action) {
+		for _, code := range codes {
+			if p.GetStatusCode() == code {
+				return p, Retry
+			}
+		}
+		return p, Continue
+	})
+}
+
+// RetryIf returns a response middleware retrying successful pages the function
+// reports as bad, e.g. captcha or rate limit pages served with status 200.
+func RetryIf(bad func(p *page.Page) bool) ResponseMiddleware {
+	return ResponseFunc(func(p *page.Page, t task.Task) (*page.Page, Action) {
+		if p.IsSucc() && bad(p) {
+			return p, Retry
+		}
+		return p, Continue
+	})
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"sync"
+
+	"github.com/viixv/crawler/core/commons/request"
+	"github.com/viixv/crawler/core/commons/result"
+	"github.com/viixv/crawler/core/commons/task"
+)
+
+// Hooks holds the functions called on crawler lifecycle events.
+// Hooks run synchronously on the crawler goroutines and should return quickly.
+// It is safe for concurrent use.
+type Hooks struct {
+	mutex              sync.RWMutex
+	onStart            []func(t task.Task)
+	onRequestScheduled []func(req *request.Request)
+	onError            []func(req *request.Request, err error)
+	onItem             []func(items *result.ResultItems)
+	onIdle             []func(t task.Task)
+	onFinish           []func(t task.Task)
+}
+
+func NewHooks() *Hooks {
+	return &Hooks{}
+}
+
+// OnStart is called when Run starts.
+func (this *Hooks) OnStart(f func(t task.Task)) {
+	this.mutex.Lock()
+	this.onStart = append(this.onStart, f)
+	this.mutex.Unlock()
+}
+
+// OnRequestScheduled is called after a request is pushed to the scheduler.
+func (this *Hooks) OnRequestScheduled(f func(req *request.Request)) {
+	this.mutex.Lock()
+	this.onRequestScheduled = append(this.onRequestScheduled, f)
+	this.mutex.Unlock()
+}
+
+// OnError is called when a request is given up or its processing panics.
+func (this *Hooks) OnError(f func(req *request.Request, err error)) {
+	this.mutex.Lock()
+	this.onError = append(this.onError, f)
+	this.mutex.Unlock()
+}
+
+// OnItem is called with the items of each page before they reach the pipelines.
+func (this *Hooks) OnItem(f func(items *result.ResultItems)) {
+	this.mutex.Lock()
+	this.onItem = append(this.onItem, f)
+	this.mutex.Unlock()
+}
+
+// OnIdle is called when the queue is empty and no request is in flight while
+// the crawler keeps running, see Crawler.SetExitWhenComplete.
+func (this *Hooks) OnIdle(f func(t task.Task)) {
+	this.mutex.Lock()
+	this.onIdle = append(this.onIdle, f)
+	this.mutex.Unlock()
+}
+
+// OnFinish is called when Run returns.
+func (this *Hooks) OnFinish(f func(t task.Task)) {
+	this.mutex.Lock()
+	this.onFinish = append(this.onFinish, f)
+	this.mutex.Unlock()
+}
+
+func (this *Hooks) FireStart(t task.Task) {
+	this.mutex.RLock()
+	fs := this.onStart
+	this.mutex.RUnlock()
+	for _, f := range fs {
+		f(t)
+	}
+}
+
+func (this *Hooks) FireRequestScheduled(req *request.Request) {
+	this.mutex.RLock()
+	fs := this.onRequestScheduled
+	this.mutex.RUnlock()
+	for _, f := range fs {
+		f(req)
+	}
+}
+
+func (this *Hooks) FireError(req *request.Request, err error) {
+	this.mutex.RLock()
+	fs := this.onError
+	this.mutex.RUnlock()
+	for _, f := range fs {
+		f(req, err)
+	}
+}
+
+func (this *Hooks) FireItem(items *result.ResultItems) {
+	this.mutex.RLock()
+	fs := this.onItem
+	this.mutex.RUnlock()
+	for _, f := range fs {
+		f(items)
+	}
+}
+
+func (this *Hooks) FireIdle(t task.Task) {
+	this.mutex.RLock()
+	fs := this.onIdle
+	this.mutex.RUnlock()
+	for _, f := range fs {
+		f(t)
+	}
+}
+
+func (this *Hooks) FireFinish(t task.Task) {
+	this.mutex.RLock()
+	fs := this.onFinish
+	this.mutex.RUnlock()
+	for _, f := range fs {
+		f(t)
+	}
+}
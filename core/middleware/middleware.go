@@ -0,0 +1,145 @@
+// Package middleware lets cross-cutting concerns run around the crawler's
+// download, processing and pipeline steps without touching any PageProcessor.
+package middleware
+
+import (
+	"sync"
+
+	"github.com/viixv/crawler/core/commons/page"
+	"github.com/viixv/crawler/core/commons/request"
+	"github.com/viixv/crawler/core/commons/result"
+	"github.com/viixv/crawler/core/commons/task"
+)
+
+// Action tells the crawler what to do with a page after a response middleware.
+type Action int
+
+const (
+	// Continue passes the page to the next middleware and then to the processor.
+	Continue Action = iota
+	// Retry downloads the request again, as if the download had failed.
+	Retry
+	// Drop stops handling the request.
+	Drop
+)
+
+func (this Action) String() string {
+	switch this {
+	case Continue:
+		return "continue"
+	case Retry:
+		return "retry"
+	case Drop:
+		return "drop"
+	}
+	return "unknown"
+}
+
+// RequestMiddleware runs before a request is downloaded. It may change the
+// request or return another one; returning nil drops the request.
+type RequestMiddleware interface {
+	ProcessRequest(req *request.Request, t task.Task) *request.Request
+}
+
+// ResponseMiddleware runs after every download attempt, failed ones included.
+// It may inspect or replace the page, e.g. to retry captcha pages.
+type ResponseMiddleware interface {
+	ProcessResponse(p *page.Page, t task.Task) (*page.Page, Action)
+}
+
+// ItemMiddleware runs before the pipelines. It may change the items or
+// return nil to keep them from the pipelines.
+type ItemMiddleware interface {
+	ProcessItem(items *result.ResultItems, t task.Task) *result.ResultItems
+}
+
+// RequestFunc adapts a function to RequestMiddleware.
+type RequestFunc func(req *request.Request, t task.Task) *request.Request
+
+func (this RequestFunc) ProcessRequest(req *request.Request, t task.Task) *request.Request {
+	return this(req, t)
+}
+
+// ResponseFunc adapts a function to ResponseMiddleware.
+type ResponseFunc func(p *page.Page, t task.Task) (*page.Page, Action)
+
+func (this ResponseFunc) ProcessResponse(p *page.Page, t task.Task) (*page.Page, Action) {
+	return this(p, t)
+}
+
+// ItemFunc adapts a function to ItemMiddleware.
+type ItemFunc func(items *result.ResultItems, t task.Task) *result.ResultItems
+
+func (this ItemFunc) ProcessItem(items *result.ResultItems, t task.Task) *result.ResultItems {
+	return this(items, t)
+}
+
+// Chain runs middlewares in the order they were added. It is safe for concurrent use.
+type Chain struct {
+	mutex     sync.RWMutex
+	requests  []RequestMiddleware
+	responses []ResponseMiddleware
+	items     []ItemMiddleware
+}
+
+func NewChain() *Chain {
+	return &Chain{}
+}
+
+func (this *Chain) UseRequest(m ...RequestMiddleware) {
+	this.mutex.Lock()
+	this.requests = append(this.requests, m...)
+	this.mutex.Unlock()
+}
+
+func (this *Chain) UseResponse(m ...ResponseMiddleware) {
+	this.mutex.Lock()
+	this.responses = append(this.responses, m...)
+	this.mutex.Unlock()
+}
+
+func (this *Chain) UseItem(m ...ItemMiddleware) {
+	this.mutex.Lock()
+	this.items = append(this.items, m...)
+	this.mutex.Unlock()
+}
+
+// Request runs the request middlewares, stopping at the first one dropping the request.
+func (this *Chain) Request(req *request.Request, t task.Task) *request.Request {
+	this.mutex.RLock()
+	ms := this.requests
+	this.mutex.RUnlock()
+	for _, m := range ms {
+		if req = m.ProcessRequest(req, t); req == nil {
+			return nil
+		}
+	}
+	return req
+}
+
+// Response runs the response middlewares, stopping at the first one not returning Continue.
+func (this *Chain) Response(p *page.Page, t task.Task) (*page.Page, Action) {
+	this.mutex.RLock()
+	ms := this.responses
+	this.mutex.RUnlock()
+	for _, m := range ms {
+		var action Action
+		if p, action = m.ProcessResponse(p, t); action != Continue {
+			return p, action
+		}
+	}
+	return p, Continue
+}
+
+// Item runs the item middlewares, stopping at the first one dropping the items.
+func (this *Chain) Item(items *result.ResultItems, t task.Task) *result.ResultItems {
+	this.mutex.RLock()
+	ms := this.items
+	this.mutex.RUnlock()
+	for _, m := range ms {
+		if items = m.ProcessItem(items, t); items == nil {
+			return nil
+		}
+	}
+	return items
+}
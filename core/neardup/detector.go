@@ -0,0 +1,94 @@
+package neardup
+
+import (
+	"log/slog"
+
+	"github.com/viixv/crawler/core/commons/logging"
+	"github.com/viixv/crawler/core/commons/page"
+	"github.com/viixv/crawler/core/commons/task"
+	"github.com/viixv/crawler/core/middleware"
+)
+
+// What a Detector does with near duplicates.
+const (
+	// ActionMark marks them with Page.SetDuplicateOf and lets them be processed.
+	ActionMark = "mark"
+	// ActionSkip drops them before processing.
+	ActionSkip = "skip"
+)
+
+// DefaultDistance is the distance of a new Detector, about 95% similar bits.
+const DefaultDistance = 3
+
+// DefaultMinFeatures is the fewest features a page needs to be compared,
+// short texts are too alike to tell apart.
+const DefaultMinFeatures = 20
+
+// Detector is a response middleware comparing the visible text of each page
+// with the pages seen before, see Crawler.UseResponse.
+type Detector struct {
+	index       *Index
+	action      string
+	minFeatures int
+	logger      *slog.Logger
+}
+
+// NewDetector creates a detector taking pages at most distance bits away as
+// near duplicates and marking them.
+func NewDetector(distance int) (*Detector, error) {
+	index, err := NewIndex(distance)
+	if err != nil {
+		return nil, err
+	}
+	return &Detector{index: index, action: ActionMark, minFeatures: DefaultMinFeatures}, nil
+}
+
+// SetAction sets what is done with near duplicates, ActionMark or ActionSkip.
+func (this *Detector) SetAction(action string) *Detector {
+	this.action = action
+	return this
+}
+
+// SetMinFeatures sets the fewest features a page needs to be compared.
+func (this *Detector) SetMinFeatures(n int) *Detector {
+	this.minFeatures = n
+	return this
+}
+
+func (this *Detector) SetLogger(l *slog.Logger) *Detector {
+	this.logger = l
+	return this
+}
+
+func (this *Detector) Index() *Index {
+	return this.index
+}
+
+// Text returns the text compared of p: the visible text of html pages, the body of others.
+func Text(p *page.Page) string {
+	if doc := p.GetHtmlParser(); doc != nil {
+		return VisibleText(doc)
+	}
+	return p.GetBodyStr()
+}
+
+func (this *Detector) ProcessResponse(p *page.Page, t task.Task) (*page.Page, middleware.Action) {
+	if !p.IsSucc() {
+		return p, middleware.Continue
+	}
+	hash, features := Simhash(Text(p))
+	if features < this.minFeatures {
+		return p, middleware.Continue
+	}
+	url := p.GetRequest().GetUrl()
+	m, ok := this.index.AddIfNew(hash, url)
+	if !ok {
+		return p, middleware.Continue
+	}
+	p.SetDuplicateOf(m.Url)
+	logging.Or(this.logger).Debug("near duplicate page", append(logging.Request(p.GetRequest()), "duplicate_of", m.Url, "distance", m.Distance)...)
+	if this.action == ActionSkip {
+		return p, middleware.Drop
+	}
+	return p, middleware.Continue
+}
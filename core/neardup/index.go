@@ -0,0 +1,118 @@
+package neardup
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MaxDistance is the largest distance an Index looks up.
+const MaxDistance = 16
+
+// Match is a page found in an Index.
+type Match struct {
+	Url      string
+	Hash     uint64
+	Distance int
+}
+
+// Index finds the hashes within a Hamming distance of a hash. The 64 bits are
+// cut into distance+1 blocks: two hashes that close share at least one block
+// exactly, so only the hashes sharing a block are compared.
+type Index struct {
+	distance int
+	shifts   []uint
+	masks    []uint64
+
+	mutex   sync.RWMutex
+	entries []Match
+	tables  []map[uint64][]int
+}
+
+// NewIndex creates an index looking up hashes at most distance bits away.
+func NewIndex(distance int) (*Index, error) {
+	if distance < 0 || distance > MaxDistance {
+		return nil, fmt.Errorf("distance %d is out of range 0-%d", distance, MaxDistance)
+	}
+	blocks := distance + 1
+	this := &Index{distance: distance, tables: make([]map[uint64][]int, blocks)}
+	start := 0
+	for i := 0; i < blocks; i++ {
+		width := 64 / blocks
+		if i < 64%blocks {
+			width++
+		}
+		this.shifts = append(this.shifts, uint(start))
+		this.masks = append(this.masks, uint64(1)<<uint(width)-1)
+		this.tables[i] = make(map[uint64][]int)
+		start += width
+	}
+	return this, nil
+}
+
+func (this *Index) Distance() int {
+	return this.distance
+}
+
+// Len returns the number of hashes added.
+func (this *Index) Len() int {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return len(this.entries)
+}
+
+// Add adds the hash of the page at url.
+func (this *Index) Add(hash uint64, url string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.add(hash, url)
+}
+
+func (this *Index) add(hash uint64, url string) {
+	this.entries = append(this.entries, Match{Url: url, Hash: hash})
+	for i := range this.tables {
+		block := hash >> this.shifts[i] & this.masks[i]
+		this.tables[i][block] = append(this.tables[i][block], len(this.entries)-1)
+	}
+}
+
+// Lookup returns the closest hash within the distance of the index, the
+// pages at url excluded.
+func (this *Index) Lookup(hash uint64, url string) (*Match, bool) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.lookup(hash, url)
+}
+
+func (this *Index) lookup(hash uint64, url string) (*Match, bool) {
+	var best *Match
+	for i, table := range this.tables {
+		for _, e := range table[hash>>this.shifts[i]&this.masks[i]] {
+			entry := this.entries[e]
+			if entry.Url == url {
+				continue
+			}
+			if d := Distance(hash, entry.Hash); d <= this.distance && (best == nil || d < best.Distance) {
+				entry.Distance = d
+				best = &entry
+			}
+		}
+	}
+	return best, best != nil
+}
+
+// AddIfNew looks hash up and adds it when no other page is close enough, at once.
+// A url already added with the same hash is not added again.
+func (this *Index) AddIfNew(hash uint64, url string) (*Match, bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if m, ok := this.lookup(hash, url); ok {
+		return m, true
+	}
+	for _, e := range this.tables[0][hash>>this.shifts[0]&this.masks[0]] {
+		if this.entries[e].Url == url && this.entries[e].Hash == hash {
+			return nil, false
+		}
+	}
+	this.add(hash, url)
+	return nil, false
+}
@@ -0,0 +1,116 @@
+// Package neardup finds pages whose content nearly duplicates a page seen
+// before, e.g. print views, urls with tracking parameters or mirrors, which
+// url based dedupe cannot catch.
+package neardup
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// shingle is the number of consecutive tokens of a feature.
+const shingle = 3
+
+// Simhash returns the 64 bits SimHash of text and the number of features
+// hashed. Features are shingles of words, each Han character being a word.
+func Simhash(text string) (uint64, int) {
+	tokens := Tokens(text)
+	var weights [64]int
+	features := 0
+	add := func(feature string) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		for i := 0; i < 64; i++ {
+			if sum&(1<<uint(i)) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+		features++
+	}
+	if len(tokens) < shingle {
+		for _, t := range tokens {
+			add(t)
+		}
+	} else {
+		for i := 0; i+shingle <= len(tokens); i++ {
+			add(strings.Join(tokens[i:i+shingle], " "))
+		}
+	}
+
+	var hash uint64
+	for i, w := range weights {
+		if w > 0 {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash, features
+}
+
+// Distance returns the number of bits which differ between a and b.
+func Distance(a uint64, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Tokens splits text into lower case words.
+func Tokens(text string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(unicode.ToLower(r))
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// hidden are the elements whose text is not shown.
+var hidden = map[string]bool{"script": true, "style": true, "noscript": true, "template": true, "head": true}
+
+// VisibleText returns the text of doc outside scripts, styles and the head.
+// The document is left untouched.
+func VisibleText(doc *goquery.Document) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+			return
+		case html.ElementNode:
+			if hidden[n.Data] {
+				return
+			}
+		case html.CommentNode:
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range doc.Nodes {
+		walk(n)
+	}
+	return b.String()
+}
@@ -1,8 +1,10 @@
 package pipeline
 
 import (
+	"log/slog"
 	"os"
 
+	"github.com/viixv/crawler/core/commons/logging"
 	"github.com/viixv/crawler/core/commons/result"
 	"github.com/viixv/crawler/core/commons/task"
 )
@@ -10,7 +12,8 @@ import (
 type FilePipeline struct {
 	pFile *os.File
 
-	path string
+	path   string
+	logger *slog.Logger
 }
 
 func NewFilePipeline(path string) *FilePipeline {
@@ -26,6 +29,14 @@ func (this *FilePipeline) Process(items *result.ResultItems, t task.Task) {
 	this.pFile.WriteString("Crawled url :\t" + items.GetRequest().GetUrl() + "\n")
 	this.pFile.WriteString("Crawled result : \n")
 	for key, value := range items.GetAll() {
-		this.pFile.WriteString(key + "\t:\t" + value + "\n")
+		if _, err := this.pFile.WriteString(key + "\t:\t" + value + "\n"); err != nil {
+			logging.Or(this.logger).Error("write item failed", append(logging.Request(items.GetRequest()), "path", this.path, "error", err)...)
+			return
+		}
 	}
 }
+
+// SetLogger sets the logger of the pipeline, default is slog.Default().
+func (this *FilePipeline) SetLogger(l *slog.Logger) {
+	this.logger = l
+}
@@ -0,0 +1,60 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/viixv/crawler/core/commons/logging"
+	"github.com/viixv/crawler/core/commons/result"
+	"github.com/viixv/crawler/core/commons/task"
+)
+
+// JsonPipeline appends one JSON object per crawled page to a file (JSON Lines).
+type JsonPipeline struct {
+	mutex  sync.Mutex
+	pFile  *os.File
+	enc    *json.Encoder
+	logger *slog.Logger
+}
+
+type jsonRecord struct {
+	Task   string            `json:"task"`
+	Url    string            `json:"url"`
+	UrlTag string            `json:"url_tag,omitempty"`
+	Items  map[string]string `json:"items"`
+}
+
+func NewJsonPipeline(path string) (*JsonPipeline, error) {
+	pFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &JsonPipeline{pFile: pFile, enc: json.NewEncoder(pFile)}, nil
+}
+
+func (this *JsonPipeline) Process(items *result.ResultItems, t task.Task) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	rec := jsonRecord{Task: t.TaskName(), Items: items.GetAll()}
+	if req := items.GetRequest(); req != nil {
+		rec.Url = req.GetUrl()
+		rec.UrlTag = req.GetUrlTag()
+	}
+	if err := this.enc.Encode(rec); err != nil {
+		logging.Or(this.logger).Error("write item failed", "url", rec.Url, "error", err)
+	}
+}
+
+// SetLogger sets the logger of the pipeline, default is slog.Default().
+func (this *JsonPipeline) SetLogger(l *slog.Logger) {
+	this.logger = l
+}
+
+// Close closes the underlying file.
+func (this *JsonPipeline) Close() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.pFile.Close()
+}
@@ -0,0 +1,147 @@
+package processor
+
+import (
+	"regexp"
+
+	"github.com/viixv/crawler/core/commons/page"
+)
+
+// Rule tells RuleProcessor how to handle a page and which of its links to follow.
+type Rule struct {
+	// Match selects the pages handled by the rule and the links it follows.
+	// A nil Match selects every url.
+	Match *regexp.Regexp
+
+	// Links extracts the candidate links of the rule.
+	// When nil the default page.LinkOptions are used.
+	Links *page.LinkOptions
+
+	// Callback extracts fields from the pages handled by the rule. It may be nil.
+	Callback func(p *page.Page)
+
+	// Follow extracts links from the pages handled by the rule.
+	Follow bool
+
+	// UrlTag is assigned to requests created by the rule.
+	// Pages carrying the tag are handled by the rule regardless of Match.
+	UrlTag string
+
+	// RespType of requests created by the rule, default is the one in Links or "html".
+	RespType string
+}
+
+// MustRule returns a rule matching urls against the regular expression pattern.
+func MustRule(pattern string, callback func(p *page.Page), follow bool) *Rule {
+	return &Rule{Match: regexp.MustCompile(pattern), Callback: callback, Follow: follow}
+}
+
+func (this *Rule) matchPage(p *page.Page) bool {
+	if this.UrlTag != "" && p.GetUrlTag() == this.UrlTag {
+		return true
+	}
+	return this.Match != nil && this.Match.MatchString(p.GetRequest().GetUrl())
+}
+
+// RuleProcessor is a PageProcessor configured by an ordered list of rules.
+//
+// A page is handled by the first rule whose UrlTag equals the page's UrlTag or
+// whose Match matches the page url. The rule's Callback is called and, if Follow
+// is set, the links of the page are offered to every rule in order: a link is
+// scheduled by the first rule whose Links extract it and whose Match accepts it.
+// Pages handled by no rule, such as seeds, are followed but not processed.
+type RuleProcessor struct {
+	rules      []*Rule
+	skipEmpty  bool
+	finishFunc func()
+}
+
+func NewRuleProcessor(rules ...*Rule) *RuleProcessor {
+	return &RuleProcessor{rules: rules, skipEmpty: true}
+}
+
+// AddRule appends rule after the existing rules.
+func (this *RuleProcessor) AddRule(rule *Rule) *RuleProcessor {
+	this.rules = append(this.rules, rule)
+	return this
+}
+
+// GetRules returns the rules in order.
+func (this *RuleProcessor) GetRules() []*Rule {
+	return this.rules
+}
+
+// SetSkipEmpty sets whether pages without fields are kept from the pipelines, default true.
+func (this *RuleProcessor) SetSkipEmpty(skip bool) *RuleProcessor {
+	this.skipEmpty = skip
+	return this
+}
+
+// SetFinish sets the function called by Finish.
+func (this *RuleProcessor) SetFinish(f func()) *RuleProcessor {
+	this.finishFunc = f
+	return this
+}
+
+func (this *RuleProcessor) Process(p *page.Page) {
+	if !p.IsSucc() {
+		return
+	}
+
+	rule := this.ruleFor(p)
+	if rule != nil && rule.Callback != nil {
+		rule.Callback(p)
+	}
+	if rule == nil || rule.Follow {
+		this.follow(p)
+	}
+	if this.skipEmpty && len(p.GetPageItems().GetAll()) == 0 {
+		p.SetSkip(true)
+	}
+}
+
+func (this *RuleProcessor) Finish() {
+	if this.finishFunc != nil {
+		this.finishFunc()
+	}
+}
+
+func (this *RuleProcessor) ruleFor(p *page.Page) *Rule {
+	for _, rule := range this.rules {
+		if rule.matchPage(p) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func (this *RuleProcessor) follow(p *page.Page) {
+	extract := p.ExtractLinks
+	if p.GetFeed() != nil {
+		extract = p.ExtractFeedLinks
+	} else if p.GetHtmlParser() == nil {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, rule := range this.rules {
+		if rule.Match == nil && rule.Links == nil {
+			// Such a rule would follow every link of every page.
+			continue
+		}
+		for _, req := range extract(rule.Links) {
+			if seen[req.GetUrl()] {
+				continue
+			}
+			if rule.Match != nil && !rule.Match.MatchString(req.GetUrl()) {
+				continue
+			}
+			seen[req.GetUrl()] = true
+			if rule.UrlTag != "" {
+				req.UrlTag = rule.UrlTag
+			}
+			if rule.RespType != "" {
+				req.RespType = rule.RespType
+			}
+			p.AddTargetRequestWithParams(req)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/request"
+)
+
+// blockingScheduler makes a Scheduler Blocking. Pushes through it wake up
+// Take at once; the queue of a Shared scheduler is also polled every
+// sharedPoll, other processes push to it, and a Delayed one when its next
+// request is due.
+type blockingScheduler struct {
+	Scheduler
+	shared  Shared
+	delayed Delayed
+
+	mutex sync.Mutex
+	// wake is closed and replaced on each push and done.
+	wake    chan struct{}
+	taken   int
+	drained chan struct{}
+	// isDrained tells whether drained is closed.
+	isDrained bool
+}
+
+const sharedPoll = 500 * time.Millisecond
+
+// NewBlocking returns s when it is Blocking, otherwise s wrapped to be
+// Blocking. Requests must then be pushed through the wrapper to wake Take.
+func NewBlocking(s Scheduler) Blocking {
+	if b, ok := s.(Blocking); ok {
+		return b
+	}
+	this := &blockingScheduler{Scheduler: s, wake: make(chan struct{}), drained: make(chan struct{})}
+	for inner := s; inner != nil; {
+		if shared, ok := inner.(Shared); ok {
+			this.shared = shared
+			break
+		}
+		w, ok := inner.(interface{ Unwrap() Scheduler })
+		if !ok {
+			break
+		}
+		inner = w.Unwrap()
+	}
+	this.delayed, _ = s.(Delayed)
+	this.mutex.Lock()
+	this.update()
+	this.mutex.Unlock()
+	return this
+}
+
+func (this *blockingScheduler) Push(req *request.Request) {
+	this.Scheduler.Push(req)
+	this.mutex.Lock()
+	this.signal()
+	this.update()
+	this.mutex.Unlock()
+}
+
+func (this *blockingScheduler) Take(ctx context.Context) (*request.Request, error) {
+	for ctx.Err() == nil {
+		this.mutex.Lock()
+		if req := this.Scheduler.Poll(); req != nil {
+			this.taken++
+			this.update()
+			this.mutex.Unlock()
+			return req, nil
+		}
+		this.update()
+		wake := this.wake
+		this.mutex.Unlock()
+
+		var wait time.Duration
+		if this.shared != nil {
+			wait = sharedPoll
+		}
+		if this.delayed != nil {
+			if due := this.delayed.NextDue(); !due.IsZero() {
+				if until := time.Until(due) + time.Millisecond; wait == 0 || until < wait {
+					wait = until
+				}
+			}
+		}
+		var timer *time.Timer
+		var poll <-chan time.Time
+		if wait != 0 {
+			timer = time.NewTimer(wait)
+			poll = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-wake:
+		case <-poll:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+	return nil, ctx.Err()
+}
+
+func (this *blockingScheduler) Done(req *request.Request) {
+	this.mutex.Lock()
+	if this.taken > 0 {
+		this.taken--
+	}
+	this.signal()
+	this.update()
+	this.mutex.Unlock()
+}
+
+func (this *blockingScheduler) Outstanding() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.Scheduler.Count() + this.taken
+}
+
+func (this *blockingScheduler) Drained() <-chan struct{} {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.drained
+}
+
+func (this *blockingScheduler) signal() {
+	close(this.wake)
+	this.wake = make(chan struct{})
+}
+
+// update closes drained once nothing is queued nor outstanding, and replaces
+// it when work comes again. The mutex must be held.
+func (this *blockingScheduler) update() {
+	drained := this.taken == 0 && this.Scheduler.Count() == 0
+	if drained && this.shared != nil {
+		drained = this.shared.Processing() == 0
+	}
+	if drained == this.isDrained {
+		return
+	}
+	this.isDrained = drained
+	if drained {
+		close(this.drained)
+	} else {
+		this.drained = make(chan struct{})
+	}
+}
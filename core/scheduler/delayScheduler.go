@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/request"
+)
+
+// DelayScheduler holds the requests whose NotBefore is in the future in a
+// timer heap, and hands them out when due before the requests of the
+// scheduler it wraps. Held requests skip the duplicate check of that
+// scheduler: a request delayed on purpose, e.g. to fetch a page again later,
+// is not a duplicate. They are kept in memory only.
+type DelayScheduler struct {
+	Scheduler
+	mutex sync.Mutex
+	held  delayHeap
+}
+
+// NewDelayScheduler wraps s.
+func NewDelayScheduler(s Scheduler) *DelayScheduler {
+	return &DelayScheduler{Scheduler: s}
+}
+
+// Unwrap returns the wrapped scheduler.
+func (this *DelayScheduler) Unwrap() Scheduler {
+	return this.Scheduler
+}
+
+func (this *DelayScheduler) Push(req *request.Request) {
+	if req.IsDue(time.Now()) {
+		this.Scheduler.Push(req)
+		return
+	}
+	this.mutex.Lock()
+	heap.Push(&this.held, req)
+	this.mutex.Unlock()
+}
+
+func (this *DelayScheduler) Poll() *request.Request {
+	this.mutex.Lock()
+	if len(this.held) > 0 && this.held[0].IsDue(time.Now()) {
+		req := heap.Pop(&this.held).(*request.Request)
+		this.mutex.Unlock()
+		return req
+	}
+	this.mutex.Unlock()
+	return this.Scheduler.Poll()
+}
+
+// Count returns the number of requests queued, held ones included.
+func (this *DelayScheduler) Count() int {
+	return this.Scheduler.Count() + this.Held()
+}
+
+// Held returns the number of requests waiting for their NotBefore time.
+func (this *DelayScheduler) Held() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return len(this.held)
+}
+
+// NextDue returns when the first held request is due, zero when none is held.
+func (this *DelayScheduler) NextDue() time.Time {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if len(this.held) == 0 {
+		return time.Time{}
+	}
+	return this.held[0].GetNotBefore()
+}
+
+// delayHeap orders requests by NotBefore.
+type delayHeap []*request.Request
+
+func (this delayHeap) Len() int {
+	return len(this)
+}
+
+func (this delayHeap) Less(i, j int) bool {
+	return this[i].GetNotBefore().Before(this[j].GetNotBefore())
+}
+
+func (this delayHeap) Swap(i, j int) {
+	this[i], this[j] = this[j], this[i]
+}
+
+func (this *delayHeap) Push(x interface{}) {
+	*this = append(*this, x.(*request.Request))
+}
+
+func (this *delayHeap) Pop() interface{} {
+	old := *this
+	n := len(old)
+	req := old[n-1]
+	old[n-1] = nil
+	*this = old[:n-1]
+	return req
+}
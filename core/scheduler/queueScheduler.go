@@ -2,32 +2,37 @@ package scheduler
 
 import (
 	"container/list"
-	"crypto/md5"
+	"log/slog"
 	"sync"
 
+	"github.com/viixv/crawler/core/commons/logging"
 	"github.com/viixv/crawler/core/commons/request"
 )
 
 type QueueScheduler struct {
-	mutex sync.Mutex
-	rm    bool
-	rmKey map[[md5.Size]byte]*list.Element
-	queue *list.List
+	mutex      sync.Mutex
+	rm         bool
+	rmKey      map[string]*list.Element
+	queue      *list.List
+	duplicates uint64
+	logger     *slog.Logger
 }
 
 func NewQueueScheduler(rmDuplicate bool) *QueueScheduler {
 	queue := list.New()
-	rmKey := make(map[[md5.Size]byte]*list.Element)
+	rmKey := make(map[string]*list.Element)
 	return &QueueScheduler{rm: rmDuplicate, queue: queue, rmKey: rmKey}
 }
 
 func (this *QueueScheduler) Push(req *request.Request) {
 	this.mutex.Lock()
-	var key [md5.Size]byte
+	var key string
 	if this.rm {
-		key = md5.Sum([]byte(req.GetUrl()))
+		key = req.Fingerprint()
 		if _, ok := this.rmKey[key]; ok {
+			this.duplicates++
 			this.mutex.Unlock()
+			logging.Or(this.logger).Debug("duplicate request dropped", logging.Request(req)...)
 			return
 		}
 	}
@@ -46,10 +51,9 @@ func (this *QueueScheduler) Poll() *request.Request {
 	}
 	e := this.queue.Front()
 	req := e.Value.(*request.Request)
-	key := md5.Sum([]byte(req.GetUrl()))
 	this.queue.Remove(e)
 	if this.rm {
-		delete(this.rmKey, key)
+		delete(this.rmKey, req.Fingerprint())
 	}
 	return req
 }
@@ -59,3 +63,15 @@ func (this *QueueScheduler) Count() int {
 	defer this.mutex.Unlock()
 	return this.queue.Len()
 }
+
+// Duplicates returns the number of requests dropped because they were already queued.
+func (this *QueueScheduler) Duplicates() uint64 {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.duplicates
+}
+
+// SetLogger sets the logger of the scheduler, default is slog.Default().
+func (this *QueueScheduler) SetLogger(l *slog.Logger) {
+	this.logger = l
+}
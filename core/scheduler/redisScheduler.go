@@ -0,0 +1,359 @@
+package scheduler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/logging"
+	"github.com/viixv/crawler/core/commons/redis"
+	"github.com/viixv/crawler/core/commons/request"
+)
+
+// RedisScheduler keeps the queue in a Redis compatible server, so that
+// several crawler processes of the same task share it. Keys are namespaced by
+// task, e.g. for task "news":
+//
+//	crawler:news:queue       list of entries waiting, a token and a JSON request
+//	crawler:news:processing  list of entries polled and not leased yet
+//	crawler:news:lease:<id>  the entry of a lease
+//	crawler:news:leases      sorted set of lease ids by deadline
+//	crawler:news:lease_id    counter of the lease ids
+//	crawler:news:seen        set of request fingerprints when removing duplicates
+//
+// Each pushed request gets a random token, so that identical requests are
+// entries of their own. Poll moves an entry to the processing list atomically
+// (RPOPLPUSH) and leases it under a new id in one MULTI/EXEC transaction,
+// which also takes it out of the processing list; Ack removes the lease once
+// the crawler is done with it.
+// Requests whose lease expired, e.g. because their process died, are put back
+// into the queue, as are requests left in the processing list.
+//
+// A crawler using it stops once the queue is empty and no process holds a lease.
+type RedisScheduler struct {
+	client   *redis.Client
+	prefix   string
+	rm       bool
+	leaseTTL time.Duration
+	logger   *slog.Logger
+
+	mutex       sync.Mutex
+	leased      map[*request.Request]int64
+	duplicates  uint64
+	lastReclaim time.Time
+	lastOrphans time.Time
+	// orphans are processing entries without a lease, by first sighting.
+	orphans map[string]time.Time
+}
+
+// NewRedisScheduler creates a scheduler of task on the server of client.
+// If rmDuplicate is set, requests already pushed once are dropped, across processes and runs.
+func NewRedisScheduler(client *redis.Client, task string, rmDuplicate bool) *RedisScheduler {
+	return &RedisScheduler{
+		client:   client,
+		prefix:   "crawler:" + task + ":",
+		rm:       rmDuplicate,
+		leaseTTL: 5 * time.Minute,
+		leased:   make(map[*request.Request]int64),
+		orphans:  make(map[string]time.Time),
+	}
+}
+
+// SetLeaseTTL sets how long a polled request may go unacknowledged before
+// another process gets it. Default 5 minutes.
+func (this *RedisScheduler) SetLeaseTTL(d time.Duration) *RedisScheduler {
+	this.leaseTTL = d
+	return this
+}
+
+// SetLogger sets the logger of the scheduler, default is slog.Default().
+func (this *RedisScheduler) SetLogger(l *slog.Logger) {
+	this.logger = l
+}
+
+func (this *RedisScheduler) key(name string) string {
+	return this.prefix + name
+}
+
+func (this *RedisScheduler) Push(req *request.Request) {
+	if this.rm {
+		added, err := redis.Int64(this.client.Do("SADD", this.key("seen"), req.Fingerprint()))
+		if err != nil {
+			logging.Or(this.logger).Error("redis push failed", append(logging.Request(req), "error", err)...)
+			return
+		}
+		if added == 0 {
+			this.mutex.Lock()
+			this.duplicates++
+			this.mutex.Unlock()
+			logging.Or(this.logger).Debug("duplicate request dropped", logging.Request(req)...)
+			return
+		}
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		logging.Or(this.logger).Error("request encoding failed", append(logging.Request(req), "error", err)...)
+		return
+	}
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		logging.Or(this.logger).Error("redis push failed", append(logging.Request(req), "error", err)...)
+		return
+	}
+	entry := hex.EncodeToString(token) + " " + string(data)
+	if _, err := this.client.Do("LPUSH", this.key("queue"), entry); err != nil {
+		logging.Or(this.logger).Error("redis push failed", append(logging.Request(req), "error", err)...)
+	}
+}
+
+func (this *RedisScheduler) Poll() *request.Request {
+	this.reclaim()
+	entry, err := redis.String(this.client.Do("RPOPLPUSH", this.key("queue"), this.key("processing")))
+	if err == redis.ErrNil {
+		return nil
+	} else if err != nil {
+		logging.Or(this.logger).Error("redis poll failed", "error", err)
+		return nil
+	}
+	id, err := this.lease(entry)
+	if err != nil {
+		// The entry stays in the processing list and is reclaimed as an orphan.
+		logging.Or(this.logger).Error("redis lease failed", "error", err)
+		return nil
+	} else if id == 0 {
+		logging.Or(this.logger).Warn("request re-queued before it was leased", "request", entry)
+		return nil
+	}
+
+	data := entryData(entry)
+	req := &request.Request{}
+	if err := json.Unmarshal([]byte(data), req); err != nil {
+		logging.Or(this.logger).Error("request decoding failed", "data", data, "error", err)
+		this.ack(id)
+		return nil
+	}
+	this.mutex.Lock()
+	this.leased[req] = id
+	this.mutex.Unlock()
+	return req
+}
+
+// lease stores entry under a new lease id and takes it out of the processing
+// list in one transaction. It returns 0 when the entry was no longer there,
+// i.e. another process re-queued it as an orphan meanwhile.
+func (this *RedisScheduler) lease(entry string) (int64, error) {
+	id, err := redis.Int64(this.client.Do("INCR", this.key("lease_id")))
+	if err != nil {
+		return 0, err
+	}
+	deadline := time.Now().Add(this.leaseTTL).UnixMilli()
+	replies, err := this.client.Multi(
+		[]interface{}{"LREM", this.key("processing"), 1, entry},
+		[]interface{}{"SET", this.leaseKey(id), entry},
+		[]interface{}{"ZADD", this.key("leases"), deadline, id},
+	)
+	if err != nil {
+		return 0, err
+	}
+	if removed, err := redis.Int64(replies[0], nil); err != nil || removed == 0 {
+		this.ack(id)
+		return 0, err
+	}
+	return id, nil
+}
+
+// entryData returns the JSON request of a queue entry. Entries pushed
+// before tokens were added hold the JSON request only.
+func entryData(entry string) string {
+	if i := strings.IndexByte(entry, ' '); i >= 0 && !strings.HasPrefix(entry, "{") {
+		return entry[i+1:]
+	}
+	return entry
+}
+
+func (this *RedisScheduler) leaseKey(id int64) string {
+	return this.key("lease:" + strconv.FormatInt(id, 10))
+}
+
+// Ack tells the scheduler the crawler is done with a polled request.
+func (this *RedisScheduler) Ack(req *request.Request) {
+	this.mutex.Lock()
+	id, ok := this.leased[req]
+	delete(this.leased, req)
+	this.mutex.Unlock()
+	if ok {
+		this.ack(id)
+	}
+}
+
+func (this *RedisScheduler) ack(id int64) {
+	removed, err := redis.Int64(this.client.Do("ZREM", this.key("leases"), id))
+	if err != nil {
+		logging.Or(this.logger).Error("redis ack failed", "error", err)
+		return
+	}
+	if removed == 1 {
+		// Otherwise the lease expired and was re-queued, which removes the key.
+		this.client.Do("DEL", this.leaseKey(id))
+	}
+}
+
+// Count returns the number of requests waiting in the queue.
+func (this *RedisScheduler) Count() int {
+	n, err := redis.Int64(this.client.Do("LLEN", this.key("queue")))
+	if err != nil {
+		logging.Or(this.logger).Error("redis count failed", "error", err)
+		return 0
+	}
+	return int(n)
+}
+
+// Processing returns the number of requests polled by any process and not acknowledged yet.
+func (this *RedisScheduler) Processing() int {
+	leases, err := redis.Int64(this.client.Do("ZCARD", this.key("leases")))
+	if err != nil {
+		return 0
+	}
+	unleased, err := redis.Int64(this.client.Do("LLEN", this.key("processing")))
+	if err != nil {
+		return 0
+	}
+	return int(leases + unleased)
+}
+
+// Duplicates returns the number of requests this process dropped as duplicates.
+func (this *RedisScheduler) Duplicates() uint64 {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.duplicates
+}
+
+// Clear deletes every key of the task, including the dedupe set.
+func (this *RedisScheduler) Clear() error {
+	ids, err := redis.Strings(this.client.Do("ZRANGEBYSCORE", this.key("leases"), "-inf", "+inf"))
+	if err != nil {
+		return err
+	}
+	args := []interface{}{"DEL", this.key("queue"), this.key("processing"), this.key("leases"), this.key("lease_id"), this.key("seen")}
+	for _, id := range ids {
+		args = append(args, this.key("lease:"+id))
+	}
+	_, err = this.client.Do(args...)
+	return err
+}
+
+// reclaim puts the requests of expired leases back into the queue, at most once a second.
+// Removing from the processing list first makes sure only one process re-queues a request.
+func (this *RedisScheduler) reclaim() {
+	this.mutex.Lock()
+	if time.Since(this.lastReclaim) < time.Second {
+		this.mutex.Unlock()
+		return
+	}
+	this.lastReclaim = time.Now()
+	this.mutex.Unlock()
+
+	now := time.Now()
+	expired, err := redis.Strings(this.client.Do("ZRANGEBYSCORE", this.key("leases"), "-inf", now.UnixMilli(), "LIMIT", 0, 100))
+	if err != nil {
+		logging.Or(this.logger).Error("redis reclaim failed", "error", err)
+		return
+	}
+	for _, id := range expired {
+		this.requeueLease(id)
+	}
+	this.reclaimOrphans(now)
+}
+
+// requeueLease puts the request of an expired lease back into the queue.
+// Removing the lease first makes sure only one process re-queues it.
+func (this *RedisScheduler) requeueLease(id string) {
+	key := this.key("lease:" + id)
+	entry, err := redis.String(this.client.Do("GET", key))
+	if err != nil && err != redis.ErrNil {
+		logging.Or(this.logger).Error("redis reclaim failed", "error", err)
+		return
+	}
+	removed, err := redis.Int64(this.client.Do("ZREM", this.key("leases"), id))
+	if err != nil {
+		logging.Or(this.logger).Error("redis reclaim failed", "error", err)
+		return
+	}
+	if removed == 0 {
+		// Acknowledged or re-queued by another process meanwhile.
+		return
+	}
+	this.client.Do("DEL", key)
+	if entry == "" {
+		return
+	}
+	// RPUSH puts it at the polling end of the queue, it is next.
+	if _, err := this.client.Do("RPUSH", this.key("queue"), entry); err != nil {
+		logging.Or(this.logger).Error("redis reclaim failed", "error", err)
+		return
+	}
+	logging.Or(this.logger).Warn("expired lease, request re-queued", "lease_ttl", this.leaseTTL, "request", entry)
+}
+
+// reclaimOrphans re-queues requests left in the processing list, e.g. by a
+// process which died before leasing them, once they were seen there for a
+// whole lease TTL.
+func (this *RedisScheduler) reclaimOrphans(now time.Time) {
+	this.mutex.Lock()
+	if now.Sub(this.lastOrphans) < this.leaseTTL/4 {
+		this.mutex.Unlock()
+		return
+	}
+	this.lastOrphans = now
+	this.mutex.Unlock()
+
+	processing, err := redis.Strings(this.client.Do("LRANGE", this.key("processing"), 0, 999))
+	if err != nil {
+		return
+	}
+	present := make(map[string]bool, len(processing))
+	for _, entry := range processing {
+		present[entry] = true
+		this.mutex.Lock()
+		first, ok := this.orphans[entry]
+		if !ok {
+			this.orphans[entry] = now
+		}
+		this.mutex.Unlock()
+		if ok && now.Sub(first) >= this.leaseTTL {
+			this.requeueOrphan(entry)
+		}
+	}
+	this.mutex.Lock()
+	for entry := range this.orphans {
+		if !present[entry] {
+			delete(this.orphans, entry)
+		}
+	}
+	this.mutex.Unlock()
+}
+
+func (this *RedisScheduler) requeueOrphan(entry string) {
+	removed, err := redis.Int64(this.client.Do("LREM", this.key("processing"), 1, entry))
+	if err != nil {
+		logging.Or(this.logger).Error("redis reclaim failed", "error", err)
+		return
+	}
+	if removed == 0 {
+		// Leased or re-queued by another process meanwhile.
+		return
+	}
+	this.mutex.Lock()
+	delete(this.orphans, entry)
+	this.mutex.Unlock()
+	if _, err := this.client.Do("RPUSH", this.key("queue"), entry); err != nil {
+		logging.Or(this.logger).Error("redis reclaim failed", "error", err)
+		return
+	}
+	logging.Or(this.logger).Warn("unleased request re-queued", "lease_ttl", this.leaseTTL, "request", entry)
+}
@@ -0,0 +1,238 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/redis"
+	"github.com/viixv/crawler/core/commons/request"
+)
+
+// newRedis starts an in-process Redis stand-in and returns a client of it.
+func newRedis(t *testing.T) *redis.Client {
+	s := redis.NewServer()
+	addr, err := s.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := redis.NewClient(addr).SetTimeout(5 * time.Second)
+	t.Cleanup(func() {
+		client.Close()
+		s.Close()
+	})
+	return client
+}
+
+// expire makes the next Poll reclaim leases at once.
+func expire(s *RedisScheduler) {
+	s.mutex.Lock()
+	s.lastReclaim = time.Time{}
+	s.lastOrphans = time.Time{}
+	s.mutex.Unlock()
+}
+
+func TestRedisSchedulerPushPollAck(t *testing.T) {
+	s := NewRedisScheduler(newRedis(t), "t", false)
+	s.Push(request.New("http://a/1").Build())
+	s.Push(request.New("http://a/2").Build())
+	if n := s.Count(); n != 2 {
+		t.Fatalf("Count = %d, want 2", n)
+	}
+
+	first := s.Poll()
+	if first == nil || first.GetUrl() != "http://a/1" {
+		t.Fatalf("Poll = %v, want http://a/1 first", first)
+	}
+	second := s.Poll()
+	if second == nil || second.GetUrl() != "http://a/2" {
+		t.Fatalf("Poll = %v, want http://a/2", second)
+	}
+	if req := s.Poll(); req != nil {
+		t.Fatalf("Poll of an empty queue = %v", req)
+	}
+	if n := s.Processing(); n != 2 {
+		t.Fatalf("Processing = %d, want 2", n)
+	}
+	s.Ack(first)
+	s.Ack(second)
+	if n := s.Processing(); n != 0 {
+		t.Fatalf("Processing after Ack = %d, want 0", n)
+	}
+}
+
+func TestRedisSchedulerDedupe(t *testing.T) {
+	client := newRedis(t)
+	s := NewRedisScheduler(client, "t", true)
+	s.Push(request.New("http://a/1").Build())
+	s.Push(request.New("http://a/1").Build())
+	if n, d := s.Count(), s.Duplicates(); n != 1 || d != 1 {
+		t.Fatalf("Count, Duplicates = %d, %d, want 1, 1", n, d)
+	}
+
+	// The seen set is shared by the processes of the task and outlives the queue.
+	s.Ack(s.Poll())
+	other := NewRedisScheduler(client, "t", true)
+	other.Push(request.New("http://a/1").Build())
+	if n := other.Count(); n != 0 {
+		t.Fatalf("Count after a push seen by another process = %d, want 0", n)
+	}
+}
+
+func TestRedisSchedulerNamespaces(t *testing.T) {
+	client := newRedis(t)
+	news := NewRedisScheduler(client, "news", true)
+	shop := NewRedisScheduler(client, "shop", true)
+	news.Push(request.New("http://a/1").Build())
+	shop.Push(request.New("http://a/1").Build())
+	shop.Push(request.New("http://a/2").Build())
+	if n, m := news.Count(), shop.Count(); n != 1 || m != 2 {
+		t.Fatalf("Count = %d, %d, want 1, 2", n, m)
+	}
+	if err := news.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if n, m := news.Count(), shop.Count(); n != 0 || m != 2 {
+		t.Fatalf("Count after Clear = %d, %d, want 0, 2", n, m)
+	}
+	news.Push(request.New("http://a/1").Build())
+	if n := news.Count(); n != 1 {
+		t.Fatalf("Count after Clear and Push = %d, want 1, the seen set is cleared too", n)
+	}
+}
+
+func TestRedisSchedulerLeaseExpiry(t *testing.T) {
+	client := newRedis(t)
+	dead := NewRedisScheduler(client, "t", false).SetLeaseTTL(50 * time.Millisecond)
+	alive := NewRedisScheduler(client, "t", false).SetLeaseTTL(50 * time.Millisecond)
+	dead.Push(request.New("http://a/1").Build())
+	if req := dead.Poll(); req == nil {
+		t.Fatal("Poll = nil")
+	}
+	// The process holding the lease dies without acknowledging it.
+	if req := alive.Poll(); req != nil {
+		t.Fatalf("Poll of a leased request = %v", req)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	expire(alive)
+	req := alive.Poll()
+	if req == nil || req.GetUrl() != "http://a/1" {
+		t.Fatalf("Poll after the lease expired = %v, want http://a/1", req)
+	}
+	alive.Ack(req)
+	if n := alive.Processing(); n != 0 {
+		t.Fatalf("Processing = %d, want 0", n)
+	}
+}
+
+func TestRedisSchedulerIdenticalLeases(t *testing.T) {
+	s := NewRedisScheduler(newRedis(t), "t", false).SetLeaseTTL(time.Hour)
+	s.Push(request.New("http://a/1").Build())
+	s.Push(request.New("http://a/1").Build())
+	first, second := s.Poll(), s.Poll()
+	if first == nil || second == nil {
+		t.Fatal("Poll = nil")
+	}
+	s.Ack(first)
+	if n := s.Processing(); n != 1 {
+		t.Fatalf("Processing after acknowledging one of two identical requests = %d, want 1", n)
+	}
+	expire(s)
+	if req := s.Poll(); req != nil {
+		t.Fatalf("Poll = %v, the other lease must not be reclaimed", req)
+	}
+	s.Ack(second)
+	if n := s.Processing(); n != 0 {
+		t.Fatalf("Processing = %d, want 0", n)
+	}
+}
+
+func TestRedisSchedulerOrphans(t *testing.T) {
+	client := newRedis(t)
+	s := NewRedisScheduler(client, "t", false).SetLeaseTTL(50 * time.Millisecond)
+	// A process died between taking the request and leasing it.
+	client.Do("RPUSH", s.key("processing"), `{"url":"http://a/1"}`)
+	expire(s)
+	if req := s.Poll(); req != nil {
+		t.Fatalf("Poll = %v, an orphan is re-queued after a whole lease TTL only", req)
+	}
+	time.Sleep(100 * time.Millisecond)
+	expire(s)
+	if req := s.Poll(); req == nil || req.GetUrl() != "http://a/1" {
+		t.Fatalf("Poll = %v, want the orphan", req)
+	}
+}
+
+func TestRedisSchedulerMeta(t *testing.T) {
+	s := NewRedisScheduler(newRedis(t), "t", false)
+	s.Push(request.New("http://a/1").RespType("json").Tag("list").Meta("page", "2").Meta("anchor_text", "next »").Build())
+	req := s.Poll()
+	if req == nil {
+		t.Fatal("Poll = nil")
+	}
+	if req.GetResponceType() != "json" || req.GetUrlTag() != "list" {
+		t.Errorf("resp type, tag = %q, %q", req.GetResponceType(), req.GetUrlTag())
+	}
+	if v := req.GetMetaValue("page"); v != "2" {
+		t.Errorf("meta page = %q, want 2", v)
+	}
+	if v := req.GetMetaValue("anchor_text"); v != "next »" {
+		t.Errorf("meta anchor_text = %q", v)
+	}
+}
+
+func TestRedisSchedulerOrphanLeasedMeanwhile(t *testing.T) {
+	client := newRedis(t)
+	s := NewRedisScheduler(client, "t", false).SetLeaseTTL(50 * time.Millisecond)
+	s.Push(request.New("http://a/1").Build())
+	// Another process took the request and is about to lease it when s
+	// re-queues it as an orphan: the lease must not go through.
+	entry, err := redis.String(client.Do("RPOPLPUSH", s.key("queue"), s.key("processing")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expire(s)
+	s.Poll()
+	time.Sleep(100 * time.Millisecond)
+	expire(s)
+	req := s.Poll()
+	if req == nil || req.GetUrl() != "http://a/1" {
+		t.Fatalf("Poll = %v, want the orphan", req)
+	}
+	other := NewRedisScheduler(client, "t", false)
+	if id, err := other.lease(entry); err != nil || id != 0 {
+		t.Fatalf("lease of a re-queued entry = %d, %v, want 0", id, err)
+	}
+	s.Ack(req)
+	if n, m := s.Processing(), s.Count(); n != 0 || m != 0 {
+		t.Fatalf("Processing, Count = %d, %d, want 0, 0", n, m)
+	}
+}
+
+func TestRedisSchedulerIdenticalOrphans(t *testing.T) {
+	client := newRedis(t)
+	s := NewRedisScheduler(client, "t", false).SetLeaseTTL(50 * time.Millisecond)
+	// An orphan seen once, then leased by another process before it was re-queued.
+	s.Push(request.New("http://a/1").Build())
+	client.Do("RPOPLPUSH", s.key("queue"), s.key("processing"))
+	expire(s)
+	s.Poll()
+	other := NewRedisScheduler(client, "t", false)
+	entries, _ := redis.Strings(client.Do("LRANGE", s.key("processing"), 0, 0))
+	if len(entries) != 1 {
+		t.Fatalf("processing = %q, want the orphan", entries)
+	}
+	if id, err := other.lease(entries[0]); err != nil || id == 0 {
+		t.Fatalf("lease = %d, %v", id, err)
+	}
+
+	// An identical request is polled by a process and sits in the processing
+	// list when s looks for orphans: it is not the orphan seen before.
+	s.Push(request.New("http://a/1").Build())
+	client.Do("RPOPLPUSH", s.key("queue"), s.key("processing"))
+	time.Sleep(100 * time.Millisecond)
+	expire(s)
+	if req := s.Poll(); req != nil {
+		t.Fatalf("Poll = %v, a request just taken by a process is not an orphan", req)
+	}
+}
@@ -6,6 +6,9 @@
 package scheduler
 
 import (
+	"context"
+	"time"
+
 	"github.com/viixv/crawler/core/commons/request"
 )
 
@@ -14,3 +17,45 @@ type Scheduler interface {
 	Poll() *request.Request
 	Count() int
 }
+
+// Blocking is a Scheduler the crawler waits on instead of polling it. A
+// request is outstanding from Push until Done is called on it, which the
+// crawler does after pushing the requests found on its page: nothing is queued
+// nor outstanding only when the crawl is complete. See NewBlocking to wrap a
+// Scheduler.
+type Blocking interface {
+	Scheduler
+	// Take returns the next request, waiting for one until ctx is done.
+	Take(ctx context.Context) (*request.Request, error)
+	// Done tells the scheduler the crawler finished a request returned by Take.
+	Done(req *request.Request)
+	// Outstanding returns the number of requests queued or taken and not done.
+	Outstanding() int
+	// Drained returns a channel closed while nothing is queued nor outstanding.
+	Drained() <-chan struct{}
+}
+
+// Delayed is implemented by schedulers holding requests until their NotBefore time.
+type Delayed interface {
+	// NextDue returns when the next held request is due, zero when none is held.
+	NextDue() time.Time
+}
+
+// DuplicateCounter is implemented by schedulers that drop duplicate requests.
+type DuplicateCounter interface {
+	Duplicates() uint64
+}
+
+// Acker is implemented by schedulers that need to know when the crawler is
+// done with a polled request, e.g. to lease requests shared between processes.
+type Acker interface {
+	Ack(req *request.Request)
+}
+
+// Shared is implemented by schedulers whose queue is shared between
+// processes. Processing returns the requests polled by any process and not
+// acknowledged yet, they may add requests to the queue: a crawler does not
+// consider its crawl complete while it is not zero.
+type Shared interface {
+	Processing() int
+}
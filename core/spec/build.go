@@ -0,0 +1,309 @@
+package spec
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/viixv/crawler/core/article"
+	"github.com/viixv/crawler/core/commons/controller"
+	"github.com/viixv/crawler/core/commons/page"
+	"github.com/viixv/crawler/core/commons/request"
+	"github.com/viixv/crawler/core/commons/structured"
+	"github.com/viixv/crawler/core/commons/task"
+	"github.com/viixv/crawler/core/crawler"
+	"github.com/viixv/crawler/core/deadletter"
+	"github.com/viixv/crawler/core/incremental"
+	"github.com/viixv/crawler/core/neardup"
+	"github.com/viixv/crawler/core/pipeline"
+	"github.com/viixv/crawler/core/processor"
+	"github.com/viixv/crawler/core/scheduler"
+)
+
+// Processor builds the RuleProcessor described by the rules of the spec.
+func (this *Spec) Processor() (*processor.RuleProcessor, error) {
+	rp := processor.NewRuleProcessor()
+	for i, rs := range this.Rules {
+		rule, err := this.buildRule(rs)
+		if err != nil {
+			return nil, fmt.Errorf("rules[%d]: %s", i, err.Error())
+		}
+		rp.AddRule(rule)
+	}
+	return rp, nil
+}
+
+// Build returns a crawler set up as described by the spec, with the seeds added.
+func (this *Spec) Build() (*crawler.Crawler, error) {
+	c, err := this.BuildWithoutSeeds()
+	if err != nil {
+		return nil, err
+	}
+	respType := this.RespType
+	if respType == "" {
+		respType = "html"
+	}
+	c.AddUrls(this.Seeds, respType)
+	return c, nil
+}
+
+// BuildWithoutSeeds is like Build but leaves the scheduler empty.
+func (this *Spec) BuildWithoutSeeds() (*crawler.Crawler, error) {
+	if err := this.Validate(); err != nil {
+		return nil, err
+	}
+	rp, err := this.Processor()
+	if err != nil {
+		return nil, err
+	}
+
+	c := crawler.NewCrawler(rp, this.Name)
+	c.SetScheduler(scheduler.NewQueueScheduler(this.Dedupe))
+	if this.Threads > 0 {
+		c.SetThreadnum(this.Threads)
+	}
+	if a := this.Adaptive; a != nil {
+		cc := controller.NewGoroutineControllerAdaptive(a.Min, a.Max)
+		if a.HostMax > 0 {
+			cc.SetHostLimits(a.HostMin, a.HostMax)
+		}
+		cc.SetLatencyTarget(time.Duration(a.LatencyTarget) * time.Millisecond)
+		c.SetController(cc)
+	}
+	if s := this.Sleep; s != nil {
+		sleepType := s.Type
+		if sleepType == "" {
+			sleepType = "fixed"
+		}
+		c.SetSleepTime(sleepType, s.Min, s.Max)
+	}
+	if limits := this.RequestLimits(); limits != nil {
+		c.SetRequestLimits(limits)
+	}
+
+	t, err := this.Tracker()
+	if err != nil {
+		return nil, err
+	}
+	if t != nil {
+		c.SetIncremental(t)
+	}
+
+	if nd := this.NearDuplicates; nd != nil {
+		distance := nd.Distance
+		if distance == 0 {
+			distance = neardup.DefaultDistance
+		}
+		d, err := neardup.NewDetector(distance)
+		if err != nil {
+			return nil, fmt.Errorf("near_duplicates: %s", err.Error())
+		}
+		if nd.Action != "" {
+			d.SetAction(nd.Action)
+		}
+		if nd.MinFeatures > 0 {
+			d.SetMinFeatures(nd.MinFeatures)
+		}
+		c.UseResponse(d)
+	}
+
+	// Files are opened last, nothing fails after them.
+	pipes, err := this.BuildPipelines()
+	if err != nil {
+		return nil, err
+	}
+	h, err := this.ErrorHandler()
+	if err != nil {
+		CloseAll(pipes, nil)
+		return nil, err
+	}
+	for _, pipe := range pipes {
+		c.AddPipeline(pipe)
+	}
+	if h != nil {
+		c.SetErrorHandler(h)
+	}
+	// The crawler forgets its pipelines when Run returns, their files are closed then.
+	c.OnFinish(func(t task.Task) {
+		CloseAll(pipes, h)
+	})
+	return c, nil
+}
+
+// CloseAll closes the pipelines and the error handler which hold a file, h may be nil.
+func CloseAll(pipes []pipeline.Pipeline, h deadletter.ErrorHandler) {
+	for _, pipe := range pipes {
+		if closer, ok := pipe.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+	if closer, ok := h.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// RequestLimits returns the defaults of every request, nil when limits is not set.
+func (this *Spec) RequestLimits() *request.Limits {
+	l := this.Limits
+	if l == nil {
+		return nil
+	}
+	limits := &request.Limits{Timeout: time.Duration(l.Timeout) * time.Millisecond, MaxBodyBytes: l.MaxBodyBytes, BodyLimit: l.BodyLimit}
+	if l.MaxRedirects != 0 || l.SameHost {
+		limits.Redirect = &request.RedirectPolicy{MaxRedirects: l.MaxRedirects, SameHost: l.SameHost}
+	}
+	return limits
+}
+
+// BuildPipelines returns the pipelines of the spec, the console when none is set.
+func (this *Spec) BuildPipelines() ([]pipeline.Pipeline, error) {
+	specs := this.Pipelines
+	if len(specs) == 0 {
+		specs = []*PipelineSpec{{Type: "console"}}
+	}
+	pipes := make([]pipeline.Pipeline, 0, len(specs))
+	for i, ps := range specs {
+		pipe, err := buildPipeline(ps)
+		if err != nil {
+			CloseAll(pipes, nil)
+			return nil, fmt.Errorf("pipelines[%d]: %s", i, err.Error())
+		}
+		pipes = append(pipes, pipe)
+	}
+	return pipes, nil
+}
+
+// ErrorHandler returns the dead letter handler of the spec, nil when dead_letter is not set.
+func (this *Spec) ErrorHandler() (deadletter.ErrorHandler, error) {
+	if this.DeadLetter == "" {
+		return nil, nil
+	}
+	h, err := deadletter.NewJsonLinesHandler(this.DeadLetter)
+	if err != nil {
+		return nil, fmt.Errorf("dead_letter: %s", err.Error())
+	}
+	return h, nil
+}
+
+// Tracker returns the incremental tracker of the spec, nil when the crawl is not incremental.
+func (this *Spec) Tracker() (*incremental.Tracker, error) {
+	inc := this.Incremental
+	if inc == nil {
+		return nil, nil
+	}
+	var store incremental.Store = incremental.NewMemoryStore()
+	if inc.Store != "" {
+		fs, err := incremental.NewFileStore(inc.Store)
+		if err != nil {
+			return nil, fmt.Errorf("incremental.store: %s", err.Error())
+		}
+		store = fs
+	}
+	fingerprint := inc.Fingerprint
+	if fingerprint == "" {
+		fingerprint = incremental.FingerprintBody
+	}
+	t, err := incremental.NewTracker(store, fingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("incremental: %s", err.Error())
+	}
+	interval := time.Duration(inc.Interval) * time.Second
+	switch inc.Revisit {
+	case "fixed":
+		t.SetRevisitPolicy(incremental.FixedInterval(interval))
+	case "adaptive":
+		t.SetRevisitPolicy(&incremental.Adaptive{Min: interval, Max: time.Duration(inc.MaxInterval) * time.Second})
+	}
+	return t.SetEmitUnchanged(inc.EmitUnchanged), nil
+}
+
+func (this *Spec) buildRule(rs *RuleSpec) (*processor.Rule, error) {
+	rule := &processor.Rule{Follow: rs.Follow, UrlTag: rs.Tag, RespType: rs.RespType}
+	if rs.Match != "" {
+		rule.Match = regexp.MustCompile(rs.Match)
+	}
+
+	opts := &page.LinkOptions{AllowDomains: this.AllowedDomains}
+	if l := rs.Links; l != nil {
+		opts.Restrict = l.Restrict
+		opts.Tags = l.Tags
+		opts.DenyExtensions = l.DenyExtensions
+		opts.SkipNofollow = l.SkipNofollow
+		for _, p := range l.Allow {
+			opts.Allow = append(opts.Allow, regexp.MustCompile(p))
+		}
+		for _, p := range l.Deny {
+			opts.Deny = append(opts.Deny, regexp.MustCompile(p))
+		}
+	}
+	if rs.Links != nil || rs.Match != "" {
+		// A rule with only a tag handles pages but does not pick links.
+		rule.Links = opts
+	}
+
+	var fields []*field
+	if len(rs.Fields) > 0 {
+		fields = make([]*field, 0, len(rs.Fields))
+		for _, fs := range rs.Fields {
+			ex, err := NewExtractor(fs)
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %s", fs.Name, err.Error())
+			}
+			fields = append(fields, &field{spec: fs, ex: ex})
+		}
+	}
+	if len(fields) > 0 || rs.Article || len(rs.Structured) > 0 {
+		rule.Callback = func(p *page.Page) {
+			if rs.Article {
+				article.Fill(p)
+			}
+			if len(rs.Structured) > 0 {
+				structured.AddAll(p.GetPageItems(), p.StructuredDataOf(rs.Structured...))
+			}
+			extractFields(p, fields)
+		}
+	}
+	return rule, nil
+}
+
+type field struct {
+	spec *FieldSpec
+	ex   Extractor
+}
+
+func extractFields(p *page.Page, fields []*field) {
+	for _, f := range fields {
+		values := f.ex.Extract(p)
+		var value string
+		if f.spec.All {
+			sep := f.spec.Separator
+			if sep == "" {
+				sep = ","
+			}
+			value = strings.Join(values, sep)
+		} else if len(values) > 0 {
+			value = values[0]
+		}
+		if value == "" {
+			if f.spec.Required {
+				p.SetSkip(true)
+			}
+			continue
+		}
+		p.AddField(f.spec.Name, value)
+	}
+}
+
+func buildPipeline(ps *PipelineSpec) (pipeline.Pipeline, error) {
+	switch ps.Type {
+	case "console":
+		return pipeline.NewConsolePipeline(), nil
+	case "file":
+		return pipeline.NewFilePipeline(ps.Path), nil
+	case "jsonl":
+		return pipeline.NewJsonPipeline(ps.Path)
+	}
+	return nil, fmt.Errorf("unknown pipeline type %q", ps.Type)
+}
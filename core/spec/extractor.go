@@ -0,0 +1,185 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+	"github.com/viixv/crawler/core/commons/jsonpath"
+	"github.com/viixv/crawler/core/commons/page"
+	"github.com/viixv/crawler/core/commons/xmldoc"
+)
+
+// Extractor returns every value a field selects on a page.
+type Extractor interface {
+	Extract(p *page.Page) []string
+}
+
+// NewExtractor compiles the selector of a field.
+func NewExtractor(f *FieldSpec) (Extractor, error) {
+	set := 0
+	for _, s := range []string{f.CSS, f.XPath, f.Regex, f.Json} {
+		if s != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.New("exactly one of css, xpath, regex, json must be set")
+	}
+
+	switch {
+	case f.CSS != "":
+		// The selector must suit html or xml pages, e.g. soap|Body is for xml only.
+		_, htmlErr := cascadia.Compile(f.CSS)
+		var xmlExpr *xpath.Expr
+		if x, err := xmldoc.Selector(f.CSS); err == nil {
+			xmlExpr, _ = xpath.Compile(x)
+		}
+		if htmlErr != nil && xmlExpr == nil {
+			return nil, fmt.Errorf("css: %s", htmlErr.Error())
+		}
+		return &cssExtractor{selector: f.CSS, attr: f.Attr, html: htmlErr == nil, xml: xmlExpr}, nil
+	case f.XPath != "":
+		expr, err := xpath.Compile(f.XPath)
+		if err != nil {
+			return nil, fmt.Errorf("xpath: %s", err.Error())
+		}
+		return &xpathExtractor{expr: expr, attr: f.Attr}, nil
+	case f.Regex != "":
+		re, err := regexp.Compile(f.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("regex: %s", err.Error())
+		}
+		group := 0
+		if re.NumSubexp() > 0 {
+			group = 1
+		}
+		if f.Group != nil {
+			group = *f.Group
+		}
+		if group < 0 || group > re.NumSubexp() {
+			return nil, fmt.Errorf("group: %d is out of range, the regex has %d groups", group, re.NumSubexp())
+		}
+		return &regexExtractor{re: re, group: group}, nil
+	default:
+		path, err := jsonpath.Compile(f.Json)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonExtractor{path: path}, nil
+	}
+}
+
+type cssExtractor struct {
+	selector string
+	attr     string
+	html     bool
+	xml      *xpath.Expr
+}
+
+func (this *cssExtractor) Extract(p *page.Page) []string {
+	if x := p.GetXml(); x != nil {
+		if this.xml == nil {
+			return nil
+		}
+		return xmlValues(xmlquery.QuerySelectorAll(x, this.xml), this.attr)
+	}
+	doc := p.GetHtmlParser()
+	if doc == nil || !this.html {
+		return nil
+	}
+	var values []string
+	doc.Find(this.selector).Each(func(i int, s *goquery.Selection) {
+		switch this.attr {
+		case "", "text":
+			values = append(values, strings.TrimSpace(s.Text()))
+		case "html":
+			if h, err := s.Html(); err == nil {
+				values = append(values, strings.TrimSpace(h))
+			}
+		default:
+			if v, ok := s.Attr(this.attr); ok {
+				values = append(values, v)
+			}
+		}
+	})
+	return values
+}
+
+type xpathExtractor struct {
+	expr *xpath.Expr
+	attr string
+}
+
+func (this *xpathExtractor) Extract(p *page.Page) []string {
+	if x := p.GetXml(); x != nil {
+		return xmlValues(xmlquery.QuerySelectorAll(x, this.expr), this.attr)
+	}
+	doc := p.GetHtmlParser()
+	if doc == nil || len(doc.Nodes) == 0 {
+		return nil
+	}
+	var values []string
+	for _, n := range htmlquery.QuerySelectorAll(doc.Nodes[0], this.expr) {
+		switch this.attr {
+		case "", "text":
+			values = append(values, strings.TrimSpace(htmlquery.InnerText(n)))
+		case "html":
+			values = append(values, htmlquery.OutputHTML(n, true))
+		default:
+			if htmlquery.ExistsAttr(n, this.attr) {
+				values = append(values, htmlquery.SelectAttr(n, this.attr))
+			}
+		}
+	}
+	return values
+}
+
+// xmlValues is like the values of html nodes, "html" gives the markup of the node.
+func xmlValues(nodes []*xmlquery.Node, attr string) []string {
+	var values []string
+	for _, n := range nodes {
+		switch attr {
+		case "", "text":
+			values = append(values, strings.TrimSpace(n.InnerText()))
+		case "html", "xml":
+			values = append(values, n.OutputXML(true))
+		default:
+			if v, ok := xmldoc.Attr(n, attr); ok {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+type regexExtractor struct {
+	re    *regexp.Regexp
+	group int
+}
+
+func (this *regexExtractor) Extract(p *page.Page) []string {
+	var values []string
+	for _, m := range this.re.FindAllStringSubmatch(p.GetBodyStr(), -1) {
+		values = append(values, m[this.group])
+	}
+	return values
+}
+
+type jsonExtractor struct {
+	path *jsonpath.Path
+}
+
+func (this *jsonExtractor) Extract(p *page.Page) []string {
+	js := p.GetJson()
+	if js == nil {
+		return nil
+	}
+	return jsonpath.NewResult(this.path.Find(js.Interface()), nil).Strings()
+}
@@ -0,0 +1,406 @@
+// Package spec builds crawlers from declarative YAML or JSON definitions.
+//
+// A minimal spec:
+//
+//	name: pearvideo
+//	seeds: ["http://www.pearvideo.com/popular"]
+//	allowed_domains: [pearvideo.com]
+//	threads: 8
+//	rules:
+//	  - match: 'video_\d+'
+//	    fields:
+//	      - {name: title, css: "#share-to", attr: data-title}
+//	pipelines:
+//	  - {type: console}
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/viixv/crawler/core/commons/request"
+	"github.com/viixv/crawler/core/incremental"
+	"github.com/viixv/crawler/core/neardup"
+	"gopkg.in/yaml.v2"
+)
+
+// Spec describes a whole crawl.
+type Spec struct {
+	// Name is the task name of the crawler.
+	Name string `yaml:"name" json:"name"`
+	// Seeds are the start urls.
+	Seeds []string `yaml:"seeds" json:"seeds"`
+	// RespType of the seeds: html, json, jsonp, text, feed or xml. Default html.
+	RespType string `yaml:"resp_type" json:"resp_type"`
+	// AllowedDomains restricts followed links to these domains and their sub domains.
+	AllowedDomains []string `yaml:"allowed_domains" json:"allowed_domains"`
+	// Threads is the number of concurrent downloads. Default 1.
+	Threads uint `yaml:"threads" json:"threads"`
+	// Adaptive replaces the fixed Threads by a limit adapted to the servers.
+	Adaptive *AdaptiveSpec `yaml:"adaptive" json:"adaptive"`
+	// Sleep is the pause before each download.
+	Sleep *SleepSpec `yaml:"sleep" json:"sleep"`
+	// Limits are the defaults of every request.
+	Limits *LimitsSpec `yaml:"limits" json:"limits"`
+	// Dedupe drops urls already waiting in the queue.
+	Dedupe bool `yaml:"dedupe" json:"dedupe"`
+	// Rules are evaluated in order, see processor.RuleProcessor.
+	Rules []*RuleSpec `yaml:"rules" json:"rules"`
+	// Pipelines receive the extracted fields. Default is the console.
+	Pipelines []*PipelineSpec `yaml:"pipelines" json:"pipelines"`
+	// DeadLetter is a JSON Lines file receiving the requests that failed.
+	DeadLetter string `yaml:"dead_letter" json:"dead_letter"`
+	// Incremental remembers the pages crawled, see incremental.Tracker.
+	Incremental *IncrementalSpec `yaml:"incremental" json:"incremental"`
+	// NearDuplicates compares the content of the pages, see neardup.Detector.
+	NearDuplicates *NearDuplicatesSpec `yaml:"near_duplicates" json:"near_duplicates"`
+}
+
+// NearDuplicatesSpec mirrors neardup.Detector.
+type NearDuplicatesSpec struct {
+	// Distance is the most bits of SimHash two near duplicates differ by. Default 3.
+	Distance int `yaml:"distance" json:"distance"`
+	// Action is mark (default) or skip.
+	Action string `yaml:"action" json:"action"`
+	// MinFeatures is the fewest word shingles a page needs to be compared. Default 20.
+	MinFeatures int `yaml:"min_features" json:"min_features"`
+}
+
+// IncrementalSpec mirrors incremental.Tracker, durations are in seconds.
+type IncrementalSpec struct {
+	// Store is the JSON Lines file of the records. Default is in memory.
+	Store string `yaml:"store" json:"store"`
+	// Fingerprint is body (default) or items.
+	Fingerprint string `yaml:"fingerprint" json:"fingerprint"`
+	// Revisit is fixed or adaptive, every url is due at each crawl when unset.
+	Revisit string `yaml:"revisit" json:"revisit"`
+	// Interval of fixed revisits, or the minimum of adaptive ones.
+	Interval uint `yaml:"interval" json:"interval"`
+	// MaxInterval of adaptive revisits.
+	MaxInterval uint `yaml:"max_interval" json:"max_interval"`
+	// EmitUnchanged hands the items of unchanged pages to the pipelines too.
+	EmitUnchanged bool `yaml:"emit_unchanged" json:"emit_unchanged"`
+}
+
+// AdaptiveSpec mirrors controller.GoroutineControllerAdaptive, durations are in milliseconds.
+type AdaptiveSpec struct {
+	Min uint `yaml:"min" json:"min"`
+	Max uint `yaml:"max" json:"max"`
+	// HostMin and HostMax limit each host too when HostMax is set.
+	HostMin       uint `yaml:"host_min" json:"host_min"`
+	HostMax       uint `yaml:"host_max" json:"host_max"`
+	LatencyTarget uint `yaml:"latency_target" json:"latency_target"`
+}
+
+// LimitsSpec mirrors request.Limits, durations are in milliseconds.
+type LimitsSpec struct {
+	Timeout      uint  `yaml:"timeout" json:"timeout"`
+	MaxBodyBytes int64 `yaml:"max_body_bytes" json:"max_body_bytes"`
+	// BodyLimit is truncate (default) or fail.
+	BodyLimit string `yaml:"body_limit" json:"body_limit"`
+	// MaxRedirects is the number of redirects followed, -1 follows none. Default 10.
+	MaxRedirects int `yaml:"max_redirects" json:"max_redirects"`
+	// SameHost refuses redirects to other hosts.
+	SameHost bool `yaml:"same_host" json:"same_host"`
+}
+
+// SleepSpec mirrors Crawler.SetSleepTime, durations are in milliseconds.
+type SleepSpec struct {
+	// Type is fixed or rand.
+	Type string `yaml:"type" json:"type"`
+	Min  uint   `yaml:"min" json:"min"`
+	Max  uint   `yaml:"max" json:"max"`
+}
+
+// RuleSpec mirrors processor.Rule.
+type RuleSpec struct {
+	// Match is a regular expression on urls.
+	Match string `yaml:"match" json:"match"`
+	// Tag is the UrlTag of requests created by the rule.
+	Tag string `yaml:"tag" json:"tag"`
+	// Follow extracts links from pages handled by the rule.
+	Follow bool `yaml:"follow" json:"follow"`
+	// RespType of requests created by the rule.
+	RespType string `yaml:"resp_type" json:"resp_type"`
+	// Links configures link extraction.
+	Links *LinksSpec `yaml:"links" json:"links"`
+	// Fields are extracted from pages handled by the rule.
+	Fields []*FieldSpec `yaml:"fields" json:"fields"`
+	// Article extracts the main text and the metadata of the pages handled
+	// by the rule, see article.Article.Items. Fields override its values.
+	Article bool `yaml:"article" json:"article"`
+	// Structured adds the structured data items of these types, e.g. Product,
+	// see structured.AddAll. Fields override its values.
+	Structured []string `yaml:"structured" json:"structured"`
+}
+
+// LinksSpec mirrors page.LinkOptions.
+type LinksSpec struct {
+	Restrict       string   `yaml:"restrict" json:"restrict"`
+	Tags           []string `yaml:"tags" json:"tags"`
+	Allow          []string `yaml:"allow" json:"allow"`
+	Deny           []string `yaml:"deny" json:"deny"`
+	DenyExtensions []string `yaml:"deny_extensions" json:"deny_extensions"`
+	SkipNofollow   bool     `yaml:"skip_nofollow" json:"skip_nofollow"`
+}
+
+// FieldSpec extracts one named value. Exactly one of CSS, XPath, Regex and Json is set.
+type FieldSpec struct {
+	Name  string `yaml:"name" json:"name"`
+	CSS   string `yaml:"css" json:"css"`
+	XPath string `yaml:"xpath" json:"xpath"`
+	Regex string `yaml:"regex" json:"regex"`
+	Json  string `yaml:"json" json:"json"`
+	// Attr selects what a CSS match yields: text (default), html or an attribute name.
+	// On xml pages html is the markup of the element and prefixed attributes are
+	// named prefix:local. CSS selectors name prefixed elements prefix|local there.
+	Attr string `yaml:"attr" json:"attr"`
+	// Group is the regex sub match to use, default 1 when the expression has groups.
+	Group *int `yaml:"group" json:"group"`
+	// All keeps every match joined with Separator instead of the first one.
+	All       bool   `yaml:"all" json:"all"`
+	Separator string `yaml:"separator" json:"separator"`
+	// Required skips the page when the field is empty.
+	Required bool `yaml:"required" json:"required"`
+}
+
+// PipelineSpec selects an output: console, file (path) or jsonl (path).
+type PipelineSpec struct {
+	Type string `yaml:"type" json:"type"`
+	Path string `yaml:"path" json:"path"`
+}
+
+// ValidationError lists every problem found in a spec.
+type ValidationError struct {
+	Source   string
+	Problems []string
+}
+
+func (this *ValidationError) Error() string {
+	prefix := "invalid spec"
+	if this.Source != "" {
+		prefix += " " + this.Source
+	}
+	return prefix + ":\n  " + strings.Join(this.Problems, "\n  ")
+}
+
+// Load reads a spec file. The format is chosen by extension: .json or .yaml/.yml.
+func Load(path string) (*Spec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format := "yaml"
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		format = "json"
+	}
+	s, err := Parse(data, format)
+	if verr, ok := err.(*ValidationError); ok {
+		verr.Source = path
+	}
+	return s, err
+}
+
+// Parse decodes a spec in format "yaml" or "json" and validates it.
+// Unknown keys are reported as errors.
+func Parse(data []byte, format string) (*Spec, error) {
+	s := &Spec{}
+	var err error
+	switch format {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(s)
+	case "yaml", "yml":
+		err = yaml.UnmarshalStrict(data, s)
+	default:
+		return nil, fmt.Errorf("unknown spec format %q", format)
+	}
+	if err != nil {
+		return nil, &ValidationError{Problems: []string{err.Error()}}
+	}
+	if err = s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+var respTypes = map[string]bool{"": true, "html": true, "json": true, "jsonp": true, "text": true, "feed": true, "xml": true}
+
+// Validate checks the spec and returns a *ValidationError naming each bad field.
+func (this *Spec) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if this.Name == "" {
+		add("name: required")
+	}
+	if len(this.Seeds) == 0 {
+		add("seeds: at least one url is required")
+	}
+	for i, seed := range this.Seeds {
+		if !strings.HasPrefix(seed, "http://") && !strings.HasPrefix(seed, "https://") {
+			add("seeds[%d]: %q is not an http(s) url", i, seed)
+		}
+	}
+	if !respTypes[this.RespType] {
+		add("resp_type: %q is not one of html, json, jsonp, text, feed, xml", this.RespType)
+	}
+	if s := this.Sleep; s != nil {
+		switch s.Type {
+		case "", "fixed":
+		case "rand":
+			if s.Min >= s.Max {
+				add("sleep: min (%d) must be smaller than max (%d) for type rand", s.Min, s.Max)
+			}
+		default:
+			add("sleep.type: %q is not one of fixed, rand", s.Type)
+		}
+	}
+	if a := this.Adaptive; a != nil {
+		if a.Max == 0 || a.Min > a.Max {
+			add("adaptive: max (%d) must be set and at least min (%d)", a.Max, a.Min)
+		}
+		if a.HostMin > a.HostMax && a.HostMax > 0 {
+			add("adaptive: host_max (%d) must be at least host_min (%d)", a.HostMax, a.HostMin)
+		}
+	}
+	if l := this.Limits; l != nil {
+		if l.BodyLimit != "" && l.BodyLimit != request.BodyTruncate && l.BodyLimit != request.BodyFail {
+			add("limits.body_limit: %q is not one of truncate, fail", l.BodyLimit)
+		}
+		if l.MaxBodyBytes < 0 {
+			add("limits.max_body_bytes: must not be negative")
+		}
+		if l.MaxRedirects < request.NoRedirects {
+			add("limits.max_redirects: %d is smaller than -1", l.MaxRedirects)
+		}
+	}
+	if inc := this.Incremental; inc != nil {
+		if inc.Fingerprint != "" && inc.Fingerprint != incremental.FingerprintBody && inc.Fingerprint != incremental.FingerprintItems {
+			add("incremental.fingerprint: %q is not one of body, items", inc.Fingerprint)
+		}
+		switch inc.Revisit {
+		case "":
+		case "fixed":
+			if inc.Interval == 0 {
+				add("incremental.interval: required for fixed revisits")
+			}
+		case "adaptive":
+			if inc.MaxInterval == 0 || inc.MaxInterval < inc.Interval {
+				add("incremental: max_interval (%d) must be set and at least interval (%d)", inc.MaxInterval, inc.Interval)
+			}
+		default:
+			add("incremental.revisit: %q is not one of fixed, adaptive", inc.Revisit)
+		}
+	}
+	if nd := this.NearDuplicates; nd != nil {
+		if nd.Distance < 0 || nd.Distance > neardup.MaxDistance {
+			add("near_duplicates.distance: %d is out of range 0-%d", nd.Distance, neardup.MaxDistance)
+		}
+		if nd.Action != "" && nd.Action != neardup.ActionMark && nd.Action != neardup.ActionSkip {
+			add("near_duplicates.action: %q is not one of mark, skip", nd.Action)
+		}
+	}
+	if len(this.Rules) == 0 {
+		add("rules: at least one rule is required")
+	}
+	for i, r := range this.Rules {
+		at := fmt.Sprintf("rules[%d]", i)
+		if r == nil {
+			add("%s: empty rule", at)
+			continue
+		}
+		if r.Match == "" && r.Tag == "" && r.Links == nil {
+			add("%s: one of match, tag or links is required", at)
+		}
+		checkRegexp(add, at+".match", r.Match)
+		if !respTypes[r.RespType] {
+			add("%s.resp_type: %q is not one of html, json, jsonp, text, feed, xml", at, r.RespType)
+		}
+		if r.Links != nil {
+			for j, p := range r.Links.Allow {
+				checkRegexp(add, fmt.Sprintf("%s.links.allow[%d]", at, j), p)
+			}
+			for j, p := range r.Links.Deny {
+				checkRegexp(add, fmt.Sprintf("%s.links.deny[%d]", at, j), p)
+			}
+		}
+		names := make(map[string]bool)
+		for j, f := range r.Fields {
+			fat := fmt.Sprintf("%s.fields[%d]", at, j)
+			if f == nil {
+				add("%s: empty field", fat)
+				continue
+			}
+			if f.Name == "" {
+				add("%s.name: required", fat)
+			} else if names[f.Name] {
+				add("%s.name: duplicate field %q", fat, f.Name)
+			}
+			names[f.Name] = true
+			if _, err := NewExtractor(f); err != nil {
+				add("%s: %s", fat, err.Error())
+			}
+		}
+	}
+	for i, p := range this.Pipelines {
+		at := fmt.Sprintf("pipelines[%d]", i)
+		if p == nil {
+			add("%s: empty pipeline", at)
+			continue
+		}
+		switch p.Type {
+		case "console":
+		case "file", "jsonl":
+			if p.Path == "" {
+				add("%s.path: required for type %s", at, p.Type)
+			}
+		default:
+			add("%s.type: %q is not one of console, file, jsonl", at, p.Type)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ValidateDistributed reports the fields a coordinator and its workers do not
+// support, the crawl would differ from "crawler run" otherwise.
+func (this *Spec) ValidateDistributed() error {
+	var problems []string
+	if this.Adaptive != nil {
+		problems = append(problems, "adaptive: not supported in distributed mode, use threads")
+	}
+	if this.Sleep != nil {
+		problems = append(problems, "sleep: not supported in distributed mode")
+	}
+	if this.Incremental != nil {
+		problems = append(problems, "incremental: not supported in distributed mode")
+	}
+	if this.NearDuplicates != nil {
+		problems = append(problems, "near_duplicates: not supported in distributed mode")
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func checkRegexp(add func(string, ...interface{}), at string, pattern string) {
+	if pattern == "" {
+		return
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		add("%s: %s", at, err.Error())
+	}
+}
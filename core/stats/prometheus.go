@@ -0,0 +1,106 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WritePrometheus writes the snapshot in the Prometheus text exposition format.
+func (this *Snapshot) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	task := `task="` + escapeLabel(this.Task) + `"`
+
+	counter := func(name, help string, v uint64) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s counter\n%s{%s} %d\n", name, help, name, name, task, v)
+	}
+	gauge := func(name, help string, v float64) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n%s{%s} %s\n", name, help, name, name, task, formatFloat(v))
+	}
+
+	counter("crawler_requests_scheduled_total", "Requests pushed to the scheduler.", this.Scheduled)
+	counter("crawler_requests_downloaded_total", "Requests downloaded successfully.", this.Downloaded)
+	counter("crawler_requests_failed_total", "Requests given up after the last attempt.", this.Failed)
+	counter("crawler_requests_retried_total", "Download attempts after the first one.", this.Retried)
+	counter("crawler_requests_deduped_total", "Requests dropped as duplicates by the scheduler.", this.Deduped)
+	counter("crawler_received_bytes_total", "Bytes of downloaded bodies.", this.Bytes)
+	gauge("crawler_queue_depth", "Requests waiting in the scheduler.", float64(this.QueueDepth))
+	gauge("crawler_active_goroutines", "Requests being downloaded or processed.", float64(this.Active))
+	gauge("crawler_uptime_seconds", "Time since the crawl started.", this.Elapsed.Seconds())
+
+	fmt.Fprint(bw, "# HELP crawler_responses_total Download attempts by http status, code 0 is a network error.\n")
+	fmt.Fprint(bw, "# TYPE crawler_responses_total counter\n")
+	codes := make([]int, 0, len(this.StatusCodes))
+	for c := range this.StatusCodes {
+		codes = append(codes, c)
+	}
+	sort.Ints(codes)
+	for _, c := range codes {
+		fmt.Fprintf(bw, "crawler_responses_total{%s,code=\"%d\"} %d\n", task, c, this.StatusCodes[c])
+	}
+
+	fmt.Fprint(bw, "# HELP crawler_download_duration_seconds Download latency by host.\n")
+	fmt.Fprint(bw, "# TYPE crawler_download_duration_seconds histogram\n")
+	hosts := make([]string, 0, len(this.Hosts))
+	for h := range this.Hosts {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		h := this.Hosts[host]
+		labels := task + `,host="` + escapeLabel(host) + `"`
+		for i, le := range LatencyBuckets {
+			fmt.Fprintf(bw, "crawler_download_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, formatFloat(le), h.Buckets[i])
+		}
+		fmt.Fprintf(bw, "crawler_download_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.Count)
+		fmt.Fprintf(bw, "crawler_download_duration_seconds_sum{%s} %s\n", labels, formatFloat(h.Sum))
+		fmt.Fprintf(bw, "crawler_download_duration_seconds_count{%s} %d\n", labels, h.Count)
+	}
+
+	fmt.Fprint(bw, "# HELP crawler_items_total Items handed to each pipeline.\n")
+	fmt.Fprint(bw, "# TYPE crawler_items_total counter\n")
+	names := make([]string, 0, len(this.Items))
+	for n := range this.Items {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		fmt.Fprintf(bw, "crawler_items_total{%s,pipeline=\"%s\"} %d\n", task, escapeLabel(n), this.Items[n])
+	}
+
+	if len(this.Changes) > 0 {
+		fmt.Fprint(bw, "# HELP crawler_pages_total Pages by change state in incremental mode.\n")
+		fmt.Fprint(bw, "# TYPE crawler_pages_total counter\n")
+		states := make([]string, 0, len(this.Changes))
+		for s := range this.Changes {
+			states = append(states, s)
+		}
+		sort.Strings(states)
+		for _, s := range states {
+			fmt.Fprintf(bw, "crawler_pages_total{%s,change=\"%s\"} %d\n", task, escapeLabel(s), this.Changes[s])
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler serves the metrics of s in the Prometheus text format.
+func Handler(s *Stats) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		s.Snapshot().WritePrometheus(w)
+	})
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,315 @@
+// Package stats counts what a crawler does and exposes it as snapshots or Prometheus metrics.
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of the download latency histograms.
+var LatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Sources supply the values the crawler does not push itself.
+type Sources struct {
+	QueueDepth func() int
+	Active     func() int
+	Deduped    func() uint64
+}
+
+// Stats is safe for concurrent use.
+type Stats struct {
+	task string
+
+	scheduled  uint64
+	downloaded uint64
+	failed     uint64
+	retried    uint64
+	bytes      uint64
+
+	mutex       sync.Mutex
+	started     time.Time
+	finished    time.Time
+	statusCodes map[int]uint64
+	hosts       map[string]*histogram
+	pipelines   map[string]uint64
+	changes     map[string]uint64
+	sources     Sources
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+	failed uint64
+}
+
+func NewStats(task string) *Stats {
+	s := &Stats{task: task}
+	s.Reset()
+	return s
+}
+
+// Reset clears every counter and restarts the clock.
+func (this *Stats) Reset() {
+	atomic.StoreUint64(&this.scheduled, 0)
+	atomic.StoreUint64(&this.downloaded, 0)
+	atomic.StoreUint64(&this.failed, 0)
+	atomic.StoreUint64(&this.retried, 0)
+	atomic.StoreUint64(&this.bytes, 0)
+	this.mutex.Lock()
+	this.started = time.Now()
+	this.finished = time.Time{}
+	this.statusCodes = make(map[int]uint64)
+	this.hosts = make(map[string]*histogram)
+	this.pipelines = make(map[string]uint64)
+	this.changes = make(map[string]uint64)
+	this.mutex.Unlock()
+}
+
+// SetSources sets the functions read for gauges at snapshot time.
+func (this *Stats) SetSources(s Sources) {
+	this.mutex.Lock()
+	this.sources = s
+	this.mutex.Unlock()
+}
+
+// Finish stops the clock used for the elapsed time and rates, and keeps the
+// values of the sources: the crawler resets its scheduler after the run.
+func (this *Stats) Finish() {
+	this.mutex.Lock()
+	src := this.sources
+	this.mutex.Unlock()
+	queueDepth, active, deduped := src.values()
+
+	this.mutex.Lock()
+	this.finished = time.Now()
+	this.sources = Sources{
+		QueueDepth: func() int { return queueDepth },
+		Active:     func() int { return active },
+		Deduped:    func() uint64 { return deduped },
+	}
+	this.mutex.Unlock()
+}
+
+// values reads the sources set.
+func (this Sources) values() (queueDepth int, active int, deduped uint64) {
+	if this.QueueDepth != nil {
+		queueDepth = this.QueueDepth()
+	}
+	if this.Active != nil {
+		active = this.Active()
+	}
+	if this.Deduped != nil {
+		deduped = this.Deduped()
+	}
+	return queueDepth, active, deduped
+}
+
+func (this *Stats) IncScheduled() {
+	atomic.AddUint64(&this.scheduled, 1)
+}
+
+// AddScheduled counts n requests scheduled at once, e.g. seeds queued before the run.
+func (this *Stats) AddScheduled(n uint64) {
+	atomic.AddUint64(&this.scheduled, n)
+}
+
+func (this *Stats) IncRetried() {
+	atomic.AddUint64(&this.retried, 1)
+}
+
+// IncFailed counts a request given up after its last attempt.
+func (this *Stats) IncFailed() {
+	atomic.AddUint64(&this.failed, 1)
+}
+
+// ObserveDownload records one download attempt.
+// Status is 0 when no response was received.
+func (this *Stats) ObserveDownload(host string, status int, d time.Duration, size int, succ bool) {
+	if succ {
+		atomic.AddUint64(&this.downloaded, 1)
+	}
+	atomic.AddUint64(&this.bytes, uint64(size))
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.statusCodes[status]++
+	h, ok := this.hosts[host]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(LatencyBuckets))}
+		this.hosts[host] = h
+	}
+	sec := d.Seconds()
+	for i, le := range LatencyBuckets {
+		if sec <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += sec
+	if !succ {
+		h.failed++
+	}
+}
+
+// IncItems counts items handed to the named pipeline.
+func (this *Stats) IncItems(pipeline string) {
+	this.mutex.Lock()
+	this.pipelines[pipeline]++
+	this.mutex.Unlock()
+}
+
+// IncChange counts a page by its change state in incremental mode, see
+// incremental.Tracker. State not_due counts the requests skipped before download.
+func (this *Stats) IncChange(state string) {
+	this.mutex.Lock()
+	this.changes[state]++
+	this.mutex.Unlock()
+}
+
+// Snapshot is a point in time copy of Stats.
+type Snapshot struct {
+	Task       string        `json:"task"`
+	Started    time.Time     `json:"started"`
+	Elapsed    time.Duration `json:"elapsed"`
+	Scheduled  uint64        `json:"scheduled"`
+	Downloaded uint64        `json:"downloaded"`
+	Failed     uint64        `json:"failed"`
+	Retried    uint64        `json:"retried"`
+	Deduped    uint64        `json:"deduped"`
+	Bytes      uint64        `json:"bytes"`
+	QueueDepth int           `json:"queue_depth"`
+	Active     int           `json:"active"`
+	// StatusCodes counts download attempts per http status, 0 for network errors.
+	StatusCodes map[int]uint64 `json:"status_codes"`
+	// Hosts holds the download latency histogram of each host.
+	Hosts map[string]*HostLatency `json:"hosts"`
+	// Items counts items per pipeline.
+	Items map[string]uint64 `json:"items"`
+	// Changes counts pages per change state in incremental mode.
+	Changes map[string]uint64 `json:"changes,omitempty"`
+}
+
+// HostLatency is a cumulative histogram of download latencies; Buckets[i]
+// counts downloads faster than LatencyBuckets[i] seconds.
+type HostLatency struct {
+	Buckets []uint64 `json:"buckets"`
+	Count   uint64   `json:"count"`
+	Sum     float64  `json:"sum"`
+	// Failed counts the attempts that failed.
+	Failed uint64 `json:"failed"`
+}
+
+// Mean returns the average latency.
+func (this *HostLatency) Mean() time.Duration {
+	if this.Count == 0 {
+		return 0
+	}
+	return time.Duration(this.Sum / float64(this.Count) * float64(time.Second))
+}
+
+// Snapshot copies the current values.
+func (this *Stats) Snapshot() *Snapshot {
+	snap := &Snapshot{
+		Task:       this.task,
+		Scheduled:  atomic.LoadUint64(&this.scheduled),
+		Downloaded: atomic.LoadUint64(&this.downloaded),
+		Failed:     atomic.LoadUint64(&this.failed),
+		Retried:    atomic.LoadUint64(&this.retried),
+		Bytes:      atomic.LoadUint64(&this.bytes),
+	}
+
+	this.mutex.Lock()
+	snap.Started = this.started
+	end := this.finished
+	if end.IsZero() {
+		end = time.Now()
+	}
+	snap.Elapsed = end.Sub(this.started)
+	snap.StatusCodes = make(map[int]uint64, len(this.statusCodes))
+	for k, v := range this.statusCodes {
+		snap.StatusCodes[k] = v
+	}
+	snap.Hosts = make(map[string]*HostLatency, len(this.hosts))
+	for k, h := range this.hosts {
+		snap.Hosts[k] = &HostLatency{Buckets: append([]uint64(nil), h.counts...), Count: h.count, Sum: h.sum, Failed: h.failed}
+	}
+	snap.Items = make(map[string]uint64, len(this.pipelines))
+	for k, v := range this.pipelines {
+		snap.Items[k] = v
+	}
+	if len(this.changes) > 0 {
+		snap.Changes = make(map[string]uint64, len(this.changes))
+		for k, v := range this.changes {
+			snap.Changes[k] = v
+		}
+	}
+	src := this.sources
+	this.mutex.Unlock()
+
+	snap.QueueDepth, snap.Active, snap.Deduped = src.values()
+	return snap
+}
+
+// String returns a multi line summary fit for logs.
+func (this *Snapshot) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "crawl stats of %q after %s:\n", this.Task, this.Elapsed.Round(time.Millisecond))
+	rate := 0.0
+	if sec := this.Elapsed.Seconds(); sec > 0 {
+		rate = float64(this.Downloaded) / sec
+	}
+	fmt.Fprintf(&b, "  requests: %d scheduled, %d downloaded (%.2f/s), %d failed, %d retried, %d deduped\n",
+		this.Scheduled, this.Downloaded, rate, this.Failed, this.Retried, this.Deduped)
+	fmt.Fprintf(&b, "  received: %d bytes, queue: %d, active: %d\n", this.Bytes, this.QueueDepth, this.Active)
+
+	codes := make([]int, 0, len(this.StatusCodes))
+	for c := range this.StatusCodes {
+		codes = append(codes, c)
+	}
+	sort.Ints(codes)
+	parts := make([]string, 0, len(codes))
+	for _, c := range codes {
+		name := fmt.Sprint(c)
+		if c == 0 {
+			name = "error"
+		}
+		parts = append(parts, fmt.Sprintf("%s=%d", name, this.StatusCodes[c]))
+	}
+	fmt.Fprintf(&b, "  status: %s\n", strings.Join(parts, " "))
+
+	hosts := make([]string, 0, len(this.Hosts))
+	for host := range this.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		h := this.Hosts[host]
+		fmt.Fprintf(&b, "  host %s: %d downloads, mean %s\n", host, h.Count, h.Mean().Round(time.Millisecond))
+	}
+	names := make([]string, 0, len(this.Items))
+	for name := range this.Items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "  pipeline %s: %d items\n", name, this.Items[name])
+	}
+	if len(this.Changes) > 0 {
+		states := make([]string, 0, len(this.Changes))
+		for state := range this.Changes {
+			states = append(states, state)
+		}
+		sort.Strings(states)
+		parts := make([]string, 0, len(states))
+		for _, state := range states {
+			parts = append(parts, fmt.Sprintf("%s=%d", state, this.Changes[state]))
+		}
+		fmt.Fprintf(&b, "  pages: %s\n", strings.Join(parts, " "))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,96 @@
+// Distributed runs a coordinator and several workers in one process against a
+// small generated site. The first worker loses its connection to the
+// coordinator while holding a lease, the lease expires and another worker
+// crawls its requests again.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/viixv/crawler/core/commons/page"
+	"github.com/viixv/crawler/core/distributed"
+	"github.com/viixv/crawler/core/pipeline"
+	"github.com/viixv/crawler/core/processor"
+	"github.com/viixv/crawler/core/scheduler"
+)
+
+// serveSite serves pages /1 to /n, page i links to 2i and 2i+1.
+func serveSite(n int) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i, err := strconv.Atoi(r.URL.Path[1:])
+		if err != nil || i < 1 || i > n {
+			http.NotFound(w, r)
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprintf(w, "<html><head><title>page %d</title></head><body>", i)
+		for _, child := range []int{2 * i, 2*i + 1} {
+			if child <= n {
+				fmt.Fprintf(w, `<a href="/%d">page %d</a>`, child, child)
+			}
+		}
+		fmt.Fprint(w, "</body></html>")
+	}))
+	return "http://" + ln.Addr().String()
+}
+
+func newProcessor() processor.PageProcessor {
+	return processor.NewRuleProcessor(&processor.Rule{
+		Match:  regexp.MustCompile(`/\d+$`),
+		Links:  &page.LinkOptions{},
+		Follow: true,
+		Callback: func(p *page.Page) {
+			p.AddField("title", p.GetHtmlParser().Find("title").Text())
+		},
+	})
+}
+
+func main() {
+	pages := flag.Int("pages", 200, "pages of the generated site")
+	workers := flag.Int("workers", 4, "workers to run")
+	flag.Parse()
+
+	site := serveSite(*pages)
+	coordinator := distributed.NewCoordinator("distributed-demo", scheduler.NewQueueScheduler(false))
+	coordinator.SetLeaseTTL(2 * time.Second).SetMaxBatch(5)
+	coordinator.AddPipeline(pipeline.NewConsolePipeline())
+	coordinator.AddUrls([]string{site + "/1"}, "html")
+	addr, err := coordinator.Start("127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		w := distributed.NewWorker("http://"+addr, fmt.Sprintf("worker-%d", i), newProcessor())
+		w.SetThreadnum(2).SetBatchSize(5)
+		if i == 0 {
+			w.SetHttpClient(&http.Client{Transport: &partition{leases: 3}})
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.Run(); err != nil {
+				fmt.Println(err)
+			}
+		}()
+	}
+
+	coordinator.Wait()
+	st := coordinator.Status()
+	fmt.Printf("done: %d completed, %d items, %d failed, %d re-queued after lease expiry\n",
+		st.Completed, st.Items, st.Failed, st.Expired)
+	wg.Wait()
+	coordinator.Close()
+}
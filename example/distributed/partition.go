@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// partition lets a worker talk to the coordinator until it took a few
+// leases, then cuts it off as if its machine went away.
+type partition struct {
+	leases int
+	mutex  sync.Mutex
+	n      int
+}
+
+func (this *partition) RoundTrip(req *http.Request) (*http.Response, error) {
+	lease := strings.HasSuffix(req.URL.Path, "/lease")
+	this.mutex.Lock()
+	if lease {
+		this.n++
+	}
+	// The last lease is granted, it is never extended nor reported.
+	cut := this.n > this.leases || (this.n == this.leases && !lease)
+	this.mutex.Unlock()
+	if cut {
+		return nil, errors.New("network unreachable")
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
@@ -0,0 +1,61 @@
+// Redis runs several crawler processes, here goroutines, sharing one queue
+// on a Redis compatible server. Without -redis an in-process stand-in is used.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/viixv/crawler/core/commons/page"
+	"github.com/viixv/crawler/core/commons/redis"
+	"github.com/viixv/crawler/core/commons/request"
+	"github.com/viixv/crawler/core/crawler"
+	"github.com/viixv/crawler/core/pipeline"
+	"github.com/viixv/crawler/core/processor"
+	"github.com/viixv/crawler/core/scheduler"
+)
+
+func main() {
+	addr := flag.String("redis", "", "address of the Redis server, empty for the in-process stand-in")
+	seed := flag.String("seed", "http://www.pearvideo.com/popular", "url to start from")
+	processes := flag.Int("processes", 3, "crawlers sharing the queue")
+	flag.Parse()
+
+	if *addr == "" {
+		server := redis.NewServer()
+		a, err := server.Start("127.0.0.1:0")
+		if err != nil {
+			panic(err)
+		}
+		defer server.Close()
+		*addr = a
+	}
+
+	shared := scheduler.NewRedisScheduler(redis.NewClient(*addr), "redis-demo", true)
+	shared.Clear()
+	// The seed goes to the shared queue, only one crawler gets it.
+	shared.Push(request.New(*seed).Build())
+
+	var wg sync.WaitGroup
+	for i := 0; i < *processes; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rules := processor.NewRuleProcessor(&processor.Rule{
+				Match: regexp.MustCompile(`video_\d+`),
+				Callback: func(p *page.Page) {
+					p.AddField("process", fmt.Sprint(i))
+					p.AddField("title", p.GetHtmlParser().Find("title").Text())
+				},
+			})
+			crawler.NewCrawler(rules, "redis-demo").
+				SetScheduler(scheduler.NewRedisScheduler(redis.NewClient(*addr), "redis-demo", true)).
+				AddPipeline(pipeline.NewConsolePipeline()).
+				SetThreadnum(4).
+				Run()
+		}(i)
+	}
+	wg.Wait()
+}